@@ -0,0 +1,100 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "fmt"
+)
+
+// backendAction is an operation of the backend API. Its value is the action
+// name sent on the wire.
+type backendAction string
+
+const (
+    actionAddUser        backendAction = "AddUser"
+    actionDelUser        backendAction = "VaultDelUser"
+    actionChangePassword backendAction = "ChangePassword"
+    actionListUsers      backendAction = "ListUsers"
+    actionGetUser        backendAction = "GetUser"
+    actionBatchDelUser   backendAction = "VaultBatchDelUser"
+    actionGrantDatabase  backendAction = "GrantDatabase"
+    actionRevokeDatabase backendAction = "RevokeDatabase"
+    actionRevokeByRole   backendAction = "VaultRevokeByRole"
+    actionCapabilities   backendAction = "Capabilities"
+    actionWhoAmI         backendAction = "WhoAmI"
+    actionPrepareUser    backendAction = "PrepareUser"
+    actionCommitUser     backendAction = "CommitUser"
+    actionAbortUser      backendAction = "AbortUser"
+)
+
+// actionSpec describes how requests for an action are assembled and how its
+// result is read.
+type actionSpec struct {
+    // revocation actions are made with the revocation-scoped token.
+    revocation bool
+    // batch actions carry several usernames instead of one.
+    batch bool
+    // creates actions aren't idempotent: resent, they may create the user
+    // twice or fail on the user the first request created.
+    creates bool
+    // required are the fields a request body must carry.
+    required []string
+    // responseFields are the fixed result fields read beyond the envelope.
+    responseFields []string
+}
+
+var actionSpecs = map[backendAction]actionSpec{
+    actionAddUser:        {creates: true, required: []string{"username", "password"}},
+    actionDelUser:        {revocation: true, required: []string{"username"}},
+    actionChangePassword: {required: []string{"username", "password"}},
+    actionListUsers:      {responseFields: []string{"users"}},
+    actionGetUser:        {required: []string{"username"}, responseFields: []string{"exists"}},
+    actionBatchDelUser:   {revocation: true, batch: true, required: []string{"usernames"}, responseFields: []string{"results"}},
+    actionGrantDatabase:  {required: []string{"username", "dbname"}},
+    actionRevokeDatabase: {required: []string{"username", "dbname"}},
+    actionRevokeByRole:   {revocation: true, required: []string{"role"}, responseFields: []string{"usernames"}},
+    actionCapabilities:   {responseFields: []string{"actions"}},
+    actionWhoAmI:         {responseFields: []string{"scopes"}},
+    actionPrepareUser:    {creates: true, required: []string{"username", "password"}},
+    actionCommitUser:     {required: []string{"username"}},
+    actionAbortUser:      {required: []string{"username"}},
+}
+
+// actionToken returns the token requests for action are made with.
+func (c *mgtvMysqlConnectionProducer) actionToken(ctx context.Context, action backendAction) (string, error) {
+    if actionSpecs[action].revocation {
+        return c.revocationToken(ctx)
+    }
+    return c.token(ctx)
+}
+
+// buildRequest assembles the body of a request for action from the decoded
+// statement, which is not modified, and fields, adding the token the action is
+// made with. Every operation builds its body here, so that bodies are put
+// together and validated the same way; post adds the action itself.
+func (c *mgtvMysqlConnectionProducer) buildRequest(ctx context.Context, action backendAction, statement, fields map[string]interface{}) (map[string]interface{}, error) {
+    spec, ok := actionSpecs[action]
+    if !ok {
+        return nil, fmt.Errorf("unknown backend action %q", action)
+    }
+    if err := c.requireCapability(ctx, action); err != nil {
+        return nil, err
+    }
+    token, err := c.actionToken(ctx, action)
+    if err != nil {
+        return nil, err
+    }
+    body := copyBody(statement)
+    for field, value := range fields {
+        body[field] = value
+    }
+    body["token"] = token
+    for _, field := range spec.required {
+        if value, ok := body[field]; !ok || value == nil || value == "" {
+            return nil, fmt.Errorf("%s request is missing %s", action, field)
+        }
+    }
+    return body, nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// TestOperationActions checks every operation sends the action it stands for,
+// with the token and statement fields the shared builder adds.
+func TestOperationActions(t *testing.T) {
+    ctx := context.Background()
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        call   func(db *MgtvMysql) error
+        want   []backendAction
+        // noStatement operations aren't given statements.
+        noStatement bool
+    }{
+        {name: "NewUser", call: func(db *MgtvMysql) error {
+            _, err := newUser(db, "role", testCreateStatement)
+            return err
+        }, want: []backendAction{actionAddUser}},
+        {name: "NewUser, two phase", config: map[string]interface{}{"two_phase_create": true}, call: func(db *MgtvMysql) error {
+            _, err := newUser(db, "role", testCreateStatement)
+            return err
+        }, want: []backendAction{actionPrepareUser, actionCommitUser}},
+        {name: "DeleteUser", call: func(db *MgtvMysql) error {
+            return deleteUser(db, "V_USER_R", testDeleteStatement)
+        }, want: []backendAction{actionDelUser}},
+        {name: "UpdateUser", call: func(db *MgtvMysql) error {
+            _, err := db.UpdateUser(ctx, dbplugin.UpdateUserRequest{
+                Username: "V_USER_R",
+                Password: &dbplugin.ChangePassword{NewPassword: "Passw0rd-0123456789", Statements: statements(testDeleteStatement)},
+            })
+            return err
+        }, want: []backendAction{actionChangePassword}},
+        {name: "DeleteUsers", call: func(db *MgtvMysql) error {
+            _, err := db.DeleteUsers(ctx, []string{"V_A_R", "V_B_R"}, statements(testDeleteStatement))
+            return err
+        }, want: []backendAction{actionBatchDelUser}},
+        {name: "ListUsers", call: func(db *MgtvMysql) error {
+            _, err := db.ListUsers(ctx, statements(testDeleteStatement))
+            return err
+        }, want: []backendAction{actionListUsers}},
+        {name: "GrantDatabase", call: func(db *MgtvMysql) error {
+            return db.GrantDatabase(ctx, "V_USER_R", "d2", statements(testDeleteStatement))
+        }, want: []backendAction{actionGrantDatabase}},
+        {name: "RevokeDatabase", call: func(db *MgtvMysql) error {
+            return db.RevokeDatabase(ctx, "V_USER_R", "d2", statements(testDeleteStatement))
+        }, want: []backendAction{actionRevokeDatabase}},
+        {name: "RevokeByRole", config: map[string]interface{}{"revoke_window_supported": true}, call: func(db *MgtvMysql) error {
+            _, err := db.RevokeByRole(ctx, "role", time.Time{}, time.Now(), statements(testDeleteStatement))
+            return err
+        }, want: []backendAction{actionRevokeByRole}},
+        {name: "Capabilities", call: func(db *MgtvMysql) error {
+            _, err := db.Capabilities(ctx)
+            return err
+        }, want: []backendAction{actionCapabilities}, noStatement: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, tt.config)
+            if err := tt.call(db); err != nil {
+                t.Fatal(err)
+            }
+            var got []backendAction
+            for _, req := range backend.received("") {
+                got = append(got, backendAction(req.action()))
+                if req.Body["token"] != testToken {
+                    t.Errorf("%s sent token %v, want %s", req.action(), req.Body["token"], testToken)
+                }
+                if !tt.noStatement && req.Body["cid"] != "c1" {
+                    t.Errorf("%s lacks the statement's cid: %s", req.action(), req.Raw)
+                }
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Fatalf("actions sent = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestBuildRequest(t *testing.T) {
+    tests := []struct {
+        name      string
+        action    backendAction
+        statement map[string]interface{}
+        fields    map[string]interface{}
+        want      map[string]interface{}
+        wantErr   string
+    }{
+        {
+            name:      "merged",
+            action:    actionDelUser,
+            statement: map[string]interface{}{"cid": "c1"},
+            fields:    map[string]interface{}{"username": "V_USER_R"},
+            want:      map[string]interface{}{"cid": "c1", "username": "V_USER_R", "token": testToken},
+        },
+        {
+            name:      "fields over statement",
+            action:    actionGetUser,
+            statement: map[string]interface{}{"username": "V_OTHER_R"},
+            fields:    map[string]interface{}{"username": "V_USER_R"},
+            want:      map[string]interface{}{"username": "V_USER_R", "token": testToken},
+        },
+        {name: "missing field", action: actionChangePassword, fields: map[string]interface{}{"username": "V_USER_R"}, wantErr: "ChangePassword request is missing password"},
+        {name: "empty field", action: actionDelUser, fields: map[string]interface{}{"username": ""}, wantErr: "VaultDelUser request is missing username"},
+        {name: "unknown action", action: "DropDatabase", wantErr: `unknown backend action "DropDatabase"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, nil)
+            statement := copyBody(tt.statement)
+            body, err := db.buildRequest(context.Background(), tt.action, statement, tt.fields)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("buildRequest error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(body, tt.want) {
+                t.Fatalf("body = %v, want %v", body, tt.want)
+            }
+            if !reflect.DeepEqual(statement, copyBody(tt.statement)) {
+                t.Fatalf("statement modified to %v", statement)
+            }
+        })
+    }
+}
@@ -0,0 +1,84 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net"
+    "time"
+)
+
+const (
+    ambiguousCleanup = "assume_failed_cleanup"
+    ambiguousSuccess = "assume_success"
+    ambiguousVerify  = "verify"
+)
+
+// isAmbiguous reports whether a failed create may still have created the user:
+// the call timed out after the connection was established, or the response
+// was cut short.
+func isAmbiguous(err error) bool {
+    if errors.Is(err, errIncompleteResponse) {
+        return true
+    }
+    var opErr *net.OpError
+    if errors.As(err, &opErr) && opErr.Op == "dial" {
+        return false
+    }
+    if errors.Is(err, context.DeadlineExceeded) {
+        return true
+    }
+    var netErr net.Error
+    return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// followUpContext returns a context for calls made after ctx timed out, bounded
+// by timeout and keeping the connection overrides of ctx.
+func (c *mgtvMysqlConnectionProducer) followUpContext(ctx context.Context) (context.Context, context.CancelFunc) {
+    timeout := c.RequestTimeout * time.Second
+    if timeout <= 0 {
+        timeout = defaultTimeout
+    }
+    followUp, cancel := context.WithTimeout(context.Background(), timeout)
+    return withOverrides(followUp, overridesFrom(ctx)), cancel
+}
+
+// resolveAmbiguousCreate applies on_ambiguous_create to a create of username
+// that failed with the ambiguous createErr. statement holds the create
+// statement fields sent along with follow-up calls. It returns nil when the
+// user is to be treated as created.
+func (c *mgtvMysqlConnectionProducer) resolveAmbiguousCreate(ctx context.Context, username string, statement map[string]interface{}, createErr error) error {
+    ctx, cancel := c.followUpContext(ctx)
+    defer cancel()
+
+    switch c.OnAmbiguousCreate {
+    case ambiguousSuccess:
+        c.logger.Warn("create outcome is ambiguous, assuming it succeeded", "username", c.logName(username), "error", c.logError(createErr, username))
+        return nil
+    case ambiguousVerify:
+        _, exists, err := c.getUser(ctx, username, statement)
+        if err == nil && exists {
+            c.logger.Warn("create outcome was ambiguous, but the user exists", "username", c.logName(username))
+            return nil
+        }
+        if err == nil {
+            return createErr
+        }
+        // When GetUser fails or is unsupported, fall back to the cleanup done
+        // without verifying.
+        c.logger.Warn("failed to verify ambiguous create, cleaning up", "username", c.logName(username), "error", c.logError(err, username))
+    }
+
+    body, err := c.buildRequest(ctx, actionDelUser, statement, map[string]interface{}{"username": username})
+    if err == nil {
+        _, err = c.invoke(ctx, actionDelUser, body)
+        c.invalidateUser(username)
+    }
+    if err != nil {
+        return fmt.Errorf("%w; cleanup of the possibly created user failed: %v", createErr, err)
+    }
+    return createErr
+}
@@ -0,0 +1,101 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "errors"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestOnAmbiguousCreate(t *testing.T) {
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // created is whether the backend creates the user before the create
+        // fails.
+        created bool
+        // fail is how the create fails: "truncate" cuts the response short,
+        // "timeout" answers after request_timeout and "status" reports a
+        // failure, which isn't ambiguous.
+        fail          string
+        getUserFails  bool
+        wantErr       bool
+        wantGetUser   bool
+        wantCleanup   bool
+        wantUsernames int
+    }{
+        {name: "cleanup", config: map[string]interface{}{"on_ambiguous_create": ambiguousCleanup}, created: true, fail: "truncate", wantErr: true, wantCleanup: true},
+        {name: "cleanup after timeout", config: map[string]interface{}{"on_ambiguous_create": ambiguousCleanup, "request_timeout": 1}, created: true, fail: "timeout", wantErr: true, wantCleanup: true},
+        {name: "success", config: map[string]interface{}{"on_ambiguous_create": ambiguousSuccess}, created: true, fail: "truncate", wantUsernames: 1},
+        {name: "verify, created", config: map[string]interface{}{"on_ambiguous_create": ambiguousVerify}, created: true, fail: "truncate", wantGetUser: true, wantUsernames: 1},
+        {name: "verify, not created", config: map[string]interface{}{"on_ambiguous_create": ambiguousVerify}, fail: "truncate", wantErr: true, wantGetUser: true},
+        {name: "verify, GetUser fails", config: map[string]interface{}{"on_ambiguous_create": ambiguousVerify}, created: true, fail: "truncate", getUserFails: true, wantErr: true, wantGetUser: true, wantCleanup: true},
+        {name: "default", created: true, fail: "truncate", wantErr: true, wantCleanup: true},
+        {name: "default with get_user_supported", config: map[string]interface{}{"get_user_supported": true}, created: true, fail: "truncate", wantGetUser: true, wantUsernames: 1},
+        {name: "not ambiguous", config: map[string]interface{}{"on_ambiguous_create": ambiguousSuccess}, fail: "status", wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            truncate := truncateFirst(t, actionAddUser)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                switch {
+                case req.action() == string(actionGetUser) && tt.getUserFails:
+                    w.WriteHeader(http.StatusInternalServerError)
+                    return true
+                case req.action() != string(actionAddUser):
+                    return false
+                case tt.fail == "status":
+                    writeJSON(w, map[string]interface{}{"status": 1, "error": "quota exceeded"})
+                    return true
+                }
+                if tt.created {
+                    backend.result(req)
+                }
+                if tt.fail == "timeout" {
+                    time.Sleep(1500 * time.Millisecond)
+                    return true
+                }
+                return truncate(w, req)
+            })
+            db := newTestDB(t, backend.URL, tt.config)
+
+            username, err := newUser(db, "role", testCreateStatement)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("NewUser error = %v, want an error: %v", err, tt.wantErr)
+            }
+            var createErr *CreateUserError
+            if err != nil && !errors.As(err, &createErr) {
+                t.Fatalf("NewUser error %q isn't a *CreateUserError", err)
+            }
+            if err == nil && username != backend.received(actionAddUser)[0].Body["username"] {
+                t.Fatalf("NewUser returned %q, not the username sent", username)
+            }
+            if got := len(backend.received(actionGetUser)) > 0; got != tt.wantGetUser {
+                t.Errorf("GetUser sent: %v, want %v", got, tt.wantGetUser)
+            }
+            deletes := backend.received(actionDelUser)
+            if got := len(deletes) > 0; got != tt.wantCleanup {
+                t.Fatalf("cleanup sent: %v, want %v", got, tt.wantCleanup)
+            }
+            if tt.wantCleanup && deletes[0].Body["username"] != createErr.Username {
+                t.Errorf("cleanup deleted %v, want %q", deletes[0].Body["username"], createErr.Username)
+            }
+            if n := len(backend.usernames()); n != tt.wantUsernames {
+                t.Errorf("backend holds %d users, want %d", n, tt.wantUsernames)
+            }
+        })
+    }
+}
+
+func TestOnAmbiguousCreateInvalid(t *testing.T) {
+    backend := newFakeBackend(t)
+    err := initError(t, backend.URL, map[string]interface{}{"on_ambiguous_create": "retry"})
+    if err == nil || !strings.Contains(err.Error(), `invalid on_ambiguous_create "retry"`) {
+        t.Fatalf("Initialize error = %v, want an invalid on_ambiguous_create", err)
+    }
+}
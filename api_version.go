@@ -0,0 +1,97 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+// parseAPIVersion parses a dotted numeric version such as 2 or 2.1.
+func parseAPIVersion(v string) ([]int, error) {
+    parts := strings.Split(strings.TrimSpace(v), ".")
+    version := make([]int, len(parts))
+    for i, part := range parts {
+        n, err := strconv.Atoi(part)
+        if err != nil || n < 0 {
+            return nil, fmt.Errorf("invalid api version %q", v)
+        }
+        version[i] = n
+    }
+    return version, nil
+}
+
+// compareAPIVersions returns -1, 0 or 1 as a is older than, equal to or newer
+// than b. Missing trailing components count as zero.
+func compareAPIVersions(a, b []int) int {
+    for i := 0; i < len(a) || i < len(b); i++ {
+        var x, y int
+        if i < len(a) {
+            x = a[i]
+        }
+        if i < len(b) {
+            y = b[i]
+        }
+        switch {
+        case x < y:
+            return -1
+        case x > y:
+            return 1
+        }
+    }
+    return 0
+}
+
+// validateAPIVersionRange checks min_api_version and max_api_version.
+func (c *mgtvMysqlConnectionProducer) validateAPIVersionRange() error {
+    var min, max []int
+    var err error
+    if len(c.MinAPIVersion) > 0 {
+        if min, err = parseAPIVersion(c.MinAPIVersion); err != nil {
+            return fmt.Errorf("invalid min_api_version: %w", err)
+        }
+    }
+    if len(c.MaxAPIVersion) > 0 {
+        if max, err = parseAPIVersion(c.MaxAPIVersion); err != nil {
+            return fmt.Errorf("invalid max_api_version: %w", err)
+        }
+    }
+    if min != nil && max != nil && compareAPIVersions(min, max) > 0 {
+        return fmt.Errorf("invalid max_api_version %q: must not be less than min_api_version %q", c.MaxAPIVersion, c.MinAPIVersion)
+    }
+    return nil
+}
+
+// checkAPIVersion fails when the response advertises, in api_version_header,
+// an API version outside of min_api_version and max_api_version, rather than
+// letting fields of an incompatible API be misread. Responses without the
+// header are accepted, since not every backend advertises its version.
+func (c *mgtvMysqlConnectionProducer) checkAPIVersion(response *http.Response) error {
+    if len(c.APIVersionHeader) == 0 {
+        return nil
+    }
+    advertised := response.Header.Get(c.APIVersionHeader)
+    if len(advertised) == 0 {
+        return nil
+    }
+    version, err := parseAPIVersion(advertised)
+    if err != nil {
+        return fmt.Errorf("backend advertised an unparseable %s: %w", c.APIVersionHeader, err)
+    }
+    if len(c.MinAPIVersion) > 0 {
+        min, _ := parseAPIVersion(c.MinAPIVersion)
+        if compareAPIVersions(version, min) < 0 {
+            return fmt.Errorf("backend api version %s is older than min_api_version %s: upgrade the backend or lower min_api_version", advertised, c.MinAPIVersion)
+        }
+    }
+    if len(c.MaxAPIVersion) > 0 {
+        max, _ := parseAPIVersion(c.MaxAPIVersion)
+        if compareAPIVersions(version, max) > 0 {
+            return fmt.Errorf("backend api version %s is newer than max_api_version %s: upgrade the plugin before raising max_api_version", advertised, c.MaxAPIVersion)
+        }
+    }
+    return nil
+}
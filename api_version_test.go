@@ -0,0 +1,78 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestAPIVersion(t *testing.T) {
+    tests := []struct {
+        name     string
+        min, max string
+        // advertised is the X-Api-Version the backend answers with, none when
+        // empty.
+        advertised string
+        wantErr    string
+    }{
+        {name: "in range", min: "2", max: "3", advertised: "2.5"},
+        {name: "at min", min: "2.1", max: "3", advertised: "2.1.0"},
+        {name: "at max", min: "2", max: "3", advertised: "3"},
+        {name: "not advertised", min: "2", max: "3"},
+        {name: "unbounded", advertised: "17.4"},
+        {name: "older", min: "2.1", max: "3", advertised: "2.0.9", wantErr: "backend api version 2.0.9 is older than min_api_version 2.1"},
+        {name: "newer", min: "2", max: "3", advertised: "3.0.1", wantErr: "backend api version 3.0.1 is newer than max_api_version 3"},
+        {name: "numeric, not lexical", min: "2", max: "9", advertised: "10", wantErr: "is newer than max_api_version 9"},
+        {name: "unparseable", min: "2", advertised: "v2", wantErr: `backend advertised an unparseable X-Api-Version: invalid api version "v2"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if len(tt.advertised) > 0 {
+                    w.Header().Set("X-Api-Version", tt.advertised)
+                }
+                return false
+            })
+            db := newTestDB(t, backend.URL, map[string]interface{}{
+                "api_version_header": "X-Api-Version",
+                "min_api_version":    tt.min,
+                "max_api_version":    tt.max,
+            })
+            err := deleteUser(db, "V_USER_R", testDeleteStatement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("DeleteUser error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+}
+
+func TestAPIVersionRangeInvalid(t *testing.T) {
+    tests := []struct {
+        name     string
+        min, max string
+        wantErr  string
+    }{
+        {name: "min", min: "2.x", wantErr: `invalid min_api_version: invalid api version "2.x"`},
+        {name: "max", max: "-1", wantErr: `invalid max_api_version: invalid api version "-1"`},
+        {name: "max under min", min: "2.10", max: "2.9", wantErr: `invalid max_api_version "2.9": must not be less than min_api_version "2.10"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            err := initError(t, backend.URL, map[string]interface{}{"min_api_version": tt.min, "max_api_version": tt.max})
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+            }
+        })
+    }
+}
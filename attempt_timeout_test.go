@@ -0,0 +1,113 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestAttemptTimeout(t *testing.T) {
+    backend := newFakeBackend(t)
+    tests := []struct {
+        name           string
+        attemptTimeout int
+        pct            int
+        // deadline is how far the ctx deadline is, none when zero.
+        deadline time.Duration
+        want     time.Duration
+    }{
+        {name: "unbounded"},
+        {name: "attempt_timeout", attemptTimeout: 5, want: 5 * time.Second},
+        {name: "attempt_timeout without deadline share", attemptTimeout: 5, pct: 50, want: 5 * time.Second},
+        {name: "share of deadline", pct: 25, deadline: 20 * time.Second, want: 5 * time.Second},
+        {name: "share shorter than attempt_timeout", attemptTimeout: 8, pct: 25, deadline: 20 * time.Second, want: 5 * time.Second},
+        {name: "attempt_timeout shorter than share", attemptTimeout: 2, pct: 50, deadline: 20 * time.Second, want: 2 * time.Second},
+        {name: "deadline passed", pct: 50, deadline: -time.Second, want: time.Nanosecond},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            clock := newFakeClock()
+            db := newTestDB(t, backend.URL, map[string]interface{}{
+                "attempt_timeout":         tt.attemptTimeout,
+                "per_attempt_timeout_pct": tt.pct,
+            }, WithClock(clock))
+            ctx := context.Background()
+            if tt.deadline != 0 {
+                var cancel context.CancelFunc
+                ctx, cancel = context.WithDeadline(ctx, clock.Now().Add(tt.deadline))
+                defer cancel()
+            }
+            if got := db.attemptTimeout(ctx); got != tt.want {
+                t.Fatalf("attemptTimeout = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+// TestAttemptTimeoutBound checks that an attempt hanging at the backend gives
+// up at its share of the deadline rather than the whole of it.
+func TestAttemptTimeoutBound(t *testing.T) {
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, map[string]interface{}{"per_attempt_timeout_pct": 10})
+    backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+        if req.action() != string(actionDelUser) {
+            return false
+        }
+        time.Sleep(time.Second)
+        return false
+    })
+    ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+    defer cancel()
+    start := time.Now()
+    _, err := db.DeleteUser(ctx, dbplugin.DeleteUserRequest{Username: "V_USER_R", Statements: statements(testDeleteStatement)})
+    took := time.Since(start)
+    if err == nil {
+        t.Fatal("DeleteUser succeeded past its attempt timeout")
+    }
+    if took >= time.Second {
+        t.Fatalf("DeleteUser took %v, want it bounded by the 300ms attempt timeout", took)
+    }
+    if ctx.Err() != nil {
+        t.Fatal("the overall deadline was used up")
+    }
+}
+
+// TestAttemptTimeoutShrinks recomputes the share at every attempt, so that it
+// tracks the time left until the deadline.
+func TestAttemptTimeoutShrinks(t *testing.T) {
+    backend := newFakeBackend(t)
+    clock := newFakeClock()
+    db := newTestDB(t, backend.URL, map[string]interface{}{"per_attempt_timeout_pct": 50}, WithClock(clock))
+    ctx, cancel := context.WithDeadline(context.Background(), clock.Now().Add(40*time.Second))
+    defer cancel()
+
+    for _, want := range []time.Duration{20 * time.Second, 10 * time.Second, 5 * time.Second} {
+        timeout := db.attemptTimeout(ctx)
+        if timeout != want {
+            t.Fatalf("attemptTimeout = %v, want %v", timeout, want)
+        }
+        // The attempt used up all of its share.
+        clock.Advance(timeout)
+    }
+}
+
+func TestPerAttemptTimeoutPctInvalid(t *testing.T) {
+    backend := newFakeBackend(t)
+    for _, pct := range []int{-1, 101} {
+        t.Run(fmt.Sprint(pct), func(t *testing.T) {
+            err := initError(t, backend.URL, map[string]interface{}{"per_attempt_timeout_pct": pct})
+            want := fmt.Sprintf("invalid per_attempt_timeout_pct %d: must be between 1 and 100", pct)
+            if err == nil || !strings.Contains(err.Error(), want) {
+                t.Fatalf("Initialize error = %v, want %q", err, want)
+            }
+        })
+    }
+}
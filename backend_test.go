@@ -0,0 +1,316 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "encoding/json"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "sort"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+const (
+    testToken           = "test-token"
+    testCreateStatement = `{"cid":"c1","dbname":"d1"}`
+    testDeleteStatement = `{"cid":"c1"}`
+)
+
+// recordedRequest is a request received by a fakeBackend.
+type recordedRequest struct {
+    Method string
+    Path   string
+    // EscapedPath is Path as it was sent, escaping included.
+    EscapedPath string
+    Query       url.Values
+    Header      http.Header
+    Host        string
+    // RemoteAddr tells apart the connections requests came on.
+    RemoteAddr string
+    Raw        []byte
+    // Body is Raw decoded, when it is a JSON object.
+    Body map[string]interface{}
+}
+
+// action returns the backend action of the request, from the body or the
+// query.
+func (r recordedRequest) action() string {
+    if action, ok := r.Body["action"].(string); ok {
+        return action
+    }
+    return r.Query.Get("action")
+}
+
+// fakeBackend is an httptest backend that keeps the users it is asked to
+// create, and records every request it receives.
+type fakeBackend struct {
+    *httptest.Server
+
+    mu       sync.Mutex
+    requests []recordedRequest
+    users    map[string]map[string]interface{}
+    // respond, when set, answers requests instead of the user store. It
+    // returning false falls back to the user store.
+    respond func(w http.ResponseWriter, req recordedRequest) bool
+}
+
+func newFakeBackend(t *testing.T) *fakeBackend {
+    t.Helper()
+    b := &fakeBackend{users: make(map[string]map[string]interface{})}
+    b.Server = httptest.NewServer(http.HandlerFunc(b.serve))
+    t.Cleanup(b.Close)
+    return b
+}
+
+func (b *fakeBackend) serve(w http.ResponseWriter, r *http.Request) {
+    raw, _ := ioutil.ReadAll(r.Body)
+    req := recordedRequest{
+        Method:      r.Method,
+        Path:        r.URL.Path,
+        EscapedPath: r.URL.EscapedPath(),
+        Query:       r.URL.Query(),
+        Header:      r.Header.Clone(),
+        Host:        r.Host,
+        RemoteAddr:  r.RemoteAddr,
+        Raw:         raw,
+    }
+    json.Unmarshal(raw, &req.Body)
+    b.mu.Lock()
+    b.requests = append(b.requests, req)
+    respond := b.respond
+    b.mu.Unlock()
+    if respond != nil && respond(w, req) {
+        return
+    }
+    writeJSON(w, b.result(req))
+}
+
+// result applies req to the user store and returns the backend's answer.
+func (b *fakeBackend) result(req recordedRequest) map[string]interface{} {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    username, _ := req.Body["username"].(string)
+    switch backendAction(req.action()) {
+    case actionAddUser, actionPrepareUser:
+        b.users[username] = req.Body
+        return map[string]interface{}{"status": 0, "username": username}
+    case actionDelUser, actionAbortUser:
+        delete(b.users, username)
+    case actionBatchDelUser:
+        usernames, _ := req.Body["usernames"].([]interface{})
+        results := make([]interface{}, 0, len(usernames))
+        for _, name := range usernames {
+            name, _ := name.(string)
+            delete(b.users, name)
+            results = append(results, map[string]interface{}{"username": name, "status": 0})
+        }
+        return map[string]interface{}{"status": 0, "results": results}
+    case actionListUsers:
+        users := make([]interface{}, 0, len(b.users))
+        for name, body := range b.users {
+            users = append(users, map[string]interface{}{"username": name, "role": body["role"], "created_at": body["created_at"]})
+        }
+        return map[string]interface{}{"status": 0, "users": users}
+    case actionGetUser:
+        _, exists := b.users[username]
+        return map[string]interface{}{"status": 0, "exists": exists}
+    case actionCapabilities:
+        actions := make([]interface{}, 0, len(actionSpecs))
+        for action := range actionSpecs {
+            actions = append(actions, string(action))
+        }
+        return map[string]interface{}{"status": 0, "actions": actions}
+    case actionWhoAmI:
+        return map[string]interface{}{"status": 0, "scopes": []interface{}{scopeCreate, scopeDelete}}
+    }
+    return map[string]interface{}{"status": 0}
+}
+
+// received returns the requests received so far, optionally only those for
+// action.
+func (b *fakeBackend) received(action backendAction) []recordedRequest {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    var requests []recordedRequest
+    for _, req := range b.requests {
+        if len(action) == 0 || req.action() == string(action) {
+            requests = append(requests, req)
+        }
+    }
+    return requests
+}
+
+// usernames returns the users the backend holds, sorted.
+func (b *fakeBackend) usernames() []string {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    names := make([]string, 0, len(b.users))
+    for name := range b.users {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// has reports whether the backend holds username.
+func (b *fakeBackend) has(username string) bool {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    _, ok := b.users[username]
+    return ok
+}
+
+func (b *fakeBackend) setRespond(respond func(w http.ResponseWriter, req recordedRequest) bool) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.respond = respond
+}
+
+func writeJSON(w http.ResponseWriter, result map[string]interface{}) {
+    w.Header().Set("Content-Type", jsonContentType)
+    json.NewEncoder(w).Encode(result)
+}
+
+// testConfig returns the config the tests initialize the plugin with: config
+// on top of require_tls off, for the plain http test servers.
+func testConfig(config map[string]interface{}) map[string]interface{} {
+    merged := map[string]interface{}{"require_tls": false}
+    for k, v := range config {
+        merged[k] = v
+    }
+    return merged
+}
+
+// setTestEnv points the plugin at backendURL with the test token.
+func setTestEnv(t *testing.T, backendURL string) {
+    t.Helper()
+    t.Setenv(vaultMysqlDb, backendURL)
+    t.Setenv(mysqlToken, testToken)
+    t.Setenv(mysqlRevokeToken, "")
+}
+
+// newTestDB returns a plugin initialized with testConfig(config) against
+// backendURL, and closed when the test ends.
+func newTestDB(t *testing.T, backendURL string, config map[string]interface{}, opts ...Option) *MgtvMysql {
+    t.Helper()
+    setTestEnv(t, backendURL)
+    db := new(opts...)
+    db.logger = hclog.NewNullLogger()
+    _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: testConfig(config)})
+    if err != nil {
+        t.Fatalf("Initialize: %v", err)
+    }
+    t.Cleanup(func() { db.Close() })
+    return db
+}
+
+// initError returns the error of initializing a plugin with testConfig(config)
+// against backendURL.
+func initError(t *testing.T, backendURL string, config map[string]interface{}, opts ...Option) error {
+    t.Helper()
+    setTestEnv(t, backendURL)
+    db := new(opts...)
+    db.logger = hclog.NewNullLogger()
+    defer db.Close()
+    _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: testConfig(config)})
+    return err
+}
+
+func statements(commands ...string) dbplugin.Statements {
+    return dbplugin.Statements{Commands: commands}
+}
+
+// newUser creates a user for role with the given create statement.
+func newUser(db dbplugin.Database, role, statement string) (string, error) {
+    resp, err := db.NewUser(context.Background(), dbplugin.NewUserRequest{
+        UsernameConfig: dbplugin.UsernameMetadata{DisplayName: "token", RoleName: role},
+        Statements:     statements(statement),
+        Password:       "Passw0rd-0123456789",
+    })
+    return resp.Username, err
+}
+
+func deleteUser(db dbplugin.Database, username, statement string) error {
+    _, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{
+        Username:   username,
+        Statements: statements(statement),
+    })
+    return err
+}
+
+// fakeClock is a Clock that only moves when advanced.
+type fakeClock struct {
+    mu      sync.Mutex
+    now     time.Time
+    waiters []fakeTimer
+}
+
+type fakeTimer struct {
+    at time.Time
+    ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+    return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    ch := make(chan time.Time, 1)
+    if d <= 0 {
+        ch <- c.now
+        return ch
+    }
+    c.waiters = append(c.waiters, fakeTimer{at: c.now.Add(d), ch: ch})
+    return ch
+}
+
+// Advance moves the clock by d, firing the timers that became due.
+func (c *fakeClock) Advance(d time.Duration) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.now = c.now.Add(d)
+    pending := c.waiters[:0]
+    for _, w := range c.waiters {
+        if w.at.After(c.now) {
+            pending = append(pending, w)
+            continue
+        }
+        w.ch <- c.now
+    }
+    c.waiters = pending
+}
+
+// waitForTimers blocks until n timers are pending.
+func (c *fakeClock) waitForTimers(t *testing.T, n int) {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        c.mu.Lock()
+        pending := len(c.waiters)
+        c.mu.Unlock()
+        if pending >= n {
+            return
+        }
+        if time.Now().After(deadline) {
+            t.Fatalf("%d timers pending, want %d", pending, n)
+        }
+        time.Sleep(time.Millisecond)
+    }
+}
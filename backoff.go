@@ -0,0 +1,36 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "math/rand"
+    "time"
+)
+
+const (
+    // defaultRetryMinDelay and defaultRetryMaxDelay, in milliseconds, apply
+    // when retry_min_delay and retry_max_delay aren't set.
+    defaultRetryMinDelay = 100
+    defaultRetryMaxDelay = 2000
+)
+
+// backoff returns the pause before retry number attempt, counting from zero.
+// The delay doubles per attempt from min, is jittered down by up to half, and
+// always stays within [min, max].
+func backoff(attempt int, min, max time.Duration) time.Duration {
+    delay := min
+    for i := 0; i < attempt && delay < max; i++ {
+        delay *= 2
+    }
+    if delay > max {
+        delay = max
+    }
+    if half := int64(delay / 2); half > 0 {
+        delay -= time.Duration(rand.Int63n(half + 1))
+    }
+    if delay < min {
+        delay = min
+    }
+    return delay
+}
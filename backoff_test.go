@@ -0,0 +1,82 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestBackoffBounds(t *testing.T) {
+    tests := []struct {
+        name     string
+        min, max time.Duration
+    }{
+        {name: "defaults", min: defaultRetryMinDelay * time.Millisecond, max: defaultRetryMaxDelay * time.Millisecond},
+        {name: "equal", min: 50 * time.Millisecond, max: 50 * time.Millisecond},
+        {name: "zero floor", max: time.Second},
+        {name: "wide", min: time.Millisecond, max: time.Minute},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            for attempt := 0; attempt < 20; attempt++ {
+                for i := 0; i < 100; i++ {
+                    if delay := backoff(attempt, tt.min, tt.max); delay < tt.min || delay > tt.max {
+                        t.Fatalf("backoff(%d) = %v, outside [%v, %v]", attempt, delay, tt.min, tt.max)
+                    }
+                }
+            }
+        })
+    }
+}
+
+func TestBackoffGrows(t *testing.T) {
+    min, max := 100*time.Millisecond, 10*time.Second
+    // Each attempt doubles the delay, which jitter takes at most half off.
+    for attempt := 0; attempt < 6; attempt++ {
+        full := min << attempt
+        floor := full / 2
+        if floor < min {
+            floor = min
+        }
+        for i := 0; i < 100; i++ {
+            if delay := backoff(attempt, min, max); delay < floor || delay > full {
+                t.Fatalf("backoff(%d) = %v, want within [%v, %v]", attempt, delay, floor, full)
+            }
+        }
+    }
+}
+
+func TestRetryDelayConfig(t *testing.T) {
+    tests := []struct {
+        name    string
+        config  map[string]interface{}
+        wantMin int
+        wantMax int
+        wantErr string
+    }{
+        {name: "defaults", wantMin: defaultRetryMinDelay, wantMax: defaultRetryMaxDelay},
+        {name: "configured", config: map[string]interface{}{"retry_min_delay": 10, "retry_max_delay": 500}, wantMin: 10, wantMax: 500},
+        {name: "equal", config: map[string]interface{}{"retry_min_delay": 300, "retry_max_delay": 300}, wantMin: 300, wantMax: 300},
+        {name: "negative min", config: map[string]interface{}{"retry_min_delay": -1}, wantErr: "invalid retry_min_delay -1"},
+        {name: "min above max", config: map[string]interface{}{"retry_min_delay": 500, "retry_max_delay": 10}, wantErr: "invalid retry_max_delay 10: must not be less than retry_min_delay 500"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            if len(tt.wantErr) > 0 {
+                err := initError(t, backend.URL, tt.config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, tt.config)
+            if db.RetryMinDelay != tt.wantMin || db.RetryMaxDelay != tt.wantMax {
+                t.Fatalf("retry delays = [%d, %d], want [%d, %d]", db.RetryMinDelay, db.RetryMaxDelay, tt.wantMin, tt.wantMax)
+            }
+        })
+    }
+}
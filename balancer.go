@@ -0,0 +1,122 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "fmt"
+    "sync"
+    "time"
+)
+
+// defaultBreakerCooldown is how long, in seconds, a tripped backend is skipped
+// when breaker_cooldown isn't set.
+const defaultBreakerCooldown = 30
+
+// errBreakersOpen is reported while the circuit breaker of every backend is
+// open.
+var errBreakersOpen = fmt.Errorf("%w: all backends are unavailable: circuit breakers are open", ErrUnreachable)
+
+// backendURL is a backend_urls entry.
+type backendURL struct {
+    URL    string `json:"url" mapstructure:"url"`
+    Weight int    `json:"weight" mapstructure:"weight"`
+}
+
+// backend is a backend URL's balancing and circuit breaker state.
+type backend struct {
+    url     string
+    weight  int
+    current int
+
+    failures  int
+    openUntil time.Time
+}
+
+// balancer spreads requests across backends by weight using smooth weighted
+// round-robin, skipping backends whose circuit breaker is open. A backend's
+// breaker opens after threshold consecutive failures and stays open for
+// cooldown; a threshold of zero disables it.
+type balancer struct {
+    mu        sync.Mutex
+    backends  []*backend
+    threshold int
+    cooldown  time.Duration
+    clock     Clock
+}
+
+func newBalancer(urls []backendURL, threshold int, cooldown time.Duration, clock Clock) *balancer {
+    b := &balancer{
+        threshold: threshold,
+        cooldown:  cooldown,
+        clock:     clock,
+    }
+    for _, u := range urls {
+        b.backends = append(b.backends, &backend{url: u.URL, weight: u.Weight})
+    }
+    return b
+}
+
+// pick returns the next backend to send a request to.
+func (b *balancer) pick() (*backend, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    now := b.clock.Now()
+    var chosen *backend
+    total := 0
+    for _, be := range b.backends {
+        if now.Before(be.openUntil) {
+            continue
+        }
+        be.current += be.weight
+        total += be.weight
+        if chosen == nil || be.current > chosen.current {
+            chosen = be
+        }
+    }
+    if chosen == nil {
+        return nil, errBreakersOpen
+    }
+    chosen.current -= total
+    return chosen, nil
+}
+
+// available reports whether a backend's circuit breaker is closed.
+func (b *balancer) available() bool {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    now := b.clock.Now()
+    for _, be := range b.backends {
+        if !now.Before(be.openUntil) {
+            return true
+        }
+    }
+    return false
+}
+
+// report records the outcome of a request sent to be.
+func (b *balancer) report(be *backend, ok bool) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if ok {
+        be.failures = 0
+        return
+    }
+    be.failures++
+    if b.threshold > 0 && be.failures >= b.threshold {
+        be.openUntil = b.clock.Now().Add(b.cooldown)
+        be.failures = 0
+    }
+}
+
+// urls returns every backend URL.
+func (b *balancer) urls() []string {
+    urls := make([]string, 0, len(b.backends))
+    for _, be := range b.backends {
+        urls = append(urls, be.url)
+    }
+    return urls
+}
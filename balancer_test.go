@@ -0,0 +1,114 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "errors"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func TestWeightedBackends(t *testing.T) {
+    tests := []struct {
+        name    string
+        weights []int
+    }{
+        {name: "equal", weights: []int{1, 1}},
+        {name: "weighted", weights: []int{1, 2, 3}},
+        {name: "single", weights: []int{4}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backends := make([]*fakeBackend, len(tt.weights))
+            urls := make([]interface{}, len(tt.weights))
+            total := 0
+            for i, weight := range tt.weights {
+                backends[i] = newFakeBackend(t)
+                urls[i] = map[string]interface{}{"url": backends[i].URL, "weight": weight}
+                total += weight
+            }
+            db := newTestDB(t, backends[0].URL, map[string]interface{}{"backend_urls": urls})
+
+            // Smooth weighted round-robin is exact over whole rounds.
+            rounds := 10
+            for i := 0; i < rounds*total; i++ {
+                if err := deleteUser(db, "V_USER_R", testDeleteStatement); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            for i, weight := range tt.weights {
+                if got := len(backends[i].received(actionDelUser)); got != rounds*weight {
+                    t.Errorf("backend %d of weight %d got %d deletes, want %d", i, weight, got, rounds*weight)
+                }
+            }
+        })
+    }
+}
+
+func TestBackendBreaker(t *testing.T) {
+    healthy, failing := newFakeBackend(t), newFakeBackend(t)
+    failing.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+        w.WriteHeader(http.StatusInternalServerError)
+        return true
+    })
+    clock := newFakeClock()
+    db := newTestDB(t, healthy.URL, map[string]interface{}{
+        "backend_urls": []interface{}{
+            map[string]interface{}{"url": healthy.URL, "weight": 1},
+            map[string]interface{}{"url": failing.URL, "weight": 1},
+        },
+        "breaker_threshold": 2,
+        "breaker_cooldown":  60,
+    }, WithClock(clock))
+    deletes := func(n int) (failed int) {
+        t.Helper()
+        for i := 0; i < n; i++ {
+            if deleteUser(db, "V_USER_R", testDeleteStatement) != nil {
+                failed++
+            }
+        }
+        return failed
+    }
+
+    // Alternating between the two, the failing backend trips after its
+    // second failure.
+    if failed := deletes(4); failed != 2 {
+        t.Fatalf("%d of the deletes before the breaker tripped failed, want 2", failed)
+    }
+    if failed := deletes(5); failed != 0 {
+        t.Fatalf("%d deletes failed while the failing backend was tripped, want none", failed)
+    }
+    if got := len(failing.received(actionDelUser)); got != 2 {
+        t.Fatalf("tripped backend got %d deletes, want 2", got)
+    }
+
+    // Once the cooldown elapsed the failing backend is tried again.
+    clock.Advance(time.Minute)
+    if failed := deletes(2); failed != 1 {
+        t.Fatalf("%d of the deletes after the cooldown failed, want 1", failed)
+    }
+}
+
+func TestBackendBreakersOpen(t *testing.T) {
+    failing := newFakeBackend(t)
+    failing.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+        w.WriteHeader(http.StatusServiceUnavailable)
+        return true
+    })
+    db := newTestDB(t, failing.URL, map[string]interface{}{
+        "backend_urls":      []interface{}{map[string]interface{}{"url": failing.URL, "weight": 1}},
+        "breaker_threshold": 1,
+    })
+    if err := deleteUser(db, "V_USER_R", testDeleteStatement); err == nil {
+        t.Fatal("DeleteUser succeeded against a failing backend")
+    }
+    err := deleteUser(db, "V_USER_R", testDeleteStatement)
+    if !errors.Is(err, ErrUnreachable) {
+        t.Fatalf("DeleteUser error = %v, want ErrUnreachable while every breaker is open", err)
+    }
+    if got := len(failing.received(actionDelUser)); got != 1 {
+        t.Fatalf("%d deletes sent, want only the one tripping the breaker", got)
+    }
+}
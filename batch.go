@@ -0,0 +1,186 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// BatchItemResult is the outcome of a batch operation for a single username.
+type BatchItemResult struct {
+    Username string
+    // Err is nil when the backend reported success for Username.
+    Err error
+}
+
+// BatchResult holds the per-username outcome of a batch operation so that
+// callers can retry only the failed items.
+type BatchResult struct {
+    Items []BatchItemResult
+}
+
+// Failed returns the usernames the operation failed for.
+func (r BatchResult) Failed() []string {
+    var failed []string
+    for _, item := range r.Items {
+        if item.Err != nil {
+            failed = append(failed, item.Username)
+        }
+    }
+    return failed
+}
+
+// Err aggregates the failed items into a *BatchError, or returns nil when
+// every item succeeded.
+func (r BatchResult) Err() error {
+    var errs []error
+    for _, item := range r.Items {
+        if item.Err != nil {
+            errs = append(errs, item.Err)
+        }
+    }
+    if len(errs) == 0 {
+        return nil
+    }
+    return &BatchError{Errors: errs}
+}
+
+// BatchItemError is the failure of a batch operation for a single username.
+// Err is the error the item failed with, when it didn't fail on a result the
+// backend reported.
+type BatchItemError struct {
+    Username string
+    Message  string
+    Err      error
+}
+
+// itemError returns the BatchItemError of username failing with err.
+func itemError(username string, err error) *BatchItemError {
+    return &BatchItemError{Username: username, Message: err.Error(), Err: err}
+}
+
+func (e *BatchItemError) Error() string {
+    return fmt.Sprintf("user %s: %s", e.Username, e.Message)
+}
+
+func (e *BatchItemError) Unwrap() error {
+    return e.Err
+}
+
+// BatchError aggregates the failures of a batch operation.
+type BatchError struct {
+    Errors []error
+}
+
+func (e *BatchError) Error() string {
+    msgs := make([]string, 0, len(e.Errors))
+    for _, err := range e.Errors {
+        msgs = append(msgs, err.Error())
+    }
+    return fmt.Sprintf("%d batch items failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+func (e *BatchError) Unwrap() []error {
+    return e.Errors
+}
+
+// Is and As check every failure, as errors.Is and errors.As only follow
+// multiple errors from Go 1.20 on.
+func (e *BatchError) Is(target error) bool {
+    for _, err := range e.Errors {
+        if errors.Is(err, target) {
+            return true
+        }
+    }
+    return false
+}
+
+func (e *BatchError) As(target interface{}) bool {
+    for _, err := range e.Errors {
+        if errors.As(err, target) {
+            return true
+        }
+    }
+    return false
+}
+
+// parseBatchResult maps the backend's per-item results onto usernames. A
+// username the backend didn't report on is considered failed.
+func parseBatchResult(usernames []string, result map[string]interface{}) BatchResult {
+    reported := make(map[string]error, len(usernames))
+    items, _ := result["results"].([]interface{})
+    for _, raw := range items {
+        item, ok := raw.(map[string]interface{})
+        if !ok {
+            continue
+        }
+        username := resultString(item, "username")
+        if status, ok := item["status"].(float64); ok && status == 0 {
+            reported[username] = nil
+            continue
+        }
+        message := resultString(item, "error")
+        if len(message) == 0 {
+            message = "backend reported failure"
+        }
+        reported[username] = &BatchItemError{Username: username, Message: message}
+    }
+
+    var batch BatchResult
+    for _, username := range usernames {
+        err, ok := reported[username]
+        if !ok {
+            err = &BatchItemError{Username: username, Message: "no result reported"}
+        }
+        batch.Items = append(batch.Items, BatchItemResult{Username: username, Err: err})
+    }
+    return batch
+}
+
+// DeleteUsers revokes several users with a single backend call. statements
+// are handled the same way as revocation statements. The returned BatchResult
+// reports the outcome per username, and the error is its aggregate.
+func (c *MgtvMysql) DeleteUsers(ctx context.Context, usernames []string, statements dbplugin.Statements) (_ BatchResult, err error) {
+    defer func() { err = c.redactError(err) }()
+
+    c.Lock()
+    defer c.Unlock()
+
+    if len(usernames) == 0 {
+        return BatchResult{}, errors.New("no usernames to delete")
+    }
+    if len(statements.Commands) == 0 {
+        return BatchResult{}, errors.New("batch revocation failed, Revocation Statements is empty")
+    }
+    statement := make(map[string]interface{})
+    err = json.Unmarshal([]byte(statements.Commands[0]), &statement)
+    if err != nil {
+        return BatchResult{}, err
+    }
+    body, err := c.buildRequest(ctx, actionBatchDelUser, statement, map[string]interface{}{"usernames": usernames})
+    if err != nil {
+        return BatchResult{}, err
+    }
+    result, err := c.invoke(ctx, actionBatchDelUser, body)
+    for _, username := range usernames {
+        c.invalidateUser(username)
+    }
+    if _, ok := result["results"]; err != nil && !ok {
+        return BatchResult{}, fmt.Errorf("batch delete users failed: %w", err)
+    }
+    batch := parseBatchResult(usernames, result)
+    for _, item := range batch.Items {
+        if item.Err == nil {
+            c.forgetConnectionDetails(item.Username)
+            c.emitEvent(ctx, EventCredentialDelete, item.Username, nil)
+        }
+    }
+    return batch, batch.Err()
+}
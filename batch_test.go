@@ -0,0 +1,141 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestDeleteUsers(t *testing.T) {
+    usernames := []string{"V_A_R", "V_B_R", "V_C_R"}
+    tests := []struct {
+        name string
+        // results are the per-item results the backend reports, none when nil.
+        results []interface{}
+        status  int
+        // wantFailed maps the usernames expected to fail to their message.
+        wantFailed map[string]string
+        wantErr    string
+    }{
+        {
+            name: "all deleted",
+            results: []interface{}{
+                map[string]interface{}{"username": "V_A_R", "status": 0},
+                map[string]interface{}{"username": "V_B_R", "status": 0},
+                map[string]interface{}{"username": "V_C_R", "status": 0},
+            },
+        },
+        {
+            name:   "partial failure",
+            status: 1,
+            results: []interface{}{
+                map[string]interface{}{"username": "V_A_R", "status": 0},
+                map[string]interface{}{"username": "V_B_R", "status": 1, "error": "locked"},
+                map[string]interface{}{"username": "V_C_R", "status": 1},
+            },
+            wantFailed: map[string]string{"V_B_R": "locked", "V_C_R": "backend reported failure"},
+        },
+        {
+            name: "unreported",
+            results: []interface{}{
+                map[string]interface{}{"username": "V_A_R", "status": 0},
+            },
+            wantFailed: map[string]string{"V_B_R": "no result reported", "V_C_R": "no result reported"},
+        },
+        {name: "failed without results", status: 1, wantErr: "batch delete users failed"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, nil)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(actionBatchDelUser) {
+                    return false
+                }
+                result := map[string]interface{}{"status": tt.status, "error": "some failed"}
+                if tt.results != nil {
+                    result["results"] = tt.results
+                }
+                writeJSON(w, result)
+                return true
+            })
+
+            batch, err := db.DeleteUsers(context.Background(), usernames, statements(testDeleteStatement))
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("DeleteUsers error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            sent := backend.received(actionBatchDelUser)
+            if len(sent) != 1 || len(sent[0].Body["usernames"].([]interface{})) != len(usernames) {
+                t.Fatalf("sent %v, want one call carrying every username", sent)
+            }
+            if len(batch.Items) != len(usernames) {
+                t.Fatalf("%d items, want %d", len(batch.Items), len(usernames))
+            }
+            for _, item := range batch.Items {
+                message, wantFail := tt.wantFailed[item.Username]
+                var itemErr *BatchItemError
+                switch {
+                case !wantFail && item.Err != nil:
+                    t.Errorf("%s: %v", item.Username, item.Err)
+                case wantFail && (!errors.As(item.Err, &itemErr) || itemErr.Message != message):
+                    t.Errorf("%s: error %v, want %q", item.Username, item.Err, message)
+                }
+            }
+            if len(batch.Failed()) != len(tt.wantFailed) {
+                t.Errorf("Failed() = %v, want %d", batch.Failed(), len(tt.wantFailed))
+            }
+            if len(tt.wantFailed) == 0 {
+                if err != nil {
+                    t.Fatalf("DeleteUsers: %v", err)
+                }
+                return
+            }
+            var batchErr *BatchError
+            if !errors.As(err, &batchErr) || len(batchErr.Errors) != len(tt.wantFailed) {
+                t.Fatalf("error = %v, want a *BatchError of %d failures", err, len(tt.wantFailed))
+            }
+            for _, item := range batch.Items {
+                if _, failed := tt.wantFailed[item.Username]; failed && !errors.Is(err, item.Err) {
+                    t.Errorf("errors.Is(aggregate error, %s's failure) = false", item.Username)
+                }
+            }
+            var itemErr *BatchItemError
+            if !errors.As(err, &itemErr) || len(tt.wantFailed[itemErr.Username]) == 0 {
+                t.Errorf("errors.As(aggregate error, *BatchItemError) = %v, want one of the failures", itemErr)
+            }
+        })
+    }
+}
+
+func TestDeleteUsersInvalid(t *testing.T) {
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, nil)
+    tests := []struct {
+        name       string
+        usernames  []string
+        statements []string
+        wantErr    string
+    }{
+        {name: "no usernames", statements: []string{testDeleteStatement}, wantErr: "no usernames to delete"},
+        {name: "no statements", usernames: []string{"V_A_R"}, wantErr: "Revocation Statements is empty"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := db.DeleteUsers(context.Background(), tt.usernames, statements(tt.statements...))
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Fatalf("DeleteUsers error = %v, want %q", err, tt.wantErr)
+            }
+        })
+    }
+    if n := len(backend.received(actionBatchDelUser)); n != 0 {
+        t.Fatalf("%s sent %d times, want none", actionBatchDelUser, n)
+    }
+}
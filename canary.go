@@ -0,0 +1,72 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "strings"
+
+    "github.com/hashicorp/vault/sdk/database/helper/credsutil"
+)
+
+// canaryPrefix marks the throwaway accounts created by init_canary.
+const canaryPrefix = "V_CANARY_"
+
+// runCanary proves the create and delete cycle works by creating a throwaway
+// account and deleting it again. The delete is attempted even when the create
+// failed, as the account may exist regardless.
+func (c *mgtvMysqlConnectionProducer) runCanary(ctx context.Context) error {
+    statement := make(map[string]interface{})
+    if len(c.InitCanaryStatement) > 0 {
+        if err := json.Unmarshal([]byte(c.InitCanaryStatement), &statement); err != nil {
+            return fmt.Errorf("invalid init_canary_statement: %w", err)
+        }
+    }
+    if err := c.applyEngine(statement); err != nil {
+        return err
+    }
+    c.applyDefaultIPList(statement)
+    random, err := credsutil.RandomAlphaNumeric(10, false)
+    if err != nil {
+        return fmt.Errorf("failed to generate canary username: %w", err)
+    }
+    username := canaryPrefix + strings.ToUpper(random[:4]) + "_" + PrivReadOnly.suffix()
+    password, err := credsutil.RandomAlphaNumeric(passwordLength, true)
+    if err != nil {
+        return fmt.Errorf("failed to generate canary password: %w", err)
+    }
+
+    c.logger.Info("running init canary", "username", c.logName(username))
+    createErr := c.canaryCreate(ctx, statement, username, c.hashPassword(password))
+    deleteErr := c.canaryCall(ctx, actionDelUser, statement, map[string]interface{}{"username": username})
+    if createErr != nil {
+        return c.redactErrorLocked(fmt.Errorf("init canary create of %s failed: %w", username, createErr), password)
+    }
+    if deleteErr != nil {
+        return c.redactErrorLocked(fmt.Errorf("init canary delete of %s failed, it may need to be removed manually: %w", username, deleteErr))
+    }
+    return nil
+}
+
+// canaryCreate creates the canary the way NewUser creates users, in two phases
+// with two_phase_create.
+func (c *mgtvMysqlConnectionProducer) canaryCreate(ctx context.Context, statement map[string]interface{}, username, password string) error {
+    fields := map[string]interface{}{"username": username, "password": password}
+    if !c.TwoPhaseCreate {
+        return c.canaryCall(ctx, actionAddUser, statement, fields)
+    }
+    _, err := c.finishTwoPhase(ctx, username, statement, c.canaryCall(ctx, actionPrepareUser, statement, fields))
+    return err
+}
+
+func (c *mgtvMysqlConnectionProducer) canaryCall(ctx context.Context, action backendAction, statement, fields map[string]interface{}) error {
+    body, err := c.buildRequest(ctx, action, statement, fields)
+    if err != nil {
+        return err
+    }
+    _, err = c.invoke(ctx, action, body)
+    return err
+}
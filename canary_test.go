@@ -0,0 +1,97 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestInitCanary(t *testing.T) {
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // failing is the action the backend rejects.
+        failing     backendAction
+        wantActions []backendAction
+        wantErr     string
+    }{
+        {name: "disabled", config: map[string]interface{}{"init_canary": false}},
+        {name: "create and delete", config: map[string]interface{}{"init_canary": true}, wantActions: []backendAction{actionAddUser, actionDelUser}},
+        {
+            name:        "two phase",
+            config:      map[string]interface{}{"init_canary": true, "two_phase_create": true},
+            wantActions: []backendAction{actionPrepareUser, actionCommitUser, actionDelUser},
+        },
+        {
+            name:        "create fails, still deleted",
+            config:      map[string]interface{}{"init_canary": true},
+            failing:     actionAddUser,
+            wantActions: []backendAction{actionAddUser, actionDelUser},
+            wantErr:     "init canary create of " + canaryPrefix,
+        },
+        {
+            name:        "delete fails",
+            config:      map[string]interface{}{"init_canary": true},
+            failing:     actionDelUser,
+            wantActions: []backendAction{actionAddUser, actionDelUser},
+            wantErr:     "it may need to be removed manually",
+        },
+        {name: "invalid statement", config: map[string]interface{}{"init_canary": true, "init_canary_statement": `{"cid":`}, wantErr: "invalid init_canary_statement"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(tt.failing) {
+                    return false
+                }
+                writeJSON(w, map[string]interface{}{"status": 1, "error": "denied"})
+                return true
+            })
+            config := map[string]interface{}{"init_canary_statement": `{"cid":"c1","dbname":"d1"}`}
+            for k, v := range tt.config {
+                config[k] = v
+            }
+            err := initError(t, backend.URL, config)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+            } else if err != nil {
+                t.Fatalf("Initialize: %v", err)
+            }
+
+            var actions []backendAction
+            var username interface{}
+            for _, req := range backend.received("") {
+                if req.Method != http.MethodPost {
+                    continue
+                }
+                actions = append(actions, backendAction(req.action()))
+                if username == nil {
+                    username = req.Body["username"]
+                }
+                if req.Body["username"] != username || req.Body["cid"] != "c1" {
+                    t.Errorf("%s sent %v, want username %v and cid c1", req.action(), req.Body, username)
+                }
+            }
+            if len(actions) != len(tt.wantActions) {
+                t.Fatalf("canary sent %v, want %v", actions, tt.wantActions)
+            }
+            for i := range actions {
+                if actions[i] != tt.wantActions[i] {
+                    t.Fatalf("canary sent %v, want %v", actions, tt.wantActions)
+                }
+            }
+            if name, _ := username.(string); len(actions) > 0 && !strings.HasPrefix(name, canaryPrefix) {
+                t.Errorf("canary named %q, want the %s prefix", name, canaryPrefix)
+            }
+            if len(tt.failing) == 0 && len(backend.usernames()) != 0 {
+                t.Errorf("canary left %v behind", backend.usernames())
+            }
+        })
+    }
+}
@@ -0,0 +1,104 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "sync"
+)
+
+// capabilityCache holds the actions the backend reported supporting, and the
+// ones calls found to be unsupported. It is reset by Init.
+type capabilityCache struct {
+    mu          sync.Mutex
+    actions     map[backendAction]bool
+    unsupported map[backendAction]bool
+}
+
+func (k *capabilityCache) reset() {
+    k.mu.Lock()
+    defer k.mu.Unlock()
+    k.actions = nil
+    k.unsupported = nil
+}
+
+func (k *capabilityCache) markUnsupported(action backendAction) {
+    k.mu.Lock()
+    defer k.mu.Unlock()
+    if k.unsupported == nil {
+        k.unsupported = make(map[backendAction]bool)
+    }
+    k.unsupported[action] = true
+}
+
+func (k *capabilityCache) isUnsupported(action backendAction) bool {
+    k.mu.Lock()
+    defer k.mu.Unlock()
+    return k.unsupported[action]
+}
+
+// Capabilities returns the actions the backend supports, as reported by its
+// Capabilities action. The result is fetched once and cached until the plugin
+// is initialized again.
+func (c *MgtvMysql) Capabilities(ctx context.Context) ([]string, error) {
+    c.RLock()
+    defer c.RUnlock()
+
+    actions, err := c.capabilities(ctx)
+    if err != nil {
+        return nil, err
+    }
+    supported := make([]string, 0, len(actions))
+    for action := range actions {
+        supported = append(supported, string(action))
+    }
+    sort.Strings(supported)
+    return supported, nil
+}
+
+// capabilities returns the cached capabilities, fetching them first if need
+// be. It must be called with the lock held, for reading at least.
+func (c *mgtvMysqlConnectionProducer) capabilities(ctx context.Context) (map[backendAction]bool, error) {
+    c.caps.mu.Lock()
+    defer c.caps.mu.Unlock()
+    if c.caps.actions != nil {
+        return c.caps.actions, nil
+    }
+    body, err := c.buildRequest(ctx, actionCapabilities, nil, nil)
+    if err != nil {
+        return nil, err
+    }
+    result, err := c.invoke(ctx, actionCapabilities, body)
+    if err != nil {
+        return nil, fmt.Errorf("get capabilities failed: %w", err)
+    }
+    reported, _ := result["actions"].([]interface{})
+    actions := make(map[backendAction]bool, len(reported))
+    for _, raw := range reported {
+        if action, ok := raw.(string); ok {
+            actions[backendAction(action)] = true
+        }
+    }
+    c.caps.actions = actions
+    return actions, nil
+}
+
+// requireCapability fails when check_capabilities is set and the backend
+// didn't report supporting action, so that unsupported features fail clearly
+// before anything is sent.
+func (c *mgtvMysqlConnectionProducer) requireCapability(ctx context.Context, action backendAction) error {
+    if !c.CheckCapabilities || action == actionCapabilities {
+        return nil
+    }
+    actions, err := c.capabilities(ctx)
+    if err != nil {
+        return err
+    }
+    if !actions[action] {
+        return fmt.Errorf("%w: %s is not among the capabilities the backend reported", errUnsupportedAction, action)
+    }
+    return nil
+}
@@ -0,0 +1,130 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strings"
+    "testing"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// reportCapabilities returns a respond func answering Capabilities with
+// actions.
+func reportCapabilities(actions ...backendAction) func(w http.ResponseWriter, req recordedRequest) bool {
+    return func(w http.ResponseWriter, req recordedRequest) bool {
+        if req.action() != string(actionCapabilities) {
+            return false
+        }
+        reported := make([]interface{}, 0, len(actions))
+        for _, action := range actions {
+            reported = append(reported, string(action))
+        }
+        writeJSON(w, map[string]interface{}{"status": 0, "actions": reported})
+        return true
+    }
+}
+
+func TestCapabilitiesCached(t *testing.T) {
+    backend := newFakeBackend(t)
+    backend.setRespond(reportCapabilities(actionDelUser, actionAddUser))
+    db := newTestDB(t, backend.URL, nil)
+
+    for i := 0; i < 2; i++ {
+        got, err := db.Capabilities(context.Background())
+        if err != nil {
+            t.Fatal(err)
+        }
+        if strings.Join(got, ",") != "AddUser,VaultDelUser" {
+            t.Fatalf("Capabilities = %v, want AddUser and VaultDelUser", got)
+        }
+    }
+    if n := len(backend.received(actionCapabilities)); n != 1 {
+        t.Fatalf("capabilities fetched %d times, want once", n)
+    }
+
+    if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: testConfig(nil)}); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := db.Capabilities(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    if n := len(backend.received(actionCapabilities)); n != 2 {
+        t.Fatalf("capabilities fetched %d times after re-Init, want twice", n)
+    }
+}
+
+func TestCheckCapabilities(t *testing.T) {
+    tests := []struct {
+        name     string
+        check    bool
+        reported []backendAction
+        // failing makes the Capabilities call fail.
+        failing bool
+        wantErr string
+    }{
+        {name: "supported", check: true, reported: []backendAction{actionAddUser, actionChangePassword}},
+        {
+            name:     "unsupported",
+            check:    true,
+            reported: []backendAction{actionAddUser},
+            wantErr:  "ChangePassword is not among the capabilities the backend reported",
+        },
+        {name: "not checked", reported: []backendAction{actionAddUser}},
+        {name: "capabilities unavailable", check: true, failing: true, wantErr: "get capabilities failed"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            report := reportCapabilities(tt.reported...)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if tt.failing && req.action() == string(actionCapabilities) {
+                    w.WriteHeader(http.StatusInternalServerError)
+                    return true
+                }
+                return report(w, req)
+            })
+            db := newTestDB(t, backend.URL, map[string]interface{}{"check_capabilities": tt.check})
+
+            for i := 0; i < 2; i++ {
+                _, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+                    Username: "V_USER_R",
+                    Password: &dbplugin.ChangePassword{NewPassword: "Passw0rd-0123456789", Statements: statements(testDeleteStatement)},
+                })
+                if len(tt.wantErr) == 0 {
+                    if err != nil {
+                        t.Fatal(err)
+                    }
+                    continue
+                }
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("UpdateUser error = %v, want %q", err, tt.wantErr)
+                }
+                if !tt.failing && !errors.Is(err, errUnsupportedAction) {
+                    t.Fatalf("UpdateUser error %q isn't errUnsupportedAction", err)
+                }
+            }
+            wantSent := 2
+            if len(tt.wantErr) > 0 {
+                wantSent = 0
+            }
+            if sent := len(backend.received(actionChangePassword)); sent != wantSent {
+                t.Errorf("ChangePassword sent %d times, want %d", sent, wantSent)
+            }
+            wantFetched := 0
+            switch {
+            case tt.failing:
+                wantFetched = 2
+            case tt.check:
+                wantFetched = 1
+            }
+            if n := len(backend.received(actionCapabilities)); n != wantFetched {
+                t.Errorf("capabilities fetched %d times, want %d", n, wantFetched)
+            }
+        })
+    }
+}
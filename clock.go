@@ -0,0 +1,24 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import "time"
+
+// Clock is the source of time for everything time dependent in the plugin,
+// such as cache expiry and backoff, so that it can be controlled in tests.
+type Clock interface {
+    Now() time.Time
+    After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the default Clock, backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+    return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+    return time.After(d)
+}
@@ -0,0 +1,78 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "time"
+)
+
+// What Initialize does when the backend clock is off by more than
+// max_clock_skew.
+const (
+    clockSkewWarn = "warn"
+    clockSkewFail = "fail"
+)
+
+// defaultClockSkewHeader is the response header the backend time is read from
+// unless clock_skew_header names another. A header other than Date may carry
+// RFC 3339 time as well.
+const defaultClockSkewHeader = "Date"
+
+// checkClockSkew compares the time the backend reports in clock_skew_header,
+// on a request to health_path or else connection_url, with the local time. It
+// fails on skew beyond max_clock_skew, which makes expiry forwarded to the
+// backend take effect early or late.
+func (c *mgtvMysqlConnectionProducer) checkClockSkew(ctx context.Context) error {
+    base, err := parseBackendURL(c.backendURLs()[0])
+    if err != nil {
+        return fmt.Errorf("invalid connection_url: %w", err)
+    }
+    if len(c.HealthPath) > 0 {
+        joinPath(base, c.HealthPath, (&url.URL{Path: c.HealthPath}).EscapedPath())
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, base.String(), nil)
+    if err != nil {
+        return err
+    }
+    if isSocketHost(req.URL.Hostname()) {
+        req.Host = socketHostHeader
+    }
+    sent := c.clock.Now()
+    response, err := c.client().Do(req)
+    if err != nil {
+        return fmt.Errorf("clock skew check failed: %w", unreachable(err))
+    }
+    defer response.Body.Close()
+    io.Copy(ioutil.Discard, response.Body)
+    received := c.clock.Now()
+
+    value := response.Header.Get(c.ClockSkewHeader)
+    if len(value) == 0 {
+        return fmt.Errorf("clock skew check failed: the response has no %s header", c.ClockSkewHeader)
+    }
+    backendTime, err := http.ParseTime(value)
+    if err != nil {
+        backendTime, err = time.Parse(time.RFC3339, value)
+    }
+    if err != nil {
+        return fmt.Errorf("clock skew check failed: invalid %s %q", c.ClockSkewHeader, value)
+    }
+    // The backend read its clock somewhere during the round trip.
+    local := sent.Add(received.Sub(sent) / 2)
+    skew := backendTime.Sub(local)
+    if skew < 0 {
+        skew = -skew
+    }
+    // Date has a resolution of a second.
+    if skew <= c.MaxClockSkew*time.Second+time.Second {
+        return nil
+    }
+    return fmt.Errorf("backend clock is off by %s, more than max_clock_skew %ds", skew.Round(time.Second), c.MaxClockSkew)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "bytes"
+    "context"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestClockSkew(t *testing.T) {
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // The backend reports its time in header, as value returns it from
+        // the local time. Nothing is reported when value is nil.
+        header   string
+        value    func(now time.Time) string
+        wantErr  string
+        wantWarn string
+        // wantChecked is whether the backend time was asked for.
+        wantChecked bool
+    }{
+        {
+            name:        "within threshold",
+            config:      map[string]interface{}{"max_clock_skew": 5, "clock_skew_action": clockSkewFail},
+            header:      "Date",
+            value:       func(now time.Time) string { return now.Add(3 * time.Second).Format(http.TimeFormat) },
+            wantChecked: true,
+        },
+        {
+            name:        "ahead, failing",
+            config:      map[string]interface{}{"max_clock_skew": 5, "clock_skew_action": clockSkewFail},
+            header:      "Date",
+            value:       func(now time.Time) string { return now.Add(10 * time.Minute).Format(http.TimeFormat) },
+            wantErr:     "backend clock is off by 10m0s, more than max_clock_skew 5s",
+            wantChecked: true,
+        },
+        {
+            name:        "behind, failing",
+            config:      map[string]interface{}{"max_clock_skew": 5, "clock_skew_action": clockSkewFail},
+            header:      "Date",
+            value:       func(now time.Time) string { return now.Add(-time.Minute).Format(http.TimeFormat) },
+            wantErr:     "backend clock is off by 1m0s",
+            wantChecked: true,
+        },
+        {
+            name:        "excessive, warning",
+            config:      map[string]interface{}{"max_clock_skew": 5},
+            header:      "Date",
+            value:       func(now time.Time) string { return now.Add(10 * time.Minute).Format(http.TimeFormat) },
+            wantWarn:    "backend clock is off by 10m0s",
+            wantChecked: true,
+        },
+        {
+            name:        "custom header",
+            config:      map[string]interface{}{"max_clock_skew": 5, "clock_skew_header": "X-Backend-Time", "clock_skew_action": clockSkewFail},
+            header:      "X-Backend-Time",
+            value:       func(now time.Time) string { return now.Add(-2 * time.Second).Format(time.RFC3339) },
+            wantChecked: true,
+        },
+        {
+            name:        "missing header",
+            config:      map[string]interface{}{"max_clock_skew": 5, "clock_skew_header": "X-Backend-Time", "clock_skew_action": clockSkewFail},
+            wantErr:     "the response has no X-Backend-Time header",
+            wantChecked: true,
+        },
+        {
+            name:        "invalid header",
+            config:      map[string]interface{}{"max_clock_skew": 5, "clock_skew_header": "X-Backend-Time", "clock_skew_action": clockSkewFail},
+            header:      "X-Backend-Time",
+            value:       func(time.Time) string { return "yesterday" },
+            wantErr:     `invalid X-Backend-Time "yesterday"`,
+            wantChecked: true,
+        },
+        {
+            name:   "disabled",
+            header: "Date",
+            value:  func(now time.Time) string { return now.Add(time.Hour).Format(http.TimeFormat) },
+        },
+        {name: "invalid action", config: map[string]interface{}{"max_clock_skew": 5, "clock_skew_action": "ignore"}, wantErr: `invalid clock_skew_action "ignore"`},
+        {name: "negative", config: map[string]interface{}{"max_clock_skew": -1}, wantErr: "invalid max_clock_skew -1"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            clock := newFakeClock()
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.Method != http.MethodGet || tt.value == nil {
+                    return false
+                }
+                w.Header().Set(tt.header, tt.value(clock.Now()))
+                return false
+            })
+            setTestEnv(t, backend.URL)
+            db := new(WithClock(clock))
+            var logs bytes.Buffer
+            db.logger = hclog.New(&hclog.LoggerOptions{Output: &logs})
+            defer db.Close()
+            _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: testConfig(tt.config)})
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+            } else if err != nil {
+                t.Fatalf("Initialize: %v", err)
+            }
+            if len(tt.wantWarn) > 0 && !strings.Contains(logs.String(), tt.wantWarn) {
+                t.Errorf("skew not warned about:\n%s", logs.String())
+            }
+            var checked bool
+            for _, req := range backend.received("") {
+                checked = checked || req.Method == http.MethodGet
+            }
+            if checked != tt.wantChecked {
+                t.Errorf("backend time asked for: %v, want %v", checked, tt.wantChecked)
+            }
+        })
+    }
+}
@@ -0,0 +1,93 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/http"
+    "strconv"
+    "sync"
+    "testing"
+    "time"
+)
+
+// TestClockTimestamps checks the timestamps the plugin sends come from the
+// injected clock.
+func TestClockTimestamps(t *testing.T) {
+    clock := newFakeClock()
+    clock.Advance(90 * time.Minute)
+    tests := []struct {
+        name string
+        sent func(req recordedRequest) string
+        want string
+    }{
+        {
+            name: "created_at",
+            sent: func(req recordedRequest) string { s, _ := req.Body["created_at"].(string); return s },
+            want: clock.Now().UTC().Format(createdAtLayout),
+        },
+        {
+            name: "replay timestamp",
+            sent: func(req recordedRequest) string { return req.Header.Get(timestampHeader) },
+            want: strconv.FormatInt(clock.Now().Unix(), 10),
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, map[string]interface{}{"replay_protection": true}, WithClock(clock))
+            if _, err := newUser(db, "role", testCreateStatement); err != nil {
+                t.Fatal(err)
+            }
+            if got := tt.sent(backend.received(actionAddUser)[0]); got != tt.want {
+                t.Fatalf("%s sent as %q, want %q", tt.name, got, tt.want)
+            }
+        })
+    }
+}
+
+// TestClockBackoff checks the token refresh backoff waits on the injected
+// clock: with a minute long retry_min_delay, the delete only finishes in time
+// once the fake clock is advanced.
+func TestClockBackoff(t *testing.T) {
+    backend := newFakeBackend(t)
+    var mu sync.Mutex
+    rejected := 0
+    backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+        mu.Lock()
+        defer mu.Unlock()
+        if req.action() != string(actionDelUser) || rejected == 2 {
+            return false
+        }
+        rejected++
+        w.WriteHeader(http.StatusUnauthorized)
+        return true
+    })
+    clock := newFakeClock()
+    db := newTestDB(t, backend.URL, map[string]interface{}{
+        "token_refresh_retries": 2,
+        "retry_min_delay":       60000,
+        "retry_max_delay":       60000,
+    }, WithClock(clock))
+
+    done := make(chan error, 1)
+    go func() { done <- deleteUser(db, "V_USER_R", testDeleteStatement) }()
+    clock.waitForTimers(t, 1)
+    select {
+    case err := <-done:
+        t.Fatalf("DeleteUser returned before the backoff elapsed: %v", err)
+    default:
+    }
+    clock.Advance(time.Minute)
+    select {
+    case err := <-done:
+        if err != nil {
+            t.Fatal(err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("DeleteUser didn't return once the backoff elapsed")
+    }
+    if sent := len(backend.received(actionDelUser)); sent != 3 {
+        t.Fatalf("%d deletes sent, want 3", sent)
+    }
+}
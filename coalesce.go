@@ -0,0 +1,45 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import "sync"
+
+// flightGroup coalesces concurrent calls with the same key into one, whose
+// result every caller shares.
+type flightGroup struct {
+    mu    sync.Mutex
+    calls map[string]*flight
+}
+
+type flight struct {
+    done chan struct{}
+    err  error
+}
+
+// do runs fn unless a call for key is already in flight, in which case it
+// waits for that call and returns its result instead. shared reports whether
+// the result came from another caller's call.
+func (g *flightGroup) do(key string, fn func() error) (shared bool, err error) {
+    g.mu.Lock()
+    if g.calls == nil {
+        g.calls = make(map[string]*flight)
+    }
+    if f, ok := g.calls[key]; ok {
+        g.mu.Unlock()
+        <-f.done
+        return true, f.err
+    }
+    f := &flight{done: make(chan struct{})}
+    g.calls[key] = f
+    g.mu.Unlock()
+
+    defer func() {
+        g.mu.Lock()
+        delete(g.calls, key)
+        g.mu.Unlock()
+        close(f.done)
+    }()
+    f.err = fn()
+    return false, f.err
+}
@@ -0,0 +1,118 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "fmt"
+    "net/http"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestCoalesceDeletes(t *testing.T) {
+    const callers = 8
+    tests := []struct {
+        name string
+        // request returns the username and statement caller i deletes.
+        request   func(i int) (string, string)
+        fail      bool
+        wantCalls int
+    }{
+        {
+            name:      "same user",
+            request:   func(int) (string, string) { return "V_USER_R", testDeleteStatement },
+            wantCalls: 1,
+        },
+        {
+            name:      "same user, failing",
+            request:   func(int) (string, string) { return "V_USER_R", testDeleteStatement },
+            fail:      true,
+            wantCalls: 1,
+        },
+        {
+            name:      "different users",
+            request:   func(i int) (string, string) { return fmt.Sprintf("V_USER%d_R", i), testDeleteStatement },
+            wantCalls: callers,
+        },
+        {
+            name: "different statements",
+            request: func(i int) (string, string) {
+                return "V_USER_R", fmt.Sprintf(`{"cid":"c%d"}`, i%2)
+            },
+            wantCalls: 2,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            release := make(chan struct{})
+            var releaseOnce sync.Once
+            // Cleanups run last first, so the backend is released before it
+            // is closed.
+            t.Cleanup(func() { releaseOnce.Do(func() { close(release) }) })
+            arrived := make(chan struct{}, callers)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                arrived <- struct{}{}
+                <-release
+                if tt.fail {
+                    writeJSON(w, map[string]interface{}{"status": 1, "error": "busy"})
+                    return true
+                }
+                return false
+            })
+            db := newTestDB(t, backend.URL, nil)
+
+            var wg sync.WaitGroup
+            errs := make([]error, callers)
+            for i := 0; i < callers; i++ {
+                wg.Add(1)
+                go func(i int) {
+                    defer wg.Done()
+                    username, statement := tt.request(i)
+                    errs[i] = deleteUser(db, username, statement)
+                }(i)
+            }
+            // Hold the first delete at the backend until the other callers had
+            // time to join it. Deletes that can't be coalesced are serialized
+            // by the producer lock, and go through once it is released.
+            select {
+            case <-arrived:
+            case <-time.After(5 * time.Second):
+                t.Fatal("no delete reached the backend")
+            }
+            time.Sleep(100 * time.Millisecond)
+            releaseOnce.Do(func() { close(release) })
+            wg.Wait()
+
+            if n := len(backend.received(actionDelUser)); n != tt.wantCalls {
+                t.Fatalf("%d backend deletes for %d callers, want %d", n, callers, tt.wantCalls)
+            }
+            for i, err := range errs {
+                if tt.fail != (err != nil) {
+                    t.Errorf("caller %d: error = %v, want an error: %v", i, err, tt.fail)
+                }
+                if tt.fail && !strings.Contains(err.Error(), "busy") {
+                    t.Errorf("caller %d: error %q isn't the shared backend error", i, err)
+                }
+            }
+        })
+    }
+}
+
+// TestCoalesceDeletesSequential only coalesces deletes in flight together, so
+// that a later delete of the same user still reaches the backend.
+func TestCoalesceDeletesSequential(t *testing.T) {
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, nil)
+    for i := 0; i < 2; i++ {
+        if err := deleteUser(db, "V_USER_R", testDeleteStatement); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if n := len(backend.received(actionDelUser)); n != 2 {
+        t.Fatalf("%d backend deletes, want 2", n)
+    }
+}
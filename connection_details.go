@@ -0,0 +1,82 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import "fmt"
+
+const (
+    defaultHostField     = "host"
+    defaultPortField     = "port"
+    defaultDatabaseField = "database"
+)
+
+// ConnectionDetails describes where a generated user connects to, as reported
+// by the backend when the user was created.
+type ConnectionDetails struct {
+    Host     string
+    Port     string
+    Database string
+    // AccountID is the backend's own id for the account, read from
+    // account_id_field.
+    AccountID string
+}
+
+// ConnectionDetails returns the connection details captured when username was
+// created. ok is false when none were reported.
+func (c *MgtvMysql) ConnectionDetails(username string) (details ConnectionDetails, ok bool) {
+    c.detailsLock.RLock()
+    defer c.detailsLock.RUnlock()
+    details, ok = c.connectionDetails[username]
+    return details, ok
+}
+
+// captureConnectionDetails records the connection details found in a create
+// result under username.
+func (c *mgtvMysqlConnectionProducer) captureConnectionDetails(username string, result map[string]interface{}) {
+    details := ConnectionDetails{
+        Host:     resultString(result, c.HostField),
+        Port:     resultString(result, c.PortField),
+        Database: resultString(result, c.DatabaseField),
+    }
+    if len(c.AccountIDField) > 0 {
+        details.AccountID = resultString(result, c.AccountIDField)
+    }
+    if details == (ConnectionDetails{}) {
+        return
+    }
+    c.logger.Debug("captured connection details", "username", c.logName(username), "host", details.Host, "port", details.Port, "database", details.Database, "account_id", details.AccountID)
+
+    c.detailsLock.Lock()
+    defer c.detailsLock.Unlock()
+    if c.connectionDetails == nil {
+        c.connectionDetails = make(map[string]ConnectionDetails)
+    }
+    c.connectionDetails[username] = details
+}
+
+// accountID returns the backend account id captured when username was created.
+func (c *mgtvMysqlConnectionProducer) accountID(username string) string {
+    c.detailsLock.RLock()
+    defer c.detailsLock.RUnlock()
+    return c.connectionDetails[username].AccountID
+}
+
+func (c *mgtvMysqlConnectionProducer) forgetConnectionDetails(username string) {
+    c.detailsLock.Lock()
+    defer c.detailsLock.Unlock()
+    delete(c.connectionDetails, username)
+}
+
+// resultString returns result[field] formatted as a string, or "" when it is
+// absent.
+func resultString(result map[string]interface{}, field string) string {
+    v, ok := result[field]
+    if !ok || v == nil {
+        return ""
+    }
+    if s, ok := v.(string); ok {
+        return s
+    }
+    return fmt.Sprint(v)
+}
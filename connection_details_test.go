@@ -0,0 +1,151 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/http"
+    "testing"
+)
+
+func TestConnectionDetails(t *testing.T) {
+    tests := []struct {
+        name     string
+        config   map[string]interface{}
+        response map[string]interface{}
+        want     ConnectionDetails
+        wantOK   bool
+    }{
+        {
+            name:     "default fields",
+            response: map[string]interface{}{"host": "db1.internal", "port": 3306, "database": "d1"},
+            want:     ConnectionDetails{Host: "db1.internal", Port: "3306", Database: "d1"},
+            wantOK:   true,
+        },
+        {
+            name:     "configured fields",
+            config:   map[string]interface{}{"host_field": "addr", "port_field": "tcp_port", "database_field": "schema"},
+            response: map[string]interface{}{"addr": "db2.internal", "tcp_port": "3307", "schema": "d2", "host": "ignored"},
+            want:     ConnectionDetails{Host: "db2.internal", Port: "3307", Database: "d2"},
+            wantOK:   true,
+        },
+        {
+            name:     "partial",
+            response: map[string]interface{}{"host": "db3.internal"},
+            want:     ConnectionDetails{Host: "db3.internal"},
+            wantOK:   true,
+        },
+        {name: "none reported", response: map[string]interface{}{}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, tt.config)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(actionAddUser) {
+                    return false
+                }
+                result := map[string]interface{}{"status": 0, "username": req.Body["username"]}
+                for k, v := range tt.response {
+                    result[k] = v
+                }
+                writeJSON(w, result)
+                return true
+            })
+
+            username, err := newUser(db, "role", testCreateStatement)
+            if err != nil {
+                t.Fatal(err)
+            }
+            details, ok := db.ConnectionDetails(username)
+            if ok != tt.wantOK || details != tt.want {
+                t.Fatalf("ConnectionDetails = %+v, %v; want %+v, %v", details, ok, tt.want, tt.wantOK)
+            }
+            if err := deleteUser(db, username, testDeleteStatement); err != nil {
+                t.Fatal(err)
+            }
+            if _, ok := db.ConnectionDetails(username); ok {
+                t.Fatal("connection details kept after delete")
+            }
+        })
+    }
+}
+
+func TestAccountID(t *testing.T) {
+    tests := []struct {
+        name     string
+        config   map[string]interface{}
+        response map[string]interface{}
+        // want is the account id captured and forwarded, none when empty.
+        want string
+    }{
+        {name: "string id", config: map[string]interface{}{"account_id_field": "id"}, response: map[string]interface{}{"id": "acc-1"}, want: "acc-1"},
+        {name: "numeric id", config: map[string]interface{}{"account_id_field": "id"}, response: map[string]interface{}{"id": 42}, want: "42"},
+        {
+            name:     "under strict_response",
+            config:   map[string]interface{}{"account_id_field": "id", "strict_response": true, "confirm_echo": true},
+            response: map[string]interface{}{"id": "acc-1"},
+            want:     "acc-1",
+        },
+        {name: "not reported", config: map[string]interface{}{"account_id_field": "id"}, response: map[string]interface{}{}},
+        {name: "unconfigured", response: map[string]interface{}{"id": "acc-1"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(actionAddUser) {
+                    return false
+                }
+                result := map[string]interface{}{"status": 0, "username": req.Body["username"]}
+                for k, v := range tt.response {
+                    result[k] = v
+                }
+                writeJSON(w, result)
+                return true
+            })
+            sender := &fakeEventSender{}
+            config := map[string]interface{}{"emit_events": true}
+            for k, v := range tt.config {
+                config[k] = v
+            }
+            db := newTestDB(t, backend.URL, config, WithEventSender(sender))
+
+            username, err := newUser(db, "role", testCreateStatement)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if details, _ := db.ConnectionDetails(username); details.AccountID != tt.want {
+                t.Errorf("captured account id %q, want %q", details.AccountID, tt.want)
+            }
+            if err := deleteUser(db, username, testDeleteStatement); err != nil {
+                t.Fatal(err)
+            }
+            // The id is forgotten along with the user.
+            if err := deleteUser(db, username, testDeleteStatement); err != nil {
+                t.Fatal(err)
+            }
+
+            deletes := backend.received(actionDelUser)
+            got, ok := deletes[0].Body["account_id"]
+            switch {
+            case len(tt.want) == 0 && ok:
+                t.Errorf("delete sent account_id %v, want none", got)
+            case len(tt.want) > 0 && got != tt.want:
+                t.Errorf("delete sent account_id %v, want %s", got, tt.want)
+            }
+            if id, ok := deletes[1].Body["account_id"]; ok {
+                t.Errorf("second delete sent account_id %v after the user was deleted", id)
+            }
+            for _, event := range sender.sent()[:2] {
+                got, ok := event.metadata["account_id"]
+                switch {
+                case len(tt.want) == 0 && ok:
+                    t.Errorf("%s event carries account_id %v, want none", event.eventType, got)
+                case len(tt.want) > 0 && got != tt.want:
+                    t.Errorf("%s event carries account_id %v, want %s", event.eventType, got, tt.want)
+                }
+            }
+        })
+    }
+}
@@ -4,33 +4,388 @@
 package mgmysql
 
 import (
+    "bytes"
+    "compress/flate"
+    "compress/gzip"
+    "compress/zlib"
     "context"
+    "crypto/rand"
+    "crypto/tls"
     "database/sql"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
     "net"
     "net/http"
+    "net/http/cookiejar"
+    "net/url"
     "os"
+    "regexp"
+    "strings"
     "sync"
+    "syscall"
+    "text/template"
     "time"
 
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/vault/sdk/logical"
     "github.com/mitchellh/mapstructure"
 )
 
+const (
+    actionPlacementBody  = "body"
+    actionPlacementQuery = "query"
+
+    dbnamePlacementBody = "body"
+    dbnamePlacementPath = "path"
+
+    cidPlacementBody   = "body"
+    cidPlacementHeader = "header"
+    cidPlacementBoth   = "both"
+    tenantHeader       = "X-Tenant-Id"
+
+    nonceHeader     = "X-Nonce"
+    timestampHeader = "X-Timestamp"
+
+    // Setting Accept-Encoding disables the transport's transparent gzip
+    // handling, so responses are decoded by readBody instead.
+    acceptEncoding = "gzip, deflate"
+
+    defaultPrivReadOnly  = "read_only"
+    defaultPrivReadWrite = "read_write"
+    defaultPrivError     = "error"
+
+    // defaultMaxStatementBytes applies when max_statement_bytes isn't set.
+    defaultMaxStatementBytes = 64 * 1024
+
+    defaultSuccessValue = "ok"
+
+    // defaultConnectTimeout, in seconds, bounds connecting to the backend when
+    // neither connect_timeout nor timeout is set.
+    defaultConnectTimeout = 10
+)
+
 type mgtvMysqlConnectionProducer struct {
-    ConnectionURL   string `json:"connection_url"          mapstructure:"connection_url"          structs:"connection_url"`
+    // producerConfig is replaced as a whole by a successful Init, under the
+    // lock. Operations read it under the read lock.
+    producerConfig
     Type            string
+    // httpClient is replaced as a whole by Init under clientLock, so calls
+    // running concurrently never observe a partially built client.
+    clientLock      sync.RWMutex
+    httpClient      *http.Client
+    // cookieJar outlives the clients Init builds, so sessions survive a
+    // reload of the config.
+    cookieJar       http.CookieJar
+    Initialized     bool
+    db              *sql.DB
+    logger          hclog.Logger
+    clock           Clock
+    tokenTrimOnce   sync.Once
+    tokenCacheLock  sync.Mutex
+    tokenCache      cachedToken
+    roleCreates     keyedSemaphore
+    roleCapLocks    keyedMutex
+    deletes         flightGroup
+    latency         latencyRecorder
+    traffic         trafficBuffer
+    users           userCache
+    caps            capabilityCache
+    kvSource        KVSource
+    slowCallHook    func(SlowCall)
+    eventSender     logical.EventSender
+    randomSource    io.Reader
+    sinkLock        sync.Mutex
+    detailsLock     sync.RWMutex
+    connectionDetails map[string]ConnectionDetails
+    // closeCtx is cancelled by Close, aborting backend calls in flight.
+    closeCtx        context.Context
+    closeCancel     context.CancelFunc
+    // readyAt is when post_init_delay ends.
+    readyLock       sync.Mutex
+    readyAt         time.Time
+    sync.RWMutex
+}
+
+// producerConfig is the configuration Init decodes, and what it derives from
+// it to run operations with.
+type producerConfig struct {
+    ConnectionURL   string `json:"connection_url"          mapstructure:"connection_url"          structs:"connection_url"`
     RawConfig       map[string]interface{}
     Timeout         time.Duration `json:"timeout" mapstructure:"timeout" structs:"timeout"`
+    // ConnectTimeout bounds, in seconds, connecting to the backend, and
+    // RequestTimeout a whole request, response included. Each defaults to
+    // timeout; without it, connects are bounded by defaultConnectTimeout and
+    // requests only by the operation's context.
+    ConnectTimeout  time.Duration `json:"connect_timeout" mapstructure:"connect_timeout" structs:"connect_timeout"`
+    RequestTimeout  time.Duration `json:"request_timeout" mapstructure:"request_timeout" structs:"request_timeout"`
     KeepAlive       time.Duration `json:"keep_alive" mapstructure:"keep_alive" structs:"keep_alive"`
     IdleConnTimeout time.Duration `json:"idle_conn_timeout" mapstructure:"idle_conn_timeout" structs:"idle_conn_timeout"`
     MaxIdleConns    int           `json:"max_idle_conns" mapstructure:"max_idle_conns" structs:"max_idle_conns"`
-    httpClient      http.Client
-    Initialized     bool
-    db              *sql.DB
-    sync.Mutex
+    // SlowCallThreshold, in milliseconds, is the latency above which a backend
+    // call is passed to the slow call hook. Zero disables it.
+    SlowCallThreshold int `json:"slow_call_threshold" mapstructure:"slow_call_threshold" structs:"slow_call_threshold"`
+    // TrafficBufferSize is how many recent backend calls RecentTraffic keeps.
+    // Zero disables the buffer.
+    TrafficBufferSize int `json:"traffic_buffer_size" mapstructure:"traffic_buffer_size" structs:"traffic_buffer_size"`
+    // DisableKeepAlives opens a fresh connection for every request, for
+    // backends behind middleboxes that silently drop idle connections. Each
+    // request then pays for a new TCP, and TLS, handshake.
+    DisableKeepAlives bool `json:"disable_keep_alives" mapstructure:"disable_keep_alives" structs:"disable_keep_alives"`
+    // DisableHTTP2 forces HTTP/1.1 for backends with unreliable HTTP/2.
+    DisableHTTP2    bool `json:"disable_http2" mapstructure:"disable_http2" structs:"disable_http2"`
+    // EnableCookies keeps the cookies the backend sets, such as a session
+    // cookie, and sends them on later requests of this plugin instance.
+    EnableCookies   bool `json:"enable_cookies" mapstructure:"enable_cookies" structs:"enable_cookies"`
+    // MaskUsernames replaces usernames in log lines with a stable hash.
+    MaskUsernames   bool `json:"mask_usernames" mapstructure:"mask_usernames" structs:"mask_usernames"`
+    AttemptTimeout  time.Duration `json:"attempt_timeout" mapstructure:"attempt_timeout" structs:"attempt_timeout"`
+    // PerAttemptTimeoutPct bounds each attempt to this percentage of the time
+    // left until the deadline of the operation, computed when the attempt
+    // starts. Zero disables it.
+    PerAttemptTimeoutPct int `json:"per_attempt_timeout_pct" mapstructure:"per_attempt_timeout_pct" structs:"per_attempt_timeout_pct"`
+    // ResponseReadTimeout bounds, in seconds, reading a response body once its
+    // headers arrived. Zero disables it.
+    ResponseReadTimeout time.Duration `json:"response_read_timeout" mapstructure:"response_read_timeout" structs:"response_read_timeout"`
+    // ConnectRetries is how often a failed TCP connect is retried.
+    ConnectRetries  int           `json:"connect_retries" mapstructure:"connect_retries" structs:"connect_retries"`
+    // RetryMinDelay and RetryMaxDelay bound, in milliseconds, the jittered
+    // exponential backoff between connect retries.
+    RetryMinDelay   int           `json:"retry_min_delay" mapstructure:"retry_min_delay" structs:"retry_min_delay"`
+    RetryMaxDelay   int           `json:"retry_max_delay" mapstructure:"retry_max_delay" structs:"retry_max_delay"`
+    // RetryActions lists the backend actions, such as VaultDelUser, whose
+    // requests are resent when the backend drops the connection or cuts its
+    // response short. Unset, every action but those creating users, AddUser
+    // and PrepareUser, is; an empty list resends none. List the creating
+    // actions only when the backend is known to ignore a repeated create.
+    RetryActions    []string      `json:"retry_actions" mapstructure:"retry_actions" structs:"retry_actions"`
+    retryActions    map[backendAction]bool
+    // RateLimit caps the backend calls made per second, across operations,
+    // allowing bursts of RateLimitBurst calls. Zero disables the limit.
+    RateLimit       int `json:"rate_limit" mapstructure:"rate_limit" structs:"rate_limit"`
+    RateLimitBurst  int `json:"rate_limit_burst" mapstructure:"rate_limit_burst" structs:"rate_limit_burst"`
+    limiter         *rateLimiter
+    LocalAddress    string        `json:"local_address" mapstructure:"local_address" structs:"local_address"`
+    // TLSPinSHA256 is the hex SHA-256 fingerprint the backend's leaf
+    // certificate must have. TLSRequireSAN is a DNS name or IP address it must
+    // carry.
+    TLSPinSHA256    string `json:"tls_pin_sha256" mapstructure:"tls_pin_sha256" structs:"tls_pin_sha256"`
+    TLSRequireSAN   string `json:"tls_require_san" mapstructure:"tls_require_san" structs:"tls_require_san"`
+    // RequireTLS, on unless set to false, rejects backend urls that would
+    // carry the token over plain http. Unix socket urls are always accepted.
+    RequireTLS      bool   `json:"require_tls" mapstructure:"require_tls" structs:"require_tls"`
+    ActionPlacement string        `json:"action_placement" mapstructure:"action_placement" structs:"action_placement"`
+    // MaxConcurrentCreatesPerRole caps the NewUser calls in flight for a single
+    // role; those beyond it are rejected. Zero means unlimited.
+    MaxConcurrentCreatesPerRole int `json:"max_concurrent_creates_per_role" mapstructure:"max_concurrent_creates_per_role" structs:"max_concurrent_creates_per_role"`
+    // MaxUsersPerRole caps, by role name, the active users of a role; a create
+    // that would exceed it is rejected. Roles not listed are unlimited.
+    MaxUsersPerRole map[string]int `json:"max_users_per_role" mapstructure:"max_users_per_role" structs:"max_users_per_role"`
+    // TwoPhaseCreate creates users in two steps, PrepareUser then CommitUser,
+    // aborting the prepared user with AbortUser when the commit fails.
+    TwoPhaseCreate  bool `json:"two_phase_create" mapstructure:"two_phase_create" structs:"two_phase_create"`
+    // DebugRequestSink is a file that receives every outgoing request body,
+    // redacted, as newline-delimited JSON. Empty disables it.
+    DebugRequestSink string `json:"debug_request_sink" mapstructure:"debug_request_sink" structs:"debug_request_sink"`
+    // DebugPrettyJSON logs every outgoing request body, redacted and
+    // indented, at trace level. The body sent is unaffected.
+    DebugPrettyJSON bool `json:"debug_pretty_json" mapstructure:"debug_pretty_json" structs:"debug_pretty_json"`
+    // BackendURLs spreads requests across several backends by weight instead
+    // of sending them all to connection_url.
+    BackendURLs     []backendURL `json:"backend_urls" mapstructure:"backend_urls" structs:"backend_urls"`
+    // BreakerThreshold consecutive failures of a backend skip it for
+    // BreakerCooldown seconds. Zero disables the circuit breaker.
+    BreakerThreshold int           `json:"breaker_threshold" mapstructure:"breaker_threshold" structs:"breaker_threshold"`
+    BreakerCooldown  time.Duration `json:"breaker_cooldown" mapstructure:"breaker_cooldown" structs:"breaker_cooldown"`
+    balancer        *balancer
+    // StrictRedaction scrubs tokens and passwords from returned errors in the
+    // plugin itself, regardless of the sanitizer middleware.
+    StrictRedaction bool `json:"strict_redaction" mapstructure:"strict_redaction" structs:"strict_redaction"`
+    // SuccessHeader, when set, decides the outcome of a call: it succeeded
+    // when the header equals SuccessValue, and ErrorHeader carries the detail
+    // otherwise.
+    SuccessHeader   string `json:"success_header" mapstructure:"success_header" structs:"success_header"`
+    SuccessValue    string `json:"success_value" mapstructure:"success_value" structs:"success_value"`
+    ErrorHeader     string `json:"error_header" mapstructure:"error_header" structs:"error_header"`
+    // APIVersionHeader names the response header the backend advertises its
+    // API version in. Calls fail when it is outside of MinAPIVersion and
+    // MaxAPIVersion, dotted numeric versions that are unbounded when empty.
+    APIVersionHeader string `json:"api_version_header" mapstructure:"api_version_header" structs:"api_version_header"`
+    MinAPIVersion    string `json:"min_api_version" mapstructure:"min_api_version" structs:"min_api_version"`
+    MaxAPIVersion    string `json:"max_api_version" mapstructure:"max_api_version" structs:"max_api_version"`
+    // GetUserSupported declares that the backend implements GetUser.
+    GetUserSupported bool `json:"get_user_supported" mapstructure:"get_user_supported" structs:"get_user_supported"`
+    // CheckCapabilities fails operations whose action is missing from the
+    // actions the backend's Capabilities action reports.
+    CheckCapabilities bool `json:"check_capabilities" mapstructure:"check_capabilities" structs:"check_capabilities"`
+    // RevokeWindowSupported declares that the backend implements revoking the
+    // users of a role created within a time window.
+    RevokeWindowSupported bool `json:"revoke_window_supported" mapstructure:"revoke_window_supported" structs:"revoke_window_supported"`
+    // GetUserCacheTTL is how long, in seconds, GetUser results are reused.
+    // Zero disables the cache.
+    GetUserCacheTTL time.Duration `json:"get_user_cache_ttl" mapstructure:"get_user_cache_ttl" structs:"get_user_cache_ttl"`
+    // OnAmbiguousCreate decides what a create that timed out after being sent
+    // means: assume_failed_cleanup deletes the user in case it was created,
+    // assume_success keeps it, and verify looks it up with GetUser.
+    OnAmbiguousCreate string `json:"on_ambiguous_create" mapstructure:"on_ambiguous_create" structs:"on_ambiguous_create"`
+    // VerifyAfterDelete looks the user up after a successful delete and fails
+    // the revocation if it still exists, so that Vault retries it.
+    VerifyAfterDelete bool `json:"verify_after_delete" mapstructure:"verify_after_delete" structs:"verify_after_delete"`
+    // RequestTemplate is a text/template rendering the whole create request
+    // body, for backends whose API doesn't map onto the usual fields.
+    RequestTemplate string `json:"request_template" mapstructure:"request_template" structs:"request_template"`
+    requestTemplate *template.Template
+    // ReplayProtection sends a unique X-Nonce and an X-Timestamp with every
+    // call so that the backend can reject replays. Retries of a call carry
+    // the same ones.
+    ReplayProtection bool `json:"replay_protection" mapstructure:"replay_protection" structs:"replay_protection"`
+    // SignRequests sends the HMAC-SHA256 of every request body, keyed with
+    // the mysql_signing_key environment variable, as X-Signature.
+    SignRequests bool `json:"sign_requests" mapstructure:"sign_requests" structs:"sign_requests"`
+    // SignReplayHeaders has the signature cover X-Timestamp and X-Nonce too,
+    // as the timestamp, the nonce and the body joined by newlines.
+    SignReplayHeaders bool `json:"sign_replay_headers" mapstructure:"sign_replay_headers" structs:"sign_replay_headers"`
+    signingKey        []byte
+    // StrictResponse fails calls whose result carries fields the plugin
+    // doesn't know, to detect backend API drift. Off for forward compatibility.
+    StrictResponse  bool `json:"strict_response" mapstructure:"strict_response" structs:"strict_response"`
+    // ConfirmEcho fails a create unless the backend echoes the username, and
+    // priv if it echoes one, exactly as sent.
+    ConfirmEcho     bool `json:"confirm_echo" mapstructure:"confirm_echo" structs:"confirm_echo"`
+    // UsernameCaseInsensitiveEcho accepts, for confirm_echo, a username echoed
+    // in a different case, for backends that fold the case of usernames.
+    UsernameCaseInsensitiveEcho bool `json:"username_case_insensitive_echo" mapstructure:"username_case_insensitive_echo" structs:"username_case_insensitive_echo"`
+    // BatchBody set to ndjson sends batch operations as newline-delimited
+    // JSON, one object per user, instead of a single JSON body.
+    BatchBody       string `json:"batch_body" mapstructure:"batch_body" structs:"batch_body"`
+    // FieldNames maps canonical request field names, such as username, to the
+    // names the backend expects on the wire.
+    FieldNames      map[string]string `json:"field_names" mapstructure:"field_names" structs:"field_names"`
+    // PasswordHash sends passwords hashed for backends that expect it: none,
+    // mysql_native or sha256.
+    PasswordHash    string `json:"password_hash" mapstructure:"password_hash" structs:"password_hash"`
+    // PasswordMinLength and PasswordMaxLength bound the length of passwords
+    // sent to the backend. Zero disables a bound.
+    PasswordMinLength int `json:"password_min_length" mapstructure:"password_min_length" structs:"password_min_length"`
+    PasswordMaxLength int `json:"password_max_length" mapstructure:"password_max_length" structs:"password_max_length"`
+    // DefaultPriv decides what a create statement without priv means:
+    // read_only, read_write or error.
+    DefaultPriv string `json:"default_priv" mapstructure:"default_priv" structs:"default_priv"`
+    // MaxPriv is the highest privilege a create statement may request, in any
+    // form priv accepts. Unset allows every privilege.
+    MaxPriv     string `json:"max_priv" mapstructure:"max_priv" structs:"max_priv"`
+    maxPriv     Priv
+    // MaxStatementBytes rejects larger create statements before they are
+    // parsed. Zero disables the check.
+    MaxStatementBytes int `json:"max_statement_bytes" mapstructure:"max_statement_bytes" structs:"max_statement_bytes"`
+    // AllowedStatementFields, when set, rejects create statements carrying any
+    // other field. Unset allows every field.
+    AllowedStatementFields []string `json:"allowed_statement_fields" mapstructure:"allowed_statement_fields" structs:"allowed_statement_fields"`
+    // DefaultIPList is the comma separated list of CIDRs sent as iplist when
+    // the create statement doesn't have one.
+    DefaultIPList string `json:"default_iplist" mapstructure:"default_iplist" structs:"default_iplist"`
+    // UsernameRegex must match every generated username, suffix included.
+    UsernameRegex   string `json:"username_regex" mapstructure:"username_regex" structs:"username_regex"`
+    usernameRegex   *regexp.Regexp
+    // AllowExplicitUsername lets a create statement name the user to create in
+    // explicit_username, for migrations, instead of generating a random name.
+    // Such users aren't recognized as the plugin's by Reconcile.
+    AllowExplicitUsername bool `json:"allow_explicit_username" mapstructure:"allow_explicit_username" structs:"allow_explicit_username"`
+    // ReservedUsernames are names the backend keeps for itself, such as root,
+    // which a generated username is never given, whatever its case.
+    ReservedUsernames []string `json:"reserved_usernames" mapstructure:"reserved_usernames" structs:"reserved_usernames"`
+    reservedUsernames map[string]bool
+    // UsernameStrategy produces the random part of generated usernames:
+    // credsutil, uuid, or custom-template rendering UsernameTemplate with the
+    // RoleName and a random function. Reconcile only recognizes the
+    // usernames of the credsutil and uuid strategies.
+    UsernameStrategy string `json:"username_strategy" mapstructure:"username_strategy" structs:"username_strategy"`
+    UsernameTemplate string `json:"username_template" mapstructure:"username_template" structs:"username_template"`
+    usernameTemplate *template.Template
+    // DbnamePlacement set to path sends requests to /db/{dbname}/users under
+    // connection_url, in addition to dbname in the body.
+    DbnamePlacement string `json:"dbname_placement" mapstructure:"dbname_placement" structs:"dbname_placement"`
+    // Engine is the database engine targeted when statements don't name one.
+    Engine          string `json:"engine" mapstructure:"engine" structs:"engine"`
+    // UsernameCase overrides the engine's username casing: upper, lower or
+    // preserve.
+    UsernameCase    string `json:"username_case" mapstructure:"username_case" structs:"username_case"`
+    // CidPlacement sends cid in the body, as an X-Tenant-Id header, or both.
+    CidPlacement    string `json:"cid_placement" mapstructure:"cid_placement" structs:"cid_placement"`
+    // HostField, PortField and DatabaseField name the create response fields
+    // captured as ConnectionDetails.
+    HostField       string `json:"host_field" mapstructure:"host_field" structs:"host_field"`
+    PortField       string `json:"port_field" mapstructure:"port_field" structs:"port_field"`
+    DatabaseField   string `json:"database_field" mapstructure:"database_field" structs:"database_field"`
+    // AccountIDField names the create result field holding the backend's id
+    // for the account. It is captured with the connection details, included
+    // in events and sent as account_id when the user is deleted.
+    AccountIDField  string `json:"account_id_field" mapstructure:"account_id_field" structs:"account_id_field"`
+    // Token is the backend token itself, for environments where neither the
+    // environment nor files can carry it. It is never returned in the saved
+    // config.
+    Token           string `json:"token" mapstructure:"token" structs:"token"`
+    // TokenKVRef reads the token from path#key in the injected KVSource
+    // instead of the environment.
+    TokenKVRef      string `json:"token_kv_ref" mapstructure:"token_kv_ref" structs:"token_kv_ref"`
+    // TokenFile reads the token from a file instead of the environment.
+    TokenFile       string `json:"token_file" mapstructure:"token_file" structs:"token_file"`
+    // RevokeTokenFile reads the token revocations are made with from a file
+    // instead of the mysql_revoke_token environment variable. It is read
+    // together with token_file, so the two may be rotated together.
+    RevokeTokenFile string `json:"revoke_token_file" mapstructure:"revoke_token_file" structs:"revoke_token_file"`
+    // TokenRefreshRetries is how often the token is re-read again when the
+    // token re-read after a 401 is rejected as well.
+    TokenRefreshRetries int `json:"token_refresh_retries" mapstructure:"token_refresh_retries" structs:"token_refresh_retries"`
+    // ReauthRedirectLocation is a regular expression matching the Location of
+    // the redirects a gateway answers a stale token with. Such a redirect is
+    // handled like a 401 instead of being followed. ReauthRedirectStatus
+    // limits it to one redirect status.
+    ReauthRedirectLocation string `json:"reauth_redirect_location" mapstructure:"reauth_redirect_location" structs:"reauth_redirect_location"`
+    ReauthRedirectStatus   int    `json:"reauth_redirect_status" mapstructure:"reauth_redirect_status" structs:"reauth_redirect_status"`
+    reauth                 *reauthRedirect
+    // TokenCacheTTL is how long, in seconds, a token read from token_file,
+    // token_kv_ref or revoke_token_file is reused before the source is read again.
+    TokenCacheTTL   time.Duration `json:"token_cache_ttl" mapstructure:"token_cache_ttl" structs:"token_cache_ttl"`
+    // VerifyTokenScopes checks during Initialize, through the backend's WhoAmI
+    // action, that the tokens in use carry the create and delete scopes.
+    VerifyTokenScopes   bool `json:"verify_token_scopes" mapstructure:"verify_token_scopes" structs:"verify_token_scopes"`
+    // InitCanary creates and deletes a throwaway account during Initialize,
+    // failing it unless both succeed. InitCanaryStatement holds the create
+    // statement fields, such as cid, the canary is created with.
+    InitCanary          bool   `json:"init_canary" mapstructure:"init_canary" structs:"init_canary"`
+    InitCanaryStatement string `json:"init_canary_statement" mapstructure:"init_canary_statement" structs:"init_canary_statement"`
+    // HealthPath, relative to connection_url, is checked when the connection
+    // is verified. HealthMethod is GET or HEAD.
+    HealthPath      string `json:"health_path" mapstructure:"health_path" structs:"health_path"`
+    HealthMethod    string `json:"health_method" mapstructure:"health_method" structs:"health_method"`
+    HealthExpectedStatus int `json:"health_expected_status" mapstructure:"health_expected_status" structs:"health_expected_status"`
+    // MaxClockSkew, in seconds, turns on a check during Initialize that the
+    // time the backend reports in ClockSkewHeader is within it of the local
+    // time. ClockSkewAction is warn or fail.
+    MaxClockSkew    time.Duration `json:"max_clock_skew" mapstructure:"max_clock_skew" structs:"max_clock_skew"`
+    ClockSkewHeader string        `json:"clock_skew_header" mapstructure:"clock_skew_header" structs:"clock_skew_header"`
+    ClockSkewAction string        `json:"clock_skew_action" mapstructure:"clock_skew_action" structs:"clock_skew_action"`
+    // EmitEvents publishes credential create, delete and rotate events. The
+    // database plugin protocol doesn't carry events to Vault, so unless the
+    // plugin is built with an event sender they are written to the plugin log,
+    // which Vault forwards to its own.
+    EmitEvents      bool          `json:"emit_events" mapstructure:"emit_events" structs:"emit_events"`
+    // PostInitDelay holds back, for this many seconds after Initialize, the
+    // backend calls of operations, for backends that need a moment after a
+    // new session before accepting writes.
+    PostInitDelay   time.Duration `json:"post_init_delay" mapstructure:"post_init_delay" structs:"post_init_delay"`
 }
 
 func (c *mgtvMysqlConnectionProducer) secretValues() map[string]string {
+    c.RLock()
+    defer c.RUnlock()
     return map[string]string{
+        c.Token:                    "[token]",
+        strings.TrimSpace(c.Token): "[token]",
     }
 }
 
@@ -38,49 +393,1016 @@ func (c *mgtvMysqlConnectionProducer) Init(ctx context.Context, initConfig map[s
     c.Lock()
     defer c.Unlock()
 
-    c.RawConfig = initConfig
+    // The config is decoded and validated on a copy of the current one, which
+    // is only replaced once all of it turned out valid, so that a rejected
+    // config leaves the plugin running on the previous one.
+    next := &mgtvMysqlConnectionProducer{
+        producerConfig: c.producerConfig,
+        logger:         c.logger,
+        clock:          c.clock,
+        kvSource:       c.kvSource,
+        randomSource:   c.randomSource,
+        cookieJar:      c.cookieJar,
+    }
+    if err := next.configure(initConfig); err != nil {
+        return nil, err
+    }
+    // The client is built by next, so that what it reads of the config at
+    // dial time never changes under it.
+    client := next.newHTTPClient()
+
+    c.producerConfig = next.producerConfig
+    c.cookieJar = next.cookieJar
+    c.traffic.resize(c.TrafficBufferSize)
+    c.tokenCacheLock.Lock()
+    c.tokenCache = cachedToken{}
+    c.tokenCacheLock.Unlock()
+    c.users.reset()
+    c.caps.reset()
+    c.readyLock.Lock()
+    c.readyAt = time.Time{}
+    c.readyLock.Unlock()
+    c.clientLock.Lock()
+    c.httpClient = client
+    c.clientLock.Unlock()
+
+    c.Initialized = true
+
+    return savedConfig(initConfig), nil
+}
+
+// configure decodes initConfig onto the config of c, applies the defaults and
+// validates it. c is a copy Init made, not yet used by operations.
+func (c *mgtvMysqlConnectionProducer) configure(initConfig map[string]interface{}) (err error) {
+    c.Token = ""
+    c.AllowedStatementFields = nil
+    c.RetryActions = nil
+    c.ReservedUsernames = nil
+    c.MaxUsersPerRole = nil
 
     decoderConfig := &mapstructure.DecoderConfig{
-        Result:           c,
+        Result:           &c.producerConfig,
         WeaklyTypedInput: true,
         TagName:          "json",
+        // Maps and slices are decoded into new ones instead of into those the
+        // copy shares with the current config.
+        ZeroFields:       true,
     }
 
     decoder, err := mapstructure.NewDecoder(decoderConfig)
     if err != nil {
-        return nil, err
+        return err
     }
 
     err = decoder.Decode(initConfig)
     if err != nil {
-        return nil, err
+        return err
+    }
+    c.RawConfig = retainedConfig(initConfig)
+
+    if len(c.LocalAddress) > 0 && net.ParseIP(c.LocalAddress) == nil {
+        return fmt.Errorf("invalid local_address %q: not an IP address", c.LocalAddress)
     }
 
+    if len(c.TLSPinSHA256) > 0 {
+        if _, err := parsePin(c.TLSPinSHA256); err != nil {
+            return err
+        }
+    }
+
+    if _, ok := initConfig["connect_timeout"]; !ok {
+        c.ConnectTimeout = c.Timeout
+        if c.ConnectTimeout == 0 {
+            c.ConnectTimeout = defaultConnectTimeout
+        }
+    }
+    if _, ok := initConfig["request_timeout"]; !ok {
+        c.RequestTimeout = c.Timeout
+    }
+    if c.ConnectTimeout < 0 {
+        return fmt.Errorf("invalid connect_timeout %d: must not be negative", c.ConnectTimeout)
+    }
+    if c.RequestTimeout < 0 {
+        return fmt.Errorf("invalid request_timeout %d: must not be negative", c.RequestTimeout)
+    }
+
+    if c.AttemptTimeout < 0 {
+        return fmt.Errorf("invalid attempt_timeout %d: must not be negative", c.AttemptTimeout)
+    }
+
+    if c.PerAttemptTimeoutPct < 0 || c.PerAttemptTimeoutPct > 100 {
+        return fmt.Errorf("invalid per_attempt_timeout_pct %d: must be between 1 and 100, or 0 to disable it", c.PerAttemptTimeoutPct)
+    }
+
+    if c.ResponseReadTimeout < 0 {
+        return fmt.Errorf("invalid response_read_timeout %d: must not be negative", c.ResponseReadTimeout)
+    }
+
+    if c.ConnectRetries < 0 {
+        return fmt.Errorf("invalid connect_retries %d: must not be negative", c.ConnectRetries)
+    }
+
+    if _, ok := initConfig["retry_min_delay"]; !ok {
+        c.RetryMinDelay = defaultRetryMinDelay
+    }
+    if _, ok := initConfig["retry_max_delay"]; !ok {
+        c.RetryMaxDelay = defaultRetryMaxDelay
+    }
+    if c.RetryMinDelay < 0 {
+        return fmt.Errorf("invalid retry_min_delay %d: must not be negative", c.RetryMinDelay)
+    }
+    if c.RetryMaxDelay < c.RetryMinDelay {
+        return fmt.Errorf("invalid retry_max_delay %d: must not be less than retry_min_delay %d", c.RetryMaxDelay, c.RetryMinDelay)
+    }
+    c.retryActions = nil
+    if _, ok := initConfig["retry_actions"]; ok {
+        c.retryActions = make(map[backendAction]bool, len(c.RetryActions))
+        for _, name := range c.RetryActions {
+            action := backendAction(name)
+            if _, ok := actionSpecs[action]; !ok {
+                return fmt.Errorf("invalid retry_actions %q: unknown backend action", name)
+            }
+            c.retryActions[action] = true
+        }
+    }
+
+    if c.RateLimit < 0 {
+        return fmt.Errorf("invalid rate_limit %d: must not be negative", c.RateLimit)
+    }
+    if c.RateLimitBurst < 0 {
+        return fmt.Errorf("invalid rate_limit_burst %d: must not be negative", c.RateLimitBurst)
+    }
+    c.limiter = newRateLimiter(c.RateLimit, c.RateLimitBurst, c.clock)
+
+    if _, ok := initConfig["traffic_buffer_size"]; !ok {
+        c.TrafficBufferSize = defaultTrafficBufferSize
+    }
+    if c.TrafficBufferSize < 0 {
+        return fmt.Errorf("invalid traffic_buffer_size %d: must not be negative", c.TrafficBufferSize)
+    }
+
+    if c.SlowCallThreshold < 0 {
+        return fmt.Errorf("invalid slow_call_threshold %d: must not be negative", c.SlowCallThreshold)
+    }
+
+    if c.MaxConcurrentCreatesPerRole < 0 {
+        return fmt.Errorf("invalid max_concurrent_creates_per_role %d: must not be negative", c.MaxConcurrentCreatesPerRole)
+    }
+    for role, limit := range c.MaxUsersPerRole {
+        if limit <= 0 {
+            return fmt.Errorf("invalid max_users_per_role %d for role %q: must be positive", limit, role)
+        }
+    }
+
+    if _, ok := initConfig["max_statement_bytes"]; !ok {
+        c.MaxStatementBytes = defaultMaxStatementBytes
+    }
+    if c.MaxStatementBytes < 0 {
+        return fmt.Errorf("invalid max_statement_bytes %d: must not be negative", c.MaxStatementBytes)
+    }
+
+    if len(c.DefaultIPList) > 0 {
+        if err := validateIPList(c.DefaultIPList); err != nil {
+            return err
+        }
+    }
+
+    switch c.DefaultPriv {
+    case "":
+        c.DefaultPriv = defaultPrivReadOnly
+    case defaultPrivReadOnly, defaultPrivReadWrite, defaultPrivError:
+    default:
+        return fmt.Errorf("invalid default_priv %q: must be %q, %q or %q", c.DefaultPriv, defaultPrivReadOnly, defaultPrivReadWrite, defaultPrivError)
+    }
+
+    c.maxPriv = ""
+    if len(c.MaxPriv) > 0 {
+        c.maxPriv, err = NormalizePriv(c.MaxPriv)
+        if err != nil {
+            return fmt.Errorf("invalid max_priv: %w", err)
+        }
+        if c.DefaultPriv == defaultPrivReadWrite && PrivReadWrite.exceeds(c.maxPriv) {
+            return fmt.Errorf("invalid default_priv %q: exceeds max_priv %q", c.DefaultPriv, c.MaxPriv)
+        }
+    }
+
+    if len(c.PasswordHash) == 0 {
+        c.PasswordHash = passwordHashNone
+    }
+    if !validPasswordHash(c.PasswordHash) {
+        return fmt.Errorf("invalid password_hash %q: must be %q, %q or %q", c.PasswordHash, passwordHashNone, passwordHashMySQLNative, passwordHashSHA256)
+    }
+
+    if c.PasswordMinLength < 0 {
+        return fmt.Errorf("invalid password_min_length %d: must not be negative", c.PasswordMinLength)
+    }
+    if c.PasswordMaxLength < 0 {
+        return fmt.Errorf("invalid password_max_length %d: must not be negative", c.PasswordMaxLength)
+    }
+    if c.PasswordMaxLength > 0 && c.PasswordMinLength > c.PasswordMaxLength {
+        return fmt.Errorf("invalid password_max_length %d: must not be less than password_min_length %d", c.PasswordMaxLength, c.PasswordMinLength)
+    }
+
+    c.reservedUsernames = make(map[string]bool, len(c.ReservedUsernames))
+    for _, name := range c.ReservedUsernames {
+        if len(strings.TrimSpace(name)) == 0 {
+            return errors.New("invalid reserved_usernames: names must not be empty")
+        }
+        c.reservedUsernames[strings.ToLower(strings.TrimSpace(name))] = true
+    }
+
+    c.usernameRegex = nil
+    if len(c.UsernameRegex) > 0 {
+        c.usernameRegex, err = regexp.Compile(c.UsernameRegex)
+        if err != nil {
+            return fmt.Errorf("invalid username_regex: %w", err)
+        }
+    }
+
+    switch c.UsernameStrategy {
+    case "":
+        c.UsernameStrategy = usernameStrategyCredsutil
+    case usernameStrategyCredsutil, usernameStrategyUUID, usernameStrategyTemplate:
+    default:
+        return fmt.Errorf("invalid username_strategy %q: must be %q, %q or %q", c.UsernameStrategy, usernameStrategyCredsutil, usernameStrategyUUID, usernameStrategyTemplate)
+    }
+    c.usernameTemplate = nil
+    if c.UsernameStrategy == usernameStrategyTemplate {
+        if len(c.UsernameTemplate) == 0 {
+            return fmt.Errorf("username_template is required when username_strategy is %q", usernameStrategyTemplate)
+        }
+        c.usernameTemplate, err = c.parseUsernameTemplate(c.UsernameTemplate)
+        if err != nil {
+            return err
+        }
+    }
+
+    if c.GetUserCacheTTL < 0 {
+        return fmt.Errorf("invalid get_user_cache_ttl %d: must not be negative", c.GetUserCacheTTL)
+    }
+
+    switch c.OnAmbiguousCreate {
+    case "":
+        c.OnAmbiguousCreate = ambiguousCleanup
+        if c.GetUserSupported {
+            c.OnAmbiguousCreate = ambiguousVerify
+        }
+    case ambiguousCleanup, ambiguousSuccess, ambiguousVerify:
+    default:
+        return fmt.Errorf("invalid on_ambiguous_create %q: must be %q, %q or %q", c.OnAmbiguousCreate, ambiguousCleanup, ambiguousSuccess, ambiguousVerify)
+    }
+
+    if len(c.SuccessValue) == 0 {
+        c.SuccessValue = defaultSuccessValue
+    }
+
+    if err := c.validateAPIVersionRange(); err != nil {
+        return err
+    }
+
+    c.requestTemplate = nil
+    if len(c.RequestTemplate) > 0 {
+        c.requestTemplate, err = parseRequestTemplate(c.RequestTemplate)
+        if err != nil {
+            return err
+        }
+    }
+
+    if err := validateFieldNames(c.FieldNames); err != nil {
+        return err
+    }
+
+    switch c.ActionPlacement {
+    case "":
+        c.ActionPlacement = actionPlacementBody
+    case actionPlacementBody, actionPlacementQuery:
+    default:
+        return fmt.Errorf("invalid action_placement %q: must be %q or %q", c.ActionPlacement, actionPlacementBody, actionPlacementQuery)
+    }
+
+    switch c.BatchBody {
+    case "":
+        c.BatchBody = batchBodyJSON
+    case batchBodyJSON, batchBodyNDJSON:
+    default:
+        return fmt.Errorf("invalid batch_body %q: must be %q or %q", c.BatchBody, batchBodyJSON, batchBodyNDJSON)
+    }
+
+    switch c.DbnamePlacement {
+    case "":
+        c.DbnamePlacement = dbnamePlacementBody
+    case dbnamePlacementBody, dbnamePlacementPath:
+    default:
+        return fmt.Errorf("invalid dbname_placement %q: must be %q or %q", c.DbnamePlacement, dbnamePlacementBody, dbnamePlacementPath)
+    }
+
+    if len(c.Engine) == 0 {
+        c.Engine = engineMySQL
+    }
+    if !validEngine(c.Engine) {
+        return fmt.Errorf("invalid engine %q: must be %q, %q or %q", c.Engine, engineMySQL, engineMariaDB, enginePercona)
+    }
+
+    if len(c.UsernameCase) > 0 && !validUsernameCase(c.UsernameCase) {
+        return fmt.Errorf("invalid username_case %q: must be %q, %q or %q", c.UsernameCase, usernameCaseUpper, usernameCaseLower, usernameCasePreserve)
+    }
+
+    switch c.CidPlacement {
+    case "":
+        c.CidPlacement = cidPlacementBody
+    case cidPlacementBody, cidPlacementHeader, cidPlacementBoth:
+    default:
+        return fmt.Errorf("invalid cid_placement %q: must be %q, %q or %q", c.CidPlacement, cidPlacementBody, cidPlacementHeader, cidPlacementBoth)
+    }
+
+    if len(c.HostField) == 0 {
+        c.HostField = defaultHostField
+    }
+    if len(c.PortField) == 0 {
+        c.PortField = defaultPortField
+    }
+    if len(c.DatabaseField) == 0 {
+        c.DatabaseField = defaultDatabaseField
+    }
+
+    tokenSources := 0
+    for _, source := range []string{c.Token, c.TokenFile, c.TokenKVRef} {
+        if len(source) > 0 {
+            tokenSources++
+        }
+    }
+    if tokenSources > 1 {
+        return errors.New("only one of token, token_file and token_kv_ref may be set")
+    }
+    if _, ok := initConfig["token_cache_ttl"]; !ok {
+        c.TokenCacheTTL = defaultTokenCacheTTL
+    }
+    if c.TokenRefreshRetries < 0 {
+        return fmt.Errorf("invalid token_refresh_retries %d: must not be negative", c.TokenRefreshRetries)
+    }
+    c.reauth, err = newReauthRedirect(c.ReauthRedirectLocation, c.ReauthRedirectStatus)
+    if err != nil {
+        return err
+    }
+    if c.TokenCacheTTL < 0 {
+        return fmt.Errorf("invalid token_cache_ttl %d: must not be negative", c.TokenCacheTTL)
+    }
+    if len(c.TokenKVRef) > 0 {
+        if _, _, err := parseKVRef(c.TokenKVRef); err != nil {
+            return err
+        }
+        if c.kvSource == nil {
+            return errors.New("token_kv_ref is set but no KV source is configured")
+        }
+    }
+
+    switch strings.ToUpper(c.HealthMethod) {
+    case "":
+        c.HealthMethod = http.MethodGet
+    case http.MethodGet, http.MethodHead:
+        c.HealthMethod = strings.ToUpper(c.HealthMethod)
+    default:
+        return fmt.Errorf("invalid health_method %q: must be %q or %q", c.HealthMethod, http.MethodGet, http.MethodHead)
+    }
+    if c.HealthExpectedStatus == 0 {
+        c.HealthExpectedStatus = http.StatusOK
+    }
+    if c.HealthExpectedStatus < 100 || c.HealthExpectedStatus > 599 {
+        return fmt.Errorf("invalid health_expected_status %d", c.HealthExpectedStatus)
+    }
+
+    if err := c.configureSigning(); err != nil {
+        return err
+    }
+
+    if c.MaxClockSkew < 0 {
+        return fmt.Errorf("invalid max_clock_skew %d: must not be negative", c.MaxClockSkew)
+    }
+    if len(c.ClockSkewHeader) == 0 {
+        c.ClockSkewHeader = defaultClockSkewHeader
+    }
+    switch c.ClockSkewAction {
+    case "":
+        c.ClockSkewAction = clockSkewWarn
+    case clockSkewWarn, clockSkewFail:
+    default:
+        return fmt.Errorf("invalid clock_skew_action %q: must be %q or %q", c.ClockSkewAction, clockSkewWarn, clockSkewFail)
+    }
+
+    if c.PostInitDelay < 0 {
+        return fmt.Errorf("invalid post_init_delay %d: must not be negative", c.PostInitDelay)
+    }
     //if len(c.ConnectionURL) == 0 {
     c.ConnectionURL = os.Getenv(vaultMysqlDb)
     //}
 
-    c.Initialized = true
+    if c.BreakerThreshold < 0 {
+        return fmt.Errorf("invalid breaker_threshold %d: must not be negative", c.BreakerThreshold)
+    }
+    if c.BreakerCooldown <= 0 {
+        c.BreakerCooldown = defaultBreakerCooldown
+    }
+    for i, be := range c.BackendURLs {
+        if _, err := url.Parse(be.URL); err != nil || len(be.URL) == 0 {
+            return fmt.Errorf("invalid backend_urls[%d] url %q", i, be.URL)
+        }
+        if be.Weight <= 0 {
+            return fmt.Errorf("invalid backend_urls[%d] weight %d: must be positive", i, be.Weight)
+        }
+    }
+    backends := c.BackendURLs
+    if len(backends) == 0 {
+        backends = []backendURL{{URL: c.ConnectionURL, Weight: 1}}
+    }
+    if _, ok := initConfig["require_tls"]; !ok {
+        c.RequireTLS = true
+    }
+    for _, be := range backends {
+        u, err := url.Parse(be.URL)
+        if err != nil {
+            continue
+        }
+        if u.Scheme == unixScheme {
+            if err := validateSocketURL(u); err != nil {
+                return err
+            }
+            continue
+        }
+        if err := c.checkTLS(u); err != nil {
+            return err
+        }
+    }
+    c.balancer = newBalancer(backends, c.BreakerThreshold, c.BreakerCooldown*time.Second, c.clock)
+    return nil
+}
 
-    return initConfig, nil
+// checkTLS fails when require_tls is set and u isn't an https url.
+func (c *mgtvMysqlConnectionProducer) checkTLS(u *url.URL) error {
+    if !c.RequireTLS || u.Scheme == "https" {
+        return nil
+    }
+    return fmt.Errorf("backend url %q must be https while require_tls is set; set require_tls=false to allow plain http", u.Redacted())
 }
 
 func (c *mgtvMysqlConnectionProducer) Initialize(ctx context.Context, config map[string]interface{}, verifyConnection bool) error {
     _, err := c.Init(ctx, config, verifyConnection)
-    c.initHttpConnPool()
+    if err != nil {
+        return err
+    }
+    c.RLock()
+    defer c.RUnlock()
+    if verifyConnection {
+        if err := c.verifyConnection(ctx); err != nil {
+            return err
+        }
+    }
+    if c.MaxClockSkew > 0 {
+        if err := c.checkClockSkew(ctx); err != nil {
+            if c.ClockSkewAction == clockSkewFail {
+                return err
+            }
+            c.logger.Warn("clock skew check failed, expiry may take effect early or late", "error", err)
+        }
+    }
+    if c.VerifyTokenScopes {
+        if err := c.verifyTokenScopes(ctx); err != nil {
+            return err
+        }
+    }
+    if c.InitCanary {
+        if err := c.runCanary(ctx); err != nil {
+            return err
+        }
+    }
+    c.startPostInitDelay()
+    return nil
+}
+
+// newHTTPClient builds the client for the current configuration. It is only
+// published once fully constructed.
+func (c *mgtvMysqlConnectionProducer) newHTTPClient() *http.Client {
+    transport := &http.Transport{
+        DialContext:       c.retryDial(socketDial(c.dialer().DialContext, c.socketPaths())),
+        MaxIdleConns:      c.MaxIdleConns,
+        DisableKeepAlives: c.DisableKeepAlives,
+        IdleConnTimeout:   c.IdleConnTimeout * time.Second,
+        TLSClientConfig:   c.tlsConfig(),
+        // A custom dialer and TLS config turn off HTTP/2 unless forced.
+        ForceAttemptHTTP2: !c.DisableHTTP2,
+    }
+    if c.DisableHTTP2 {
+        // A non-nil empty map stops the transport from negotiating h2.
+        transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+    }
+    client := &http.Client{
+        Timeout:   c.RequestTimeout * time.Second,
+        Transport: transport,
+    }
+    if c.reauth != nil {
+        client.CheckRedirect = c.reauth.checkRedirect
+    }
+    if c.EnableCookies {
+        if c.cookieJar == nil {
+            // cookiejar.New only fails for options it is never given here.
+            c.cookieJar, _ = cookiejar.New(nil)
+        }
+        client.Jar = c.cookieJar
+    }
+    return client
+}
+
+// client returns the client published by the last successful Init.
+func (c *mgtvMysqlConnectionProducer) client() *http.Client {
+    c.clientLock.RLock()
+    defer c.clientLock.RUnlock()
+    if c.httpClient == nil {
+        return &http.Client{}
+    }
+    return c.httpClient
+}
+
+// dialer returns the net.Dialer used for outgoing backend connections, bound to
+// local_address when one is configured.
+func (c *mgtvMysqlConnectionProducer) dialer() *net.Dialer {
+    d := &net.Dialer{
+        Timeout:   c.ConnectTimeout * time.Second,
+        KeepAlive: c.KeepAlive * time.Second,
+    }
+    if ip := net.ParseIP(c.LocalAddress); ip != nil {
+        d.LocalAddr = &net.TCPAddr{IP: ip}
+    }
+    return d
+}
+
+// dialFunc matches net.Dialer.DialContext.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// retryDial wraps dial so that a failed connect is retried up to
+// connect_retries times, independently of request level retries, backing off
+// between retry_min_delay and retry_max_delay.
+func (c *mgtvMysqlConnectionProducer) retryDial(dial dialFunc) dialFunc {
+    retries := c.ConnectRetries
+    if retries <= 0 {
+        return dial
+    }
+    minDelay := time.Duration(c.RetryMinDelay) * time.Millisecond
+    maxDelay := time.Duration(c.RetryMaxDelay) * time.Millisecond
+    return func(ctx context.Context, network, addr string) (net.Conn, error) {
+        var failed []error
+        for attempt := 0; ; attempt++ {
+            conn, err := dial(ctx, network, addr)
+            if err == nil {
+                return conn, nil
+            }
+            failed = append(failed, err)
+            if attempt >= retries {
+                return nil, joinErrors(failed...)
+            }
+            c.logger.Debug("connect failed, retrying", "addr", addr, "attempt", attempt+1, "error", err)
+            select {
+            case <-ctx.Done():
+                return nil, joinErrors(failed...)
+            case <-c.clock.After(backoff(attempt, minDelay, maxDelay)):
+            }
+        }
+    }
+}
+
+// requestURL builds the url under base a request for action is sent to,
+// applying a path override when path is set, then action_placement and
+// dbname_placement.
+func (c *mgtvMysqlConnectionProducer) requestURL(base, path string, action backendAction, body map[string]interface{}) (string, error) {
+    u, err := parseBackendURL(base)
+    if err != nil {
+        return "", fmt.Errorf("invalid connection_url: %w", err)
+    }
+    if len(path) > 0 {
+        u, err = withPath(u, path)
+        if err != nil {
+            return "", fmt.Errorf("invalid %s url: %w", overridesField, err)
+        }
+    }
+    if c.DbnamePlacement == dbnamePlacementPath {
+        dbname, _ := body["dbname"].(string)
+        if len(dbname) == 0 {
+            return "", fmt.Errorf("dbname is required when dbname_placement is %q", dbnamePlacementPath)
+        }
+        joinPath(u, "db/"+dbname+"/users", "db/"+url.PathEscape(dbname)+"/users")
+    }
+    if c.ActionPlacement == actionPlacementQuery {
+        query := u.Query()
+        query.Set(c.wireName("action"), string(action))
+        u.RawQuery = query.Encode()
+    }
+    return u.String(), nil
+}
+
+// pickBackend returns the backend the next request is sent to: one of
+// backend_urls when configured, or connection_url otherwise.
+func (c *mgtvMysqlConnectionProducer) pickBackend() (*backend, error) {
+    if c.balancer == nil {
+        return &backend{url: c.ConnectionURL}, nil
+    }
+    return c.balancer.pick()
+}
+
+func (c *mgtvMysqlConnectionProducer) reportBackend(be *backend, ok bool) {
+    if c.balancer != nil {
+        c.balancer.report(be, ok)
+    }
+}
+
+// backendURLs returns every URL requests may be sent to.
+func (c *mgtvMysqlConnectionProducer) backendURLs() []string {
+    if c.balancer == nil {
+        return []string{c.ConnectionURL}
+    }
+    return c.balancer.urls()
+}
+
+// post sends body to the backend for the given action. The action is carried in
+// the body or as a query parameter depending on action_placement. When
+// rendered is set it is sent verbatim instead, and body only informs the url
+// and headers. stamp is the replay_protection stamp of the call. body itself
+// is not modified.
+func (c *mgtvMysqlConnectionProducer) post(ctx context.Context, action backendAction, body map[string]interface{}, rendered *renderedBody, stamp replayStamp) (*http.Response, error) {
+    body = copyBody(body)
+    // A url overriding the mount config bypasses the balancer.
+    overrides := overridesFrom(ctx)
+    be := &backend{url: overrides.url}
+    var err error
+    if len(be.url) == 0 {
+        be, err = c.pickBackend()
+        if err != nil {
+            return nil, err
+        }
+    }
+    target, err := c.requestURL(be.url, overrides.path, action, body)
+    if err != nil {
+        return nil, err
+    }
+    if rendered == nil && c.ActionPlacement == actionPlacementQuery {
+        delete(body, "action")
+    } else if rendered == nil {
+        body["action"] = string(action)
+    }
+    header := make(http.Header)
+    header.Set("Content-Type", jsonContentType)
+    if c.CidPlacement == cidPlacementHeader || c.CidPlacement == cidPlacementBoth {
+        cid := resultString(body, "cid")
+        if len(cid) == 0 {
+            return nil, fmt.Errorf("cid is required when cid_placement is %q", c.CidPlacement)
+        }
+        header.Set(tenantHeader, cid)
+        if c.CidPlacement == cidPlacementHeader {
+            delete(body, "cid")
+        }
+    }
+    stamp.set(header)
+    var marshal []byte
+    if rendered != nil {
+        marshal = rendered.wire
+        c.writeDebugSinkRendered(rendered.redacted)
+        c.traceRendered(action, rendered.redacted, resultString(body, "username"))
+    } else if c.BatchBody == batchBodyNDJSON && actionSpecs[action].batch {
+        lines := c.ndjsonLines(c.wireBody(body))
+        marshal, err = encodeNDJSON(lines)
+        if err != nil {
+            return nil, err
+        }
+        header.Set("Content-Type", ndjsonContentType)
+        for _, line := range lines {
+            c.writeDebugSink(line)
+            c.traceBody(action, line)
+        }
+    } else {
+        wire := c.wireBody(body)
+        // encoding/json sorts map keys at every level, so the same logical
+        // body always yields the same bytes, and anything computed over them,
+        // such as a signature, is reproducible.
+        marshal, err = json.Marshal(wire)
+        if err != nil {
+            return nil, err
+        }
+        c.writeDebugSink(wire)
+        c.traceBody(action, wire)
+    }
+    c.sign(header, stamp, marshal)
+    var failed []error
+    for attempt := 1; ; attempt++ {
+        response, err := c.attempt(ctx, target, marshal, header)
+        // Backends behind some load balancers drop idle keep-alive connections
+        // without a graceful close. Retrying these once on a fresh connection
+        // is safe for the keyed requests the backend receives, unless
+        // retry_actions says otherwise.
+        if err != nil && attempt == 1 && ctx.Err() == nil && isRetryable(err) && c.retryable(action) {
+            c.logger.Debug("backend dropped the connection, retrying", "action", action, "error", err)
+            pluginMetrics.retry()
+            failed = append(failed, err)
+            continue
+        }
+        c.reportBackend(be, err == nil && response.StatusCode < 500)
+        if err != nil {
+            // Report every attempt, not just the last.
+            return nil, joinErrors(append(failed, err)...)
+        }
+        return response, nil
+    }
+}
+
+// retryable reports whether requests for action may be resent. Creates aren't
+// unless retry_actions lists them, leaving a lost create response to
+// on_ambiguous_create.
+func (c *mgtvMysqlConnectionProducer) retryable(action backendAction) bool {
+    if c.retryActions == nil {
+        return !actionSpecs[action].creates
+    }
+    return c.retryActions[action]
+}
+
+// attemptTimeout returns how long the next attempt may take, or zero when it
+// is only bounded by ctx. When both attempt_timeout and
+// per_attempt_timeout_pct apply, the shorter one wins.
+func (c *mgtvMysqlConnectionProducer) attemptTimeout(ctx context.Context) time.Duration {
+    timeout := c.AttemptTimeout * time.Second
+    if deadline, ok := ctx.Deadline(); ok && c.PerAttemptTimeoutPct > 0 {
+        share := deadline.Sub(c.clock.Now()) * time.Duration(c.PerAttemptTimeoutPct) / 100
+        if share <= 0 {
+            share = time.Nanosecond
+        }
+        if timeout == 0 || share < timeout {
+            timeout = share
+        }
+    }
+    return timeout
+}
+
+// attempt sends a single request. When attempt_timeout or
+// per_attempt_timeout_pct is set the attempt, including reading the response
+// body, is bounded by it as well as by ctx. A timeout in the connection
+// overrides of ctx replaces the client timeout.
+func (c *mgtvMysqlConnectionProducer) attempt(ctx context.Context, target string, body []byte, header http.Header) (*http.Response, error) {
+    cancel := context.CancelFunc(func() {})
+    if timeout := c.attemptTimeout(ctx); timeout > 0 {
+        ctx, cancel = context.WithTimeout(ctx, timeout)
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+    if err != nil {
+        cancel()
+        return nil, err
+    }
+    for k, v := range header {
+        req.Header[k] = v
+    }
+    req.Header.Set("Accept-Encoding", acceptEncoding)
+    if isSocketHost(req.URL.Hostname()) {
+        req.Host = socketHostHeader
+    }
+    client := *c.client()
+    if o := overridesFrom(ctx); o.timeout > 0 {
+        client.Timeout = o.timeout
+    }
+    response, err := client.Do(req)
+    if err != nil {
+        cancel()
+        return nil, err
+    }
+    response.Body = cancelOnClose{ReadCloser: response.Body, cancel: cancel}
+    return response, nil
+}
+
+// cancelOnClose releases the attempt context once the response body is closed.
+type cancelOnClose struct {
+    io.ReadCloser
+    cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+    err := b.ReadCloser.Close()
+    b.cancel()
     return err
 }
 
-func (c *mgtvMysqlConnectionProducer) initHttpConnPool() {
-    c.httpClient = http.Client{
-        Timeout: c.Timeout * time.Second,
-        Transport: &http.Transport{
-            DialContext: (&net.Dialer{
-                Timeout:   c.Timeout * time.Second,
-                KeepAlive: c.KeepAlive * time.Second,
-            }).DialContext,
-            MaxIdleConns:    c.MaxIdleConns,
-            IdleConnTimeout: c.IdleConnTimeout * time.Second,
-        },
+// newNonce returns a random hex encoded nonce.
+func newNonce() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", fmt.Errorf("failed to generate nonce: %w", err)
+    }
+    return hex.EncodeToString(b), nil
+}
+
+// isConnectionDropped reports whether err is a transport error caused by the
+// peer closing the connection abruptly.
+func isConnectionDropped(err error) bool {
+    return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// invoke posts body for action and decodes the backend result, returning an
+// error when the http status or the result status reports a failure. The
+// decoded result is returned alongside a failed result status so that callers
+// can inspect partial outcomes. It must be called with the lock held, for
+// reading at least.
+func (c *mgtvMysqlConnectionProducer) invoke(ctx context.Context, action backendAction, body map[string]interface{}) (map[string]interface{}, error) {
+    return c.invokeRendered(ctx, action, body, nil)
+}
+
+// invokeRendered is like invoke, sending rendered instead of body when set.
+func (c *mgtvMysqlConnectionProducer) invokeRendered(ctx context.Context, action backendAction, body map[string]interface{}, rendered *renderedBody) (result map[string]interface{}, err error) {
+    // Waiting out post_init_delay or rate_limit doesn't count towards the
+    // call's latency.
+    if err := c.waitReady(ctx); err != nil {
+        return nil, err
+    }
+    if err := c.waitRateLimit(ctx); err != nil {
+        return nil, err
+    }
+    defer pluginMetrics.begin(string(action))()
+    var httpStatus int
+    var respBody []byte
+    defer func() { c.recordTraffic(action, body, rendered, httpStatus, respBody, err) }()
+    start := c.clock.Now()
+    defer func() {
+        took := c.clock.Now().Sub(start)
+        c.latency.record(string(action), took)
+        c.reportSlowCall(action, body, took)
+    }()
+
+    ctx, cancel := c.operationContext(ctx)
+    defer cancel()
+    stamp, err := c.newReplayStamp()
+    if err != nil {
+        return nil, err
+    }
+    response, err := c.post(ctx, action, body, rendered, stamp)
+    // A rendered body has the token baked in, so it can't be resent with a
+    // refreshed one.
+    if err == nil && rendered == nil {
+        response, err = c.retryUnauthorized(ctx, action, body, stamp, response)
+    }
+    if err != nil {
+        pluginMetrics.failure(errClassTransport)
+        if c.closed() {
+            return nil, errClosed
+        }
+        return nil, unreachable(err)
+    }
+    defer response.Body.Close()
+    httpStatus = response.StatusCode
+    if err := c.checkAPIVersion(response); err != nil {
+        pluginMetrics.failure(errClassBackend)
+        return nil, err
+    }
+    if len(c.SuccessHeader) > 0 {
+        return c.headerResult(response)
+    }
+    if response.StatusCode != 200 {
+        pluginMetrics.failure(errClassHTTPStatus)
+        return nil, &statusError{code: response.StatusCode, reauth: c.reauth.matches(response)}
+    }
+    respBody, err = c.readResponse(response)
+    if errors.Is(err, errIncompleteResponse) && ctx.Err() == nil && c.retryable(action) {
+        c.logger.Debug("backend response was cut short, retrying", "action", action, "error", err)
+        pluginMetrics.retry()
+        first := err
+        httpStatus, respBody, err = c.resend(ctx, action, body, rendered, stamp)
+        if err != nil {
+            err = joinErrors(first, err)
+        }
+    }
+    if err != nil {
+        pluginMetrics.failure(errClassDecode)
+        if c.closed() {
+            return nil, errClosed
+        }
+        return nil, err
+    }
+    result = make(map[string]interface{})
+    err = json.Unmarshal(respBody, &result)
+    if err != nil {
+        pluginMetrics.failure(errClassDecode)
+        return nil, err
+    }
+    if c.StrictResponse {
+        if err := c.checkResponseFields(action, result); err != nil {
+            pluginMetrics.failure(errClassDecode)
+            return nil, err
+        }
+    }
+    status, ok := result["status"].(float64)
+    if !ok {
+        pluginMetrics.failure(errClassDecode)
+        return nil, errors.New("response does not contain a status")
+    }
+    if status != 0 {
+        pluginMetrics.failure(errClassBackend)
+        return result, &BackendError{HTTPStatus: response.StatusCode, Status: int(status), Message: resultString(result, "error")}
+    }
+    return result, nil
+}
+
+// resend posts body for action again after its response was cut short, and
+// reads the new response.
+func (c *mgtvMysqlConnectionProducer) resend(ctx context.Context, action backendAction, body map[string]interface{}, rendered *renderedBody, stamp replayStamp) (int, []byte, error) {
+    response, err := c.post(ctx, action, body, rendered, stamp)
+    if err != nil {
+        return 0, nil, err
+    }
+    defer response.Body.Close()
+    if err := c.checkAPIVersion(response); err != nil {
+        return response.StatusCode, nil, err
+    }
+    if response.StatusCode != 200 {
+        return response.StatusCode, nil, &statusError{code: response.StatusCode}
+    }
+    respBody, err := c.readResponse(response)
+    return response.StatusCode, respBody, err
+}
+
+// headerResult decides the outcome of a call from success_header instead of
+// the http status and the result status. A JSON body, when present, is still
+// decoded so that response fields can be captured.
+func (c *mgtvMysqlConnectionProducer) headerResult(response *http.Response) (map[string]interface{}, error) {
+    result := make(map[string]interface{})
+    respBody, err := c.readResponse(response)
+    if err != nil {
+        pluginMetrics.failure(errClassDecode)
+        return nil, err
+    }
+    if len(bytes.TrimSpace(respBody)) > 0 {
+        if err := json.Unmarshal(respBody, &result); err != nil {
+            c.logger.Debug("ignoring undecodable response body", "error", err)
+        }
+    }
+    value := response.Header.Get(c.SuccessHeader)
+    if strings.EqualFold(strings.TrimSpace(value), c.SuccessValue) {
+        return result, nil
+    }
+    pluginMetrics.failure(errClassBackend)
+    if detail := response.Header.Get(c.ErrorHeader); len(c.ErrorHeader) > 0 && len(detail) > 0 {
+        return result, errors.New(detail)
+    }
+    return result, fmt.Errorf("%s: %q", c.SuccessHeader, value)
+}
+
+// readResponse reads the response body like readBody, within
+// response_read_timeout when one is set, so that a backend trickling bytes
+// can't hold the call beyond it.
+func (c *mgtvMysqlConnectionProducer) readResponse(response *http.Response) ([]byte, error) {
+    if c.ResponseReadTimeout <= 0 {
+        return readBody(response)
+    }
+    done := make(chan struct{})
+    expired := make(chan struct{})
+    go func() {
+        select {
+        case <-c.clock.After(c.ResponseReadTimeout * time.Second):
+            close(expired)
+            response.Body.Close()
+        case <-done:
+        }
+    }()
+    body, err := readBody(response)
+    close(done)
+    select {
+    case <-expired:
+        return nil, fmt.Errorf("reading the response body took longer than response_read_timeout %ds", c.ResponseReadTimeout)
+    default:
+    }
+    return body, err
+}
+
+// readBody reads the response body, decoding it according to its
+// Content-Encoding.
+func readBody(response *http.Response) ([]byte, error) {
+    raw, err := ioutil.ReadAll(response.Body)
+    if err != nil && isConnectionDropped(err) {
+        return nil, &incompleteResponseError{received: len(raw), err: err}
+    }
+    if err != nil {
+        return nil, err
+    }
+    encoding := strings.ToLower(strings.TrimSpace(response.Header.Get("Content-Encoding")))
+    switch encoding {
+    case "", "identity":
+        return raw, nil
+    case "gzip", "x-gzip":
+        reader, err := gzip.NewReader(bytes.NewReader(raw))
+        if err != nil {
+            return nil, fmt.Errorf("decode gzip response: %w", err)
+        }
+        defer reader.Close()
+        return ioutil.ReadAll(reader)
+    case "deflate":
+        // deflate is specified as zlib-wrapped, but some servers send a raw
+        // deflate stream, so fall back to that when the zlib header is absent.
+        reader, err := zlib.NewReader(bytes.NewReader(raw))
+        if err != nil {
+            reader = flate.NewReader(bytes.NewReader(raw))
+        }
+        defer reader.Close()
+        return ioutil.ReadAll(reader)
+    default:
+        return nil, fmt.Errorf("unsupported response Content-Encoding %q", encoding)
     }
 }
@@ -0,0 +1,475 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "bytes"
+    "compress/flate"
+    "compress/gzip"
+    "compress/zlib"
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestLocalAddress(t *testing.T) {
+    backend := newFakeBackend(t)
+    tests := []struct {
+        name    string
+        address string
+        wantErr string
+    }{
+        {name: "unset"},
+        {name: "ipv4", address: "127.0.0.1"},
+        {name: "not an ip", address: "localhost", wantErr: "invalid local_address"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            config := map[string]interface{}{"local_address": tt.address}
+            if len(tt.wantErr) > 0 {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+            addr, _ := db.dialer().LocalAddr.(*net.TCPAddr)
+            switch {
+            case len(tt.address) == 0 && addr != nil:
+                t.Fatalf("dialer LocalAddr = %v, want none", addr)
+            case len(tt.address) > 0 && (addr == nil || addr.IP.String() != tt.address):
+                t.Fatalf("dialer LocalAddr = %v, want %s", addr, tt.address)
+            }
+            if _, err := newUser(db, "role", testCreateStatement); err != nil {
+                t.Fatalf("NewUser: %v", err)
+            }
+        })
+    }
+}
+
+func TestActionPlacement(t *testing.T) {
+    tests := []struct {
+        name      string
+        placement string
+        wantQuery bool
+        wantErr   string
+    }{
+        {name: "default"},
+        {name: "body", placement: "body"},
+        {name: "query", placement: "query", wantQuery: true},
+        {name: "invalid", placement: "header", wantErr: "invalid action_placement"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"action_placement": tt.placement}
+            if len(tt.wantErr) > 0 {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+            username, err := newUser(db, "role", testCreateStatement)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if err := deleteUser(db, username, testDeleteStatement); err != nil {
+                t.Fatal(err)
+            }
+            for _, action := range []backendAction{actionAddUser, actionDelUser} {
+                req := backend.received(action)[0]
+                _, inBody := req.Body["action"]
+                inQuery := req.Query.Get("action") == string(action)
+                if inQuery != tt.wantQuery || inBody == tt.wantQuery {
+                    t.Errorf("%s: action in query %v, in body %v; want it in the query: %v", action, inQuery, inBody, tt.wantQuery)
+                }
+            }
+        })
+    }
+}
+
+func TestResponseEncoding(t *testing.T) {
+    compress := func(newWriter func(w io.Writer) io.WriteCloser) func(body []byte) []byte {
+        return func(body []byte) []byte {
+            var buf bytes.Buffer
+            w := newWriter(&buf)
+            w.Write(body)
+            w.Close()
+            return buf.Bytes()
+        }
+    }
+    tests := []struct {
+        name     string
+        encoding string
+        encode   func(body []byte) []byte
+        wantErr  string
+    }{
+        {name: "identity", encode: func(body []byte) []byte { return body }},
+        {name: "gzip", encoding: "gzip", encode: compress(func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) })},
+        {name: "zlib deflate", encoding: "deflate", encode: compress(func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) })},
+        {name: "raw deflate", encoding: "Deflate", encode: compress(func(w io.Writer) io.WriteCloser {
+            fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+            return fw
+        })},
+        {name: "unsupported", encoding: "br", encode: func(body []byte) []byte { return body }, wantErr: `unsupported response Content-Encoding "br"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, nil)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(actionAddUser) {
+                    return false
+                }
+                body, _ := json.Marshal(map[string]interface{}{"status": 0, "username": req.Body["username"], "account_id": "a1"})
+                if len(tt.encoding) > 0 {
+                    w.Header().Set("Content-Encoding", tt.encoding)
+                }
+                w.Write(tt.encode(body))
+                return true
+            })
+
+            _, err := newUser(db, "role", testCreateStatement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got := backend.received(actionAddUser)[0].Header.Get("Accept-Encoding"); got != acceptEncoding {
+                t.Fatalf("Accept-Encoding = %q, want %q", got, acceptEncoding)
+            }
+        })
+    }
+}
+
+func TestCidPlacement(t *testing.T) {
+    tests := []struct {
+        name       string
+        placement  string
+        statement  string
+        wantBody   bool
+        wantHeader bool
+        wantErr    string
+    }{
+        {name: "default", statement: testCreateStatement, wantBody: true},
+        {name: "body", placement: "body", statement: testCreateStatement, wantBody: true},
+        {name: "header", placement: "header", statement: testCreateStatement, wantHeader: true},
+        {name: "both", placement: "both", statement: testCreateStatement, wantBody: true, wantHeader: true},
+        {name: "header without cid", placement: "header", statement: `{"dbname":"d1"}`, wantErr: `cid is required when cid_placement is "header"`},
+        {name: "both without cid", placement: "both", statement: `{"dbname":"d1"}`, wantErr: `cid is required when cid_placement is "both"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, map[string]interface{}{"cid_placement": tt.placement})
+            _, err := newUser(db, "role", tt.statement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                if sent := backend.received(actionAddUser); len(sent) > 0 {
+                    t.Fatalf("%d creates sent, want none", len(sent))
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            req := backend.received(actionAddUser)[0]
+            if _, inBody := req.Body["cid"]; inBody != tt.wantBody {
+                t.Errorf("cid in body %v, want %v", inBody, tt.wantBody)
+            }
+            header := req.Header.Get(tenantHeader)
+            if tt.wantHeader && header != "c1" || !tt.wantHeader && len(header) > 0 {
+                t.Errorf("%s header %q, want it set: %v", tenantHeader, header, tt.wantHeader)
+            }
+        })
+    }
+}
+
+func TestInvalidCidPlacement(t *testing.T) {
+    backend := newFakeBackend(t)
+    err := initError(t, backend.URL, map[string]interface{}{"cid_placement": "query"})
+    if err == nil || !strings.Contains(err.Error(), "invalid cid_placement") {
+        t.Fatalf("Initialize error = %v, want invalid cid_placement", err)
+    }
+}
+
+func TestConnectRetries(t *testing.T) {
+    tests := []struct {
+        name    string
+        retries int
+        // failures is how many dials fail before one succeeds.
+        failures  int
+        wantDials int
+        wantErr   bool
+    }{
+        {name: "first dial succeeds", retries: 2, wantDials: 1},
+        {name: "retried dial succeeds", retries: 2, failures: 1, wantDials: 2},
+        {name: "last retry succeeds", retries: 2, failures: 2, wantDials: 3},
+        {name: "retries exhausted", retries: 2, failures: 3, wantDials: 3, wantErr: true},
+        {name: "disabled", failures: 1, wantDials: 1, wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, map[string]interface{}{
+                "connect_retries": tt.retries,
+                "retry_min_delay": 1,
+                "retry_max_delay": 1,
+            })
+            dials := 0
+            dial := db.retryDial(func(ctx context.Context, network, addr string) (net.Conn, error) {
+                dials++
+                if dials <= tt.failures {
+                    return nil, fmt.Errorf("dial %d: no such host", dials)
+                }
+                return (&net.Dialer{}).DialContext(ctx, network, addr)
+            })
+
+            conn, err := dial(context.Background(), "tcp", backend.Listener.Addr().String())
+            if conn != nil {
+                conn.Close()
+            }
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("dial error = %v, want an error: %v", err, tt.wantErr)
+            }
+            if err != nil && !strings.Contains(err.Error(), fmt.Sprintf("dial %d", tt.failures)) {
+                t.Errorf("dial error %q doesn't carry the last failure", err)
+            }
+            if dials != tt.wantDials {
+                t.Fatalf("%d dials, want %d", dials, tt.wantDials)
+            }
+        })
+    }
+}
+
+func TestDisableKeepAlives(t *testing.T) {
+    tests := []struct {
+        name    string
+        disable bool
+        // wantConns is how many connections the requests came on.
+        wantConns int
+    }{
+        {name: "reused", wantConns: 1},
+        {name: "disabled", disable: true, wantConns: 5},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, map[string]interface{}{"disable_keep_alives": tt.disable})
+            for i := 0; i < 5; i++ {
+                if err := deleteUser(db, "V_USER_R", testDeleteStatement); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            conns := make(map[string]bool)
+            for _, req := range backend.received(actionDelUser) {
+                conns[req.RemoteAddr] = true
+            }
+            if len(conns) != tt.wantConns {
+                t.Fatalf("requests came on %d connections, want %d", len(conns), tt.wantConns)
+            }
+        })
+    }
+}
+
+func TestDisableHTTP2(t *testing.T) {
+    srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, map[string]interface{}{"status": 0})
+    }))
+    srv.EnableHTTP2 = true
+    srv.StartTLS()
+    t.Cleanup(srv.Close)
+
+    tests := []struct {
+        name      string
+        disable   bool
+        wantProto string
+    }{
+        {name: "default", wantProto: "HTTP/2.0"},
+        {name: "disabled", disable: true, wantProto: "HTTP/1.1"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, map[string]interface{}{"disable_http2": tt.disable})
+            client := db.newHTTPClient()
+            transport := client.Transport.(*http.Transport)
+            // Trust the test server's certificate, which isn't among the
+            // system roots.
+            transport.TLSClientConfig = &tls.Config{RootCAs: x509.NewCertPool()}
+            transport.TLSClientConfig.RootCAs.AddCert(srv.Certificate())
+            defer transport.CloseIdleConnections()
+
+            resp, err := client.Get(srv.URL)
+            if err != nil {
+                t.Fatal(err)
+            }
+            resp.Body.Close()
+            if resp.Proto != tt.wantProto {
+                t.Fatalf("negotiated %s, want %s", resp.Proto, tt.wantProto)
+            }
+        })
+    }
+}
+
+// TestInitRejectedConfig checks that a config failing validation leaves the
+// plugin on the previous one, not on a mix of the two.
+func TestInitRejectedConfig(t *testing.T) {
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+    }{
+        // dbname_placement is applied before engine is rejected.
+        {name: "invalid engine", config: map[string]interface{}{"dbname_placement": "path", "engine": "bogus"}},
+        // max_statement_bytes is applied before cid_placement is rejected.
+        {name: "invalid cid_placement", config: map[string]interface{}{"max_statement_bytes": 10, "cid_placement": "bogus"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, nil)
+            _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: testConfig(tt.config)})
+            if err == nil {
+                t.Fatal("Initialize succeeded")
+            }
+            if !db.IsHealthy() {
+                t.Fatal("plugin is unhealthy after a rejected config")
+            }
+            if _, err := newUser(db, "role", testCreateStatement); err != nil {
+                t.Fatalf("NewUser: %v", err)
+            }
+            if path := backend.received(actionAddUser)[0].Path; path != "/" {
+                t.Fatalf("create sent to %q, want /", path)
+            }
+        })
+    }
+}
+
+// TestConcurrentInitialize interleaves config reloads with operations. Run it
+// with -race.
+func TestConcurrentInitialize(t *testing.T) {
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, nil)
+    configs := []map[string]interface{}{
+        testConfig(map[string]interface{}{"action_placement": "query", "field_names": map[string]interface{}{"dbname": "db"}}),
+        testConfig(map[string]interface{}{"action_placement": "body", "password_max_length": 32}),
+    }
+
+    ctx := context.Background()
+    var wg sync.WaitGroup
+    errs := make(chan error, 100)
+    for i := 0; i < 10; i++ {
+        wg.Add(1)
+        go func(i int) {
+            defer wg.Done()
+            if _, err := db.Initialize(ctx, dbplugin.InitializeRequest{Config: configs[i%len(configs)]}); err != nil {
+                errs <- fmt.Errorf("Initialize: %w", err)
+            }
+        }(i)
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            username, err := newUser(db, "role", testCreateStatement)
+            if err != nil {
+                errs <- fmt.Errorf("NewUser: %w", err)
+                return
+            }
+            if _, err := db.RotatePassword(ctx, username, statements(testDeleteStatement)); err != nil {
+                errs <- fmt.Errorf("RotatePassword: %w", err)
+            }
+            if err := deleteUser(db, username, testDeleteStatement); err != nil {
+                errs <- fmt.Errorf("DeleteUser: %w", err)
+            }
+        }()
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            if _, err := db.Capabilities(ctx); err != nil {
+                errs <- fmt.Errorf("Capabilities: %w", err)
+            }
+            db.IsHealthy()
+            db.RecentTraffic()
+        }()
+    }
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        t.Error(err)
+    }
+}
+
+func TestConnectRequestTimeout(t *testing.T) {
+    tests := []struct {
+        name        string
+        config      map[string]interface{}
+        wantConnect time.Duration
+        wantRequest time.Duration
+        // slow has the backend answer after 1.5s, which only request_timeout
+        // bounds.
+        slow     bool
+        wantErr  bool
+        wantInit string
+    }{
+        {name: "defaults", wantConnect: defaultConnectTimeout * time.Second},
+        {name: "timeout", config: map[string]interface{}{"timeout": 7}, wantConnect: 7 * time.Second, wantRequest: 7 * time.Second},
+        {name: "connect_timeout", config: map[string]interface{}{"timeout": 7, "connect_timeout": 2}, wantConnect: 2 * time.Second, wantRequest: 7 * time.Second},
+        {name: "request_timeout", config: map[string]interface{}{"timeout": 7, "request_timeout": 30}, wantConnect: 7 * time.Second, wantRequest: 30 * time.Second},
+        {name: "both", config: map[string]interface{}{"connect_timeout": 2, "request_timeout": 30}, wantConnect: 2 * time.Second, wantRequest: 30 * time.Second},
+        {name: "connect_timeout, slow response", config: map[string]interface{}{"connect_timeout": 1}, wantConnect: time.Second, slow: true},
+        {name: "request_timeout, slow response", config: map[string]interface{}{"request_timeout": 1}, wantConnect: defaultConnectTimeout * time.Second, wantRequest: time.Second, slow: true, wantErr: true},
+        {name: "negative connect_timeout", config: map[string]interface{}{"connect_timeout": -1}, wantInit: "invalid connect_timeout -1"},
+        {name: "negative request_timeout", config: map[string]interface{}{"request_timeout": -1}, wantInit: "invalid request_timeout -1"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            if len(tt.wantInit) > 0 {
+                err := initError(t, backend.URL, tt.config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantInit) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantInit)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, tt.config)
+            if got := db.dialer().Timeout; got != tt.wantConnect {
+                t.Errorf("dialer timeout = %s, want %s", got, tt.wantConnect)
+            }
+            if got := db.client().Timeout; got != tt.wantRequest {
+                t.Errorf("client timeout = %s, want %s", got, tt.wantRequest)
+            }
+            if !tt.slow {
+                return
+            }
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                time.Sleep(1500 * time.Millisecond)
+                return false
+            })
+            err := deleteUser(db, "V_USER_R", testDeleteStatement)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("DeleteUser of a slow response = %v, want failure: %v", err, tt.wantErr)
+            }
+        })
+    }
+}
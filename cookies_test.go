@@ -0,0 +1,63 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "net/http"
+    "testing"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestEnableCookies(t *testing.T) {
+    tests := []struct {
+        name    string
+        enabled bool
+        // reinit initializes the plugin again between the requests.
+        reinit     bool
+        wantCookie string
+    }{
+        {name: "disabled"},
+        {name: "enabled", enabled: true, wantCookie: "session-1"},
+        {name: "kept across re-Init", enabled: true, reinit: true, wantCookie: "session-1"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if _, err := (&http.Request{Header: req.Header}).Cookie("session"); err != nil {
+                    http.SetCookie(w, &http.Cookie{Name: "session", Value: "session-1", Path: "/"})
+                }
+                return false
+            })
+            config := map[string]interface{}{"enable_cookies": tt.enabled}
+            db := newTestDB(t, backend.URL, config)
+
+            if err := deleteUser(db, "V_USER_R", testDeleteStatement); err != nil {
+                t.Fatal(err)
+            }
+            if tt.reinit {
+                if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: testConfig(config)}); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            if err := deleteUser(db, "V_OTHER_R", testDeleteStatement); err != nil {
+                t.Fatal(err)
+            }
+
+            requests := backend.received(actionDelUser)
+            if cookies := requests[0].Header.Values("Cookie"); len(cookies) != 0 {
+                t.Errorf("first request sent cookies %v", cookies)
+            }
+            var got string
+            if cookie, err := (&http.Request{Header: requests[1].Header}).Cookie("session"); err == nil {
+                got = cookie.Value
+            }
+            if got != tt.wantCookie {
+                t.Fatalf("second request sent session cookie %q, want %q", got, tt.wantCookie)
+            }
+        })
+    }
+}
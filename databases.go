@@ -0,0 +1,58 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "fmt"
+    "regexp"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// databaseName matches the database names that may be granted: unquoted MySQL
+// identifiers of at most 64 characters.
+var databaseName = regexp.MustCompile(`^[A-Za-z0-9_$]{1,64}$`)
+
+// GrantDatabase gives username access to database in addition to the ones it
+// was created with. statements are handled the same way as rotation
+// statements.
+func (c *MgtvMysql) GrantDatabase(ctx context.Context, username, database string, statements dbplugin.Statements) error {
+    return c.changeDatabase(ctx, actionGrantDatabase, username, database, statements)
+}
+
+// RevokeDatabase takes away the access of username to database.
+func (c *MgtvMysql) RevokeDatabase(ctx context.Context, username, database string, statements dbplugin.Statements) error {
+    return c.changeDatabase(ctx, actionRevokeDatabase, username, database, statements)
+}
+
+func (c *MgtvMysql) changeDatabase(ctx context.Context, action backendAction, username, database string, statements dbplugin.Statements) error {
+    if len(username) == 0 {
+        return fmt.Errorf("%s: username is empty", action)
+    }
+    if !databaseName.MatchString(database) {
+        return fmt.Errorf("%s: invalid database name %q", action, database)
+    }
+
+    c.Lock()
+    defer c.Unlock()
+
+    statement, err := parseStatement(statements)
+    if err != nil {
+        return err
+    }
+    body, err := c.buildRequest(ctx, action, statement, map[string]interface{}{
+        "username": username,
+        "dbname":   database,
+    })
+    if err != nil {
+        return err
+    }
+    _, err = c.invoke(ctx, action, body)
+    c.invalidateUser(username)
+    if err != nil {
+        return c.redactErrorLocked(fmt.Errorf("%s %s for user:%s failed: %w", action, database, username, err))
+    }
+    return nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestChangeDatabase(t *testing.T) {
+    grant := func(db *MgtvMysql, username, database string) error {
+        return db.GrantDatabase(context.Background(), username, database, statements(testDeleteStatement))
+    }
+    revoke := func(db *MgtvMysql, username, database string) error {
+        return db.RevokeDatabase(context.Background(), username, database, statements(testDeleteStatement))
+    }
+    tests := []struct {
+        name     string
+        change   func(db *MgtvMysql, username, database string) error
+        action   backendAction
+        username string
+        database string
+        // status, when set, is the backend status reported.
+        status  int
+        wantErr string
+    }{
+        {name: "grant", change: grant, action: actionGrantDatabase, username: "V_USER_R", database: "reports"},
+        {name: "revoke", change: revoke, action: actionRevokeDatabase, username: "V_USER_R", database: "reports"},
+        {name: "grant, longest name", change: grant, action: actionGrantDatabase, username: "V_USER_R", database: strings.Repeat("d", 64)},
+        {name: "grant, name too long", change: grant, action: actionGrantDatabase, username: "V_USER_R", database: strings.Repeat("d", 65), wantErr: "GrantDatabase: invalid database name"},
+        {name: "grant, quoted name", change: grant, action: actionGrantDatabase, username: "V_USER_R", database: "`reports`", wantErr: "GrantDatabase: invalid database name"},
+        {name: "revoke, empty name", change: revoke, action: actionRevokeDatabase, username: "V_USER_R", wantErr: `RevokeDatabase: invalid database name ""`},
+        {name: "revoke, no username", change: revoke, action: actionRevokeDatabase, database: "reports", wantErr: "RevokeDatabase: username is empty"},
+        {name: "grant rejected", change: grant, action: actionGrantDatabase, username: "V_USER_R", database: "reports", status: 1, wantErr: "GrantDatabase reports for user:V_USER_R failed"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if tt.status == 0 {
+                    return false
+                }
+                writeJSON(w, map[string]interface{}{"status": tt.status, "error": "denied"})
+                return true
+            })
+            db := newTestDB(t, backend.URL, nil)
+
+            err := tt.change(db, tt.username, tt.database)
+            sent := backend.received(tt.action)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("error = %v, want %q", err, tt.wantErr)
+                }
+                if tt.status == 0 && len(sent) != 0 {
+                    t.Fatalf("%s sent for an invalid request", tt.action)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(sent) != 1 {
+                t.Fatalf("%s sent %d times, want once", tt.action, len(sent))
+            }
+            body := sent[0].Body
+            if body["username"] != tt.username || body["dbname"] != tt.database || body["cid"] != "c1" {
+                t.Errorf("%s sent %v, want username %s, dbname %s and cid c1", tt.action, body, tt.username, tt.database)
+            }
+        })
+    }
+}
+
+// TestChangeDatabaseInvalidatesUser drops the cached GetUser result of a user
+// whose databases changed.
+func TestChangeDatabaseInvalidatesUser(t *testing.T) {
+    backend := newFakeBackend(t)
+    backend.users["V_USER_R"] = map[string]interface{}{"username": "V_USER_R"}
+    db := newTestDB(t, backend.URL, map[string]interface{}{"get_user_cache_ttl": 60})
+    base := map[string]interface{}{"cid": "c1"}
+    if _, _, err := db.getUser(context.Background(), "V_USER_R", base); err != nil {
+        t.Fatal(err)
+    }
+    if err := db.GrantDatabase(context.Background(), "V_USER_R", "reports", statements(testDeleteStatement)); err != nil {
+        t.Fatal(err)
+    }
+    if _, _, err := db.getUser(context.Background(), "V_USER_R", base); err != nil {
+        t.Fatal(err)
+    }
+    if got := len(backend.received(actionGetUser)); got != 2 {
+        t.Fatalf("%d GetUser calls, want 2", got)
+    }
+}
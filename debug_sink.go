@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "bytes"
+    "encoding/json"
+    "os"
+    "strings"
+)
+
+const redactedValue = "[redacted]"
+
+// sensitiveFields are the request body fields that must never be written
+// anywhere but the wire.
+var sensitiveFields = []string{"token", "password"}
+
+// redactBody returns a shallow copy of the wire body with sensitive fields
+// replaced.
+func (c *mgtvMysqlConnectionProducer) redactBody(body map[string]interface{}) map[string]interface{} {
+    redacted := copyBody(body)
+    for _, field := range sensitiveFields {
+        if _, ok := redacted[c.wireName(field)]; ok {
+            redacted[c.wireName(field)] = redactedValue
+        }
+    }
+    return redacted
+}
+
+// writeDebugSink appends the redacted body as a JSON line to
+// debug_request_sink. Failures are logged and never fail the operation.
+func (c *mgtvMysqlConnectionProducer) writeDebugSink(body map[string]interface{}) {
+    if len(c.DebugRequestSink) == 0 {
+        return
+    }
+    line, err := json.Marshal(c.redactBody(body))
+    if err != nil {
+        c.logger.Warn("failed to encode request for debug sink", "error", err)
+        return
+    }
+    c.appendDebugSink(line)
+}
+
+// writeDebugSinkRendered appends a body rendered from request_template, which
+// is already redacted. JSON is compacted onto one line; anything else is
+// written as a JSON string.
+func (c *mgtvMysqlConnectionProducer) writeDebugSinkRendered(redacted []byte) {
+    if len(c.DebugRequestSink) == 0 {
+        return
+    }
+    var line bytes.Buffer
+    if err := json.Compact(&line, redacted); err != nil {
+        encoded, _ := json.Marshal(string(redacted))
+        line.Reset()
+        line.Write(encoded)
+    }
+    c.appendDebugSink(line.Bytes())
+}
+
+// traceBody logs the wire body for action, redacted and indented, when
+// debug_pretty_json is set and the logger is at trace level. It works on a
+// copy, so the bytes sent stay compact.
+func (c *mgtvMysqlConnectionProducer) traceBody(action backendAction, body map[string]interface{}) {
+    if !c.DebugPrettyJSON || !c.logger.IsTrace() {
+        return
+    }
+    redacted := c.redactBody(body)
+    if username, ok := redacted[c.wireName("username")].(string); ok {
+        redacted[c.wireName("username")] = c.logName(username)
+    }
+    pretty, err := json.MarshalIndent(redacted, "", "  ")
+    if err != nil {
+        return
+    }
+    c.logger.Trace("outgoing request body", "action", action, "body", string(pretty))
+}
+
+// traceRendered is traceBody for a body rendered from request_template, which
+// is already redacted. username is masked in it with mask_usernames.
+func (c *mgtvMysqlConnectionProducer) traceRendered(action backendAction, redacted []byte, username string) {
+    if !c.DebugPrettyJSON || !c.logger.IsTrace() {
+        return
+    }
+    var pretty bytes.Buffer
+    if err := json.Indent(&pretty, redacted, "", "  "); err != nil {
+        pretty.Reset()
+        pretty.Write(redacted)
+    }
+    text := pretty.String()
+    if len(username) > 0 {
+        text = strings.ReplaceAll(text, username, c.logName(username))
+    }
+    c.logger.Trace("outgoing request body", "action", action, "body", text)
+}
+
+func (c *mgtvMysqlConnectionProducer) appendDebugSink(line []byte) {
+    line = append(line, '\n')
+
+    c.sinkLock.Lock()
+    defer c.sinkLock.Unlock()
+    f, err := os.OpenFile(c.DebugRequestSink, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+    if err != nil {
+        c.logger.Warn("failed to open debug sink", "path", c.DebugRequestSink, "error", err)
+        return
+    }
+    defer f.Close()
+    if _, err := f.Write(line); err != nil {
+        c.logger.Warn("failed to write debug sink", "path", c.DebugRequestSink, "error", err)
+    }
+}
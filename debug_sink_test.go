@@ -0,0 +1,136 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+
+    "github.com/hashicorp/go-hclog"
+)
+
+func TestDebugRequestSink(t *testing.T) {
+    tests := []struct {
+        name string
+        sink bool
+        // fieldNames renames fields on the wire.
+        fieldNames map[string]interface{}
+        // tokenField and passwordField are the wire names of the secrets.
+        tokenField    string
+        passwordField string
+    }{
+        {name: "off"},
+        {name: "on", sink: true, tokenField: "token", passwordField: "password"},
+        {name: "renamed fields", sink: true, fieldNames: map[string]interface{}{"token": "auth", "password": "secret"}, tokenField: "auth", passwordField: "secret"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            path := filepath.Join(t.TempDir(), "requests.ndjson")
+            config := map[string]interface{}{"field_names": tt.fieldNames}
+            if tt.sink {
+                config["debug_request_sink"] = path
+            }
+            db := newTestDB(t, backend.URL, config)
+            username, err := newUser(db, "role", testCreateStatement)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if err := deleteUser(db, username, testDeleteStatement); err != nil {
+                t.Fatal(err)
+            }
+
+            f, err := os.Open(path)
+            if !tt.sink {
+                if !os.IsNotExist(err) {
+                    t.Fatalf("sink written while off: %v", err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            defer f.Close()
+            var lines []map[string]interface{}
+            scanner := bufio.NewScanner(f)
+            for scanner.Scan() {
+                var line map[string]interface{}
+                if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+                    t.Fatalf("line %q isn't JSON: %v", scanner.Text(), err)
+                }
+                if strings.Contains(scanner.Text(), testToken) || strings.Contains(scanner.Text(), "Passw0rd") {
+                    t.Fatalf("line %q carries a secret", scanner.Text())
+                }
+                lines = append(lines, line)
+            }
+            if len(lines) != len(backend.received("")) {
+                t.Fatalf("%d lines written for %d requests", len(lines), len(backend.received("")))
+            }
+            create := lines[0]
+            if create["action"] != string(actionAddUser) || create["username"] != username {
+                t.Fatalf("first line = %v, want the create of %s", create, username)
+            }
+            if create[tt.tokenField] != redactedValue || create[tt.passwordField] != redactedValue {
+                t.Fatalf("first line = %v, want %s and %s redacted", create, tt.tokenField, tt.passwordField)
+            }
+        })
+    }
+}
+
+func TestDebugPrettyJSON(t *testing.T) {
+    tests := []struct {
+        name   string
+        pretty bool
+        level  hclog.Level
+        // wantLogged is whether the body is logged.
+        wantLogged bool
+    }{
+        {name: "on at trace", pretty: true, level: hclog.Trace, wantLogged: true},
+        {name: "on at debug", pretty: true, level: hclog.Debug},
+        {name: "off at trace", level: hclog.Trace},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, map[string]interface{}{"debug_pretty_json": tt.pretty})
+            var logs bytes.Buffer
+            db.logger = hclog.New(&hclog.LoggerOptions{Output: &logs, Level: tt.level})
+            if _, err := newUser(db, "role", testCreateStatement); err != nil {
+                t.Fatal(err)
+            }
+
+            // The wire body stays compact either way.
+            sent := backend.received(actionAddUser)[0]
+            raw := sent.Raw
+            var compact bytes.Buffer
+            if err := json.Compact(&compact, raw); err != nil {
+                t.Fatal(err)
+            }
+            if !bytes.Equal(bytes.TrimSpace(raw), compact.Bytes()) {
+                t.Fatalf("wire body isn't compact: %s", raw)
+            }
+
+            logged := strings.Contains(logs.String(), "outgoing request body")
+            if logged != tt.wantLogged {
+                t.Fatalf("body logged: %v, want %v:\n%s", logged, tt.wantLogged, logs.String())
+            }
+            if !tt.wantLogged {
+                return
+            }
+            if !strings.Contains(logs.String(), `  "cid": "c1"`) {
+                t.Errorf("logged body isn't indented:\n%s", logs.String())
+            }
+            for _, field := range []string{"token", "password"} {
+                if secret, _ := sent.Body[field].(string); len(secret) == 0 || strings.Contains(logs.String(), secret) {
+                    t.Errorf("logged body carries the %s sent:\n%s", field, logs.String())
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,41 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "fmt"
+    "strings"
+)
+
+// echoFields are the create request fields confirm_echo compares against the
+// backend result. username must be echoed; the others only when present.
+var echoFields = []string{"username", "priv"}
+
+// confirmEcho checks that the fields the backend echoed in result match those
+// sent in body, guarding against backend bugs and tampering in transit.
+func (c *mgtvMysqlConnectionProducer) confirmEcho(body, result map[string]interface{}) error {
+    for _, field := range echoFields {
+        echoed, ok := result[c.wireName(field)]
+        if !ok {
+            if field == "username" {
+                return fmt.Errorf("confirm_echo: response does not echo %s", field)
+            }
+            continue
+        }
+        if field == "priv" {
+            sent, _ := NormalizePriv(body[field])
+            if got, err := NormalizePriv(echoed); err != nil || got != sent {
+                return fmt.Errorf("confirm_echo: response echoes priv %q, but %q was sent", fmt.Sprint(echoed), sent)
+            }
+            continue
+        }
+        if field == "username" && c.UsernameCaseInsensitiveEcho && strings.EqualFold(fmt.Sprint(echoed), fmt.Sprint(body[field])) {
+            continue
+        }
+        if fmt.Sprint(echoed) != fmt.Sprint(body[field]) {
+            return fmt.Errorf("confirm_echo: response echoes %s %q, but %q was sent", field, fmt.Sprint(echoed), fmt.Sprint(body[field]))
+        }
+    }
+    return nil
+}
@@ -0,0 +1,132 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "errors"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestConfirmEcho(t *testing.T) {
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // echo returns the create result for the request body sent.
+        echo    func(body map[string]interface{}) map[string]interface{}
+        wantErr string
+    }{
+        {
+            name:   "disabled, mismatch ignored",
+            config: map[string]interface{}{"confirm_echo": false},
+            echo: func(body map[string]interface{}) map[string]interface{} {
+                return map[string]interface{}{"status": 0, "username": "V_OTHER_r"}
+            },
+        },
+        {
+            name: "matching",
+            echo: func(body map[string]interface{}) map[string]interface{} {
+                return map[string]interface{}{"status": 0, "username": body["username"], "priv": body["priv"]}
+            },
+        },
+        {
+            name: "different username",
+            echo: func(body map[string]interface{}) map[string]interface{} {
+                return map[string]interface{}{"status": 0, "username": "V_OTHER_r"}
+            },
+            wantErr: `confirm_echo: response echoes username "V_OTHER_r"`,
+        },
+        {
+            name: "username missing",
+            echo: func(body map[string]interface{}) map[string]interface{} {
+                return map[string]interface{}{"status": 0}
+            },
+            wantErr: "confirm_echo: response does not echo username",
+        },
+        {
+            name: "different priv",
+            echo: func(body map[string]interface{}) map[string]interface{} {
+                return map[string]interface{}{"status": 0, "username": body["username"], "priv": 1}
+            },
+            wantErr: "confirm_echo: response echoes priv",
+        },
+        {
+            name: "lowercased username",
+            echo: func(body map[string]interface{}) map[string]interface{} {
+                return map[string]interface{}{"status": 0, "username": strings.ToLower(body["username"].(string))}
+            },
+            wantErr: "confirm_echo: response echoes username",
+        },
+        {
+            name:   "lowercased username, case insensitive",
+            config: map[string]interface{}{"username_case_insensitive_echo": true},
+            echo: func(body map[string]interface{}) map[string]interface{} {
+                return map[string]interface{}{"status": 0, "username": strings.ToLower(body["username"].(string))}
+            },
+        },
+        {
+            name:   "uppercased username, case insensitive",
+            config: map[string]interface{}{"username_case_insensitive_echo": true, "username_case": usernameCaseLower},
+            echo: func(body map[string]interface{}) map[string]interface{} {
+                return map[string]interface{}{"status": 0, "username": strings.ToUpper(body["username"].(string))}
+            },
+        },
+        // Only the case is let go of, not a different name.
+        {
+            name:   "different username, case insensitive",
+            config: map[string]interface{}{"username_case_insensitive_echo": true},
+            echo: func(body map[string]interface{}) map[string]interface{} {
+                return map[string]interface{}{"status": 0, "username": "v_other_r"}
+            },
+            wantErr: `confirm_echo: response echoes username "v_other_r"`,
+        },
+        {
+            name:   "suffixed username, case insensitive",
+            config: map[string]interface{}{"username_case_insensitive_echo": true},
+            echo: func(body map[string]interface{}) map[string]interface{} {
+                return map[string]interface{}{"status": 0, "username": strings.ToLower(body["username"].(string)) + "x"}
+            },
+            wantErr: "confirm_echo: response echoes username",
+        },
+        {
+            name:   "renamed field",
+            config: map[string]interface{}{"field_names": map[string]interface{}{"username": "user"}},
+            echo: func(body map[string]interface{}) map[string]interface{} {
+                return map[string]interface{}{"status": 0, "user": body["user"]}
+            },
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(actionAddUser) {
+                    return false
+                }
+                writeJSON(w, tt.echo(req.Body))
+                return true
+            })
+            config := map[string]interface{}{"confirm_echo": true}
+            for k, v := range tt.config {
+                config[k] = v
+            }
+            db := newTestDB(t, backend.URL, config)
+            _, err := newUser(db, "role", `{"cid":"c1","dbname":"d1","priv":0}`)
+            if len(tt.wantErr) > 0 {
+                var createErr *CreateUserError
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                if !errors.As(err, &createErr) || len(createErr.Username) == 0 {
+                    t.Fatalf("NewUser error %v doesn't name the user created", err)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+}
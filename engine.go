@@ -0,0 +1,74 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import "fmt"
+
+// Database engines the backend can target.
+const (
+    engineMySQL   = "mysql"
+    engineMariaDB = "mariadb"
+    enginePercona = "percona"
+)
+
+// Username casing applied to generated usernames.
+const (
+    usernameCaseUpper    = "upper"
+    usernameCaseLower    = "lower"
+    usernameCasePreserve = "preserve"
+)
+
+// engineUsernameCase is the casing used for an engine unless username_case
+// overrides it. MariaDB usernames are case sensitive, so they are preserved;
+// the other engines keep the historical uppercasing.
+var engineUsernameCase = map[string]string{
+    engineMySQL:   usernameCaseUpper,
+    engineMariaDB: usernameCasePreserve,
+    enginePercona: usernameCaseUpper,
+}
+
+func validUsernameCase(usernameCase string) bool {
+    switch usernameCase {
+    case usernameCaseUpper, usernameCaseLower, usernameCasePreserve:
+        return true
+    }
+    return false
+}
+
+// usernameCase returns the casing for usernames created on engine.
+func (c *mgtvMysqlConnectionProducer) usernameCase(engine string) string {
+    if len(c.UsernameCase) > 0 {
+        return c.UsernameCase
+    }
+    if usernameCase, ok := engineUsernameCase[engine]; ok {
+        return usernameCase
+    }
+    return usernameCaseUpper
+}
+
+func validEngine(engine string) bool {
+    switch engine {
+    case engineMySQL, engineMariaDB, enginePercona:
+        return true
+    }
+    return false
+}
+
+// applyEngine sets the engine field of body, keeping one from the statement
+// and falling back to the configured engine.
+func (c *mgtvMysqlConnectionProducer) applyEngine(body map[string]interface{}) error {
+    engine := c.Engine
+    if v, ok := body["engine"]; ok {
+        s, _ := v.(string)
+        if !validEngine(s) {
+            return fmt.Errorf("invalid engine %v: must be %q, %q or %q", v, engineMySQL, engineMariaDB, enginePercona)
+        }
+        engine = s
+    }
+    if len(engine) == 0 {
+        engine = engineMySQL
+    }
+    body["engine"] = engine
+    return nil
+}
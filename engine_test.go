@@ -0,0 +1,74 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestEngine(t *testing.T) {
+    tests := []struct {
+        name string
+        // engine is the configured engine, and statementEngine the one the
+        // statements name, each unset when empty.
+        engine          string
+        statementEngine string
+        want            string
+        wantInitErr     string
+        wantErr         string
+    }{
+        {name: "default", want: engineMySQL},
+        {name: "mysql", engine: engineMySQL, want: engineMySQL},
+        {name: "mariadb", engine: engineMariaDB, want: engineMariaDB},
+        {name: "percona", engine: enginePercona, want: enginePercona},
+        {name: "statement overrides config", engine: engineMariaDB, statementEngine: enginePercona, want: enginePercona},
+        {name: "invalid config", engine: "postgres", wantInitErr: "invalid engine"},
+        {name: "invalid statement", statementEngine: "postgres", wantErr: `invalid engine postgres: must be "mysql", "mariadb" or "percona"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{}
+            if len(tt.engine) > 0 {
+                config["engine"] = tt.engine
+            }
+            if len(tt.wantInitErr) > 0 {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantInitErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantInitErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+            createStatement, deleteStatement := testCreateStatement, testDeleteStatement
+            if len(tt.statementEngine) > 0 {
+                createStatement = `{"cid":"c1","dbname":"d1","engine":"` + tt.statementEngine + `"}`
+                deleteStatement = `{"cid":"c1","engine":"` + tt.statementEngine + `"}`
+            }
+
+            _, createErr := newUser(db, "role", createStatement)
+            deleteErr := deleteUser(db, "V_USER_R", deleteStatement)
+            if len(tt.wantErr) > 0 {
+                for op, err := range map[string]error{"NewUser": createErr, "DeleteUser": deleteErr} {
+                    if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                        t.Errorf("%s error = %v, want %q", op, err, tt.wantErr)
+                    }
+                }
+                if sent := backend.received(""); len(sent) > 0 {
+                    t.Fatalf("%d requests sent, want none", len(sent))
+                }
+                return
+            }
+            if createErr != nil || deleteErr != nil {
+                t.Fatalf("NewUser error = %v, DeleteUser error = %v", createErr, deleteErr)
+            }
+            for _, action := range []backendAction{actionAddUser, actionDelUser} {
+                if got := backend.received(action)[0].Body["engine"]; got != tt.want {
+                    t.Errorf("%s engine = %v, want %s", action, got, tt.want)
+                }
+            }
+        })
+    }
+}
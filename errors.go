@@ -0,0 +1,217 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "net/url"
+    "strings"
+)
+
+// ErrUnreachable matches the errors of calls that got no response from the
+// backend, such as a refused connection, so that alerting can tell them from
+// rejected tokens.
+var ErrUnreachable = errors.New("backend unreachable")
+
+// ErrUnauthorized matches the errors of calls the backend answered with a 401
+// or 403, rejecting the token.
+var ErrUnauthorized = errors.New("backend rejected the token")
+
+// errUnsupportedAction matches the errors of calls for an action the backend
+// doesn't implement.
+var errUnsupportedAction = errors.New("unsupported backend action")
+
+// errIncompleteResponse matches the errors of calls whose response body was cut
+// short by the connection failing.
+var errIncompleteResponse = errors.New("incomplete response")
+
+// incompleteResponseError is a response body that could only be read in part.
+type incompleteResponseError struct {
+    received int
+    err      error
+}
+
+func (e *incompleteResponseError) Error() string {
+    return fmt.Sprintf("incomplete response: the connection failed after %d bytes of the body: %v", e.received, e.err)
+}
+
+func (e *incompleteResponseError) Unwrap() error {
+    return e.err
+}
+
+func (e *incompleteResponseError) Is(target error) bool {
+    return target == errIncompleteResponse
+}
+
+// isRetryable reports whether a call that failed with err may succeed when
+// resent: the backend dropped the connection before or while answering it.
+func isRetryable(err error) bool {
+    return errors.Is(err, errIncompleteResponse) || isConnectionDropped(err)
+}
+
+// statusError is a call answered with an http status other than 200. A 404 or
+// 501 means the backend doesn't implement the action. reauth marks a redirect
+// to re-authenticate.
+type statusError struct {
+    code   int
+    reauth bool
+}
+
+func (e *statusError) Error() string {
+    if e.unauthorized() {
+        return fmt.Sprintf("http statusCode: %d: %v", e.code, ErrUnauthorized)
+    }
+    return fmt.Sprintf("http statusCode: %d", e.code)
+}
+
+func (e *statusError) Is(target error) bool {
+    switch target {
+    case errUnsupportedAction:
+        return e.code == http.StatusNotFound || e.code == http.StatusNotImplemented
+    case ErrUnauthorized:
+        return e.unauthorized()
+    }
+    return false
+}
+
+func (e *statusError) unauthorized() bool {
+    return e.reauth || e.code == http.StatusUnauthorized || e.code == http.StatusForbidden
+}
+
+// unreachableError is a call that failed before the backend answered it. It
+// holds the cause of the *url.Error the http client returned, not the
+// *url.Error itself: the sanitizer middleware New wraps the plugin in
+// replaces any error carrying one with a generic message.
+type unreachableError struct {
+    op   string
+    host string
+    err  error
+}
+
+// unreachable marks err as ErrUnreachable when the http client failed to get
+// a response, and returns any other error as is. Each attempt of a retried
+// call is marked on its own.
+func unreachable(err error) error {
+    if joined, ok := err.(*attemptErrors); ok {
+        errs := make([]error, len(joined.errs))
+        for i, err := range joined.errs {
+            errs[i] = unreachable(err)
+        }
+        return &attemptErrors{errs: errs}
+    }
+    var urlErr *url.Error
+    if !errors.As(err, &urlErr) {
+        return err
+    }
+    // Only the host is kept, as the url may carry credentials.
+    var host string
+    if u, err := url.Parse(urlErr.URL); err == nil {
+        host = u.Host
+    }
+    return &unreachableError{op: urlErr.Op, host: host, err: urlErr.Err}
+}
+
+func (e *unreachableError) Error() string {
+    return fmt.Sprintf("%v: %s %s: %v", ErrUnreachable, e.op, e.host, e.err)
+}
+
+func (e *unreachableError) Unwrap() error {
+    return e.err
+}
+
+func (e *unreachableError) Is(target error) bool {
+    return target == ErrUnreachable
+}
+
+// CreateUserError is returned by NewUser when the backend call for a generated
+// username fails, so that tooling can find the attempt in backend logs.
+type CreateUserError struct {
+    // Username is the generated username the create was attempted with.
+    Username string
+    Err      error
+}
+
+func (e *CreateUserError) Error() string {
+    return fmt.Sprintf("invoke db create user:%s failed: %v", e.Username, e.Err)
+}
+
+func (e *CreateUserError) Unwrap() error {
+    return e.Err
+}
+
+// BackendError is a call the backend answered with a successful http status
+// but a failed status in the body, so that the two aren't confused.
+type BackendError struct {
+    // HTTPStatus is the http status of the response, typically 200.
+    HTTPStatus int
+    // Status is the non-zero status the body reported.
+    Status  int
+    Message string
+}
+
+func (e *BackendError) Error() string {
+    message := e.Message
+    if len(message) == 0 {
+        message = "no error message"
+    }
+    return fmt.Sprintf("backend reported status %d in an http %d response: %s", e.Status, e.HTTPStatus, message)
+}
+
+// attemptErrors holds the errors of every failed attempt of a retried call.
+type attemptErrors struct {
+    errs []error
+}
+
+// joinErrors aggregates the non-nil errs of successive attempts, like
+// errors.Join, which this module's Go version predates. It returns nil when
+// there are none and a lone error as is.
+func joinErrors(errs ...error) error {
+    var joined []error
+    for _, err := range errs {
+        if err != nil {
+            joined = append(joined, err)
+        }
+    }
+    switch len(joined) {
+    case 0:
+        return nil
+    case 1:
+        return joined[0]
+    }
+    return &attemptErrors{errs: joined}
+}
+
+func (e *attemptErrors) Error() string {
+    msgs := make([]string, 0, len(e.errs))
+    for i, err := range e.errs {
+        msgs = append(msgs, fmt.Sprintf("attempt %d: %v", i+1, err))
+    }
+    return strings.Join(msgs, "; ")
+}
+
+func (e *attemptErrors) Unwrap() []error {
+    return e.errs
+}
+
+// Is and As check every attempt, as errors.Is and errors.As only follow
+// multiple errors from Go 1.20 on.
+func (e *attemptErrors) Is(target error) bool {
+    for _, err := range e.errs {
+        if errors.Is(err, target) {
+            return true
+        }
+    }
+    return false
+}
+
+func (e *attemptErrors) As(target interface{}) bool {
+    for _, err := range e.errs {
+        if errors.As(err, target) {
+            return true
+        }
+    }
+    return false
+}
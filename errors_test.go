@@ -0,0 +1,272 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// TestUnreachableUnauthorized goes through New, so that the errors are seen as
+// they are once the sanitizer middleware had them.
+func TestUnreachableUnauthorized(t *testing.T) {
+    closed := httptest.NewServer(http.NotFoundHandler())
+    closed.Close()
+    rejecting := func(code int) string {
+        srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+            w.WriteHeader(code)
+        }))
+        t.Cleanup(srv.Close)
+        return srv.URL
+    }
+
+    tests := []struct {
+        name            string
+        url             string
+        wantUnreachable bool
+        wantMessage     string
+    }{
+        {name: "connection refused", url: closed.URL, wantUnreachable: true, wantMessage: "connection refused"},
+        {name: "401", url: rejecting(http.StatusUnauthorized), wantMessage: "http statusCode: 401"},
+        {name: "403", url: rejecting(http.StatusForbidden), wantMessage: "http statusCode: 403"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            setTestEnv(t, tt.url)
+            raw, err := New()
+            if err != nil {
+                t.Fatal(err)
+            }
+            db := raw.(dbplugin.Database)
+            defer db.Close()
+            _, err = db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: testConfig(nil)})
+            if err != nil {
+                t.Fatalf("Initialize: %v", err)
+            }
+
+            _, createErr := newUser(db, "role", testCreateStatement)
+            deleteErr := deleteUser(db, "V_USER_R", testDeleteStatement)
+            for op, err := range map[string]error{"NewUser": createErr, "DeleteUser": deleteErr} {
+                switch {
+                case err == nil:
+                    t.Fatalf("%s succeeded", op)
+                case errors.Is(err, ErrUnreachable) != tt.wantUnreachable:
+                    t.Errorf("%s error %q: errors.Is(ErrUnreachable) = %v", op, err, !tt.wantUnreachable)
+                case errors.Is(err, ErrUnauthorized) == tt.wantUnreachable:
+                    t.Errorf("%s error %q: errors.Is(ErrUnauthorized) = %v", op, err, tt.wantUnreachable)
+                case !strings.Contains(err.Error(), tt.wantMessage):
+                    t.Errorf("%s error %q doesn't contain %q", op, err, tt.wantMessage)
+                }
+            }
+        })
+    }
+}
+
+func TestCreateUserError(t *testing.T) {
+    tests := []struct {
+        name    string
+        respond func(w http.ResponseWriter, req recordedRequest) bool
+        // statement is testCreateStatement unless set.
+        statement      string
+        wantCreateErr  bool
+        wantBackendErr bool
+    }{
+        {
+            name: "backend status",
+            respond: func(w http.ResponseWriter, req recordedRequest) bool {
+                writeJSON(w, map[string]interface{}{"status": 1, "error": "quota exceeded"})
+                return true
+            },
+            wantCreateErr:  true,
+            wantBackendErr: true,
+        },
+        {
+            name: "http status",
+            respond: func(w http.ResponseWriter, req recordedRequest) bool {
+                w.WriteHeader(http.StatusBadGateway)
+                return true
+            },
+            wantCreateErr: true,
+        },
+        // Nothing was attempted on the backend.
+        {name: "invalid statement", statement: `{"cid":`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(tt.respond)
+            db := newTestDB(t, backend.URL, nil)
+            statement := tt.statement
+            if len(statement) == 0 {
+                statement = testCreateStatement
+            }
+            _, err := newUser(db, "role", statement)
+            if err == nil {
+                t.Fatal("NewUser succeeded")
+            }
+
+            var createErr *CreateUserError
+            if errors.As(err, &createErr) != tt.wantCreateErr {
+                t.Fatalf("NewUser error %q: errors.As(*CreateUserError) = %v", err, !tt.wantCreateErr)
+            }
+            if !tt.wantCreateErr {
+                return
+            }
+            sent, _ := backend.received(actionAddUser)[0].Body["username"].(string)
+            if createErr.Username != sent {
+                t.Fatalf("CreateUserError.Username = %q, want the attempted %q", createErr.Username, sent)
+            }
+            if !strings.Contains(err.Error(), sent) {
+                t.Errorf("NewUser error %q doesn't name %q", err, sent)
+            }
+            var backendErr *BackendError
+            if errors.As(err, &backendErr) != tt.wantBackendErr {
+                t.Errorf("NewUser error %q: errors.As(*BackendError) = %v", err, !tt.wantBackendErr)
+            }
+        })
+    }
+}
+
+func TestJoinErrors(t *testing.T) {
+    first := errors.New("connection reset")
+    second := &BackendError{Status: 1, Message: "quota exceeded"}
+    tests := []struct {
+        name    string
+        errs    []error
+        wantNil bool
+        // wantSame is set when the lone error is returned as is.
+        wantSame error
+        wantMsg  string
+    }{
+        {name: "none", wantNil: true},
+        {name: "only nils", errs: []error{nil, nil}, wantNil: true},
+        {name: "one", errs: []error{nil, first}, wantSame: first},
+        {name: "two", errs: []error{first, nil, second}, wantMsg: "attempt 1: connection reset; attempt 2: " + second.Error()},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := joinErrors(tt.errs...)
+            switch {
+            case tt.wantNil:
+                if err != nil {
+                    t.Fatalf("joinErrors = %v, want nil", err)
+                }
+                return
+            case tt.wantSame != nil:
+                if err != tt.wantSame {
+                    t.Fatalf("joinErrors = %#v, want %#v as is", err, tt.wantSame)
+                }
+                return
+            }
+            if err.Error() != tt.wantMsg {
+                t.Fatalf("joinErrors = %q, want %q", err, tt.wantMsg)
+            }
+            if !errors.Is(err, first) {
+                t.Errorf("errors.Is(%q, first attempt) = false", err)
+            }
+            var backendErr *BackendError
+            if !errors.As(err, &backendErr) || backendErr != second {
+                t.Errorf("errors.As(%q, *BackendError) = %v, want the second attempt", err, backendErr)
+            }
+        })
+    }
+}
+
+// TestAttemptErrors reports the failure of every attempt of a retried call,
+// not just the last.
+func TestAttemptErrors(t *testing.T) {
+    t.Run("dial", func(t *testing.T) {
+        backend := newFakeBackend(t)
+        db := newTestDB(t, backend.URL, map[string]interface{}{
+            "connect_retries": 2,
+            "retry_min_delay": 1,
+            "retry_max_delay": 1,
+        })
+        dials := 0
+        dial := db.retryDial(func(ctx context.Context, network, addr string) (net.Conn, error) {
+            dials++
+            return nil, fmt.Errorf("dial %d: no such host", dials)
+        })
+        _, err := dial(context.Background(), "tcp", backend.Listener.Addr().String())
+        want := "attempt 1: dial 1: no such host; attempt 2: dial 2: no such host; attempt 3: dial 3: no such host"
+        if err == nil || err.Error() != want {
+            t.Fatalf("dial error = %v, want %q", err, want)
+        }
+    })
+    t.Run("dropped connection", func(t *testing.T) {
+        backend := newFakeBackend(t)
+        backend.setRespond(dropFirst(t, actionDelUser, 2))
+        db := newTestDB(t, backend.URL, nil)
+        err := deleteUser(db, "V_USER_R", testDeleteStatement)
+        if err == nil {
+            t.Fatal("DeleteUser succeeded")
+        }
+        for _, attempt := range []string{"attempt 1: ", "attempt 2: "} {
+            if !strings.Contains(err.Error(), attempt) {
+                t.Errorf("DeleteUser error %q doesn't report %q", err, attempt)
+            }
+        }
+        if n := strings.Count(err.Error(), "EOF"); n != 2 || !errors.Is(err, ErrUnreachable) {
+            t.Errorf("DeleteUser error %q doesn't carry both dropped connections", err)
+        }
+    })
+}
+
+func TestBackendError(t *testing.T) {
+    tests := []struct {
+        name       string
+        httpStatus int
+        result     map[string]interface{}
+        // want is the BackendError expected, nil when the error isn't one.
+        want    *BackendError
+        wantMsg string
+    }{
+        {
+            name:    "200 with failed status",
+            result:  map[string]interface{}{"status": 1, "error": "quota exceeded"},
+            want:    &BackendError{HTTPStatus: http.StatusOK, Status: 1, Message: "quota exceeded"},
+            wantMsg: "backend reported status 1 in an http 200 response: quota exceeded",
+        },
+        {
+            name:    "200 without error message",
+            result:  map[string]interface{}{"status": 7},
+            want:    &BackendError{HTTPStatus: http.StatusOK, Status: 7},
+            wantMsg: "backend reported status 7 in an http 200 response: no error message",
+        },
+        {name: "http failure", httpStatus: http.StatusBadGateway, wantMsg: "http statusCode: 502"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if tt.httpStatus != 0 {
+                    w.WriteHeader(tt.httpStatus)
+                    return true
+                }
+                writeJSON(w, tt.result)
+                return true
+            })
+            db := newTestDB(t, backend.URL, nil)
+            err := deleteUser(db, "V_USER_R", testDeleteStatement)
+            if err == nil || !strings.Contains(err.Error(), tt.wantMsg) {
+                t.Fatalf("DeleteUser error = %v, want %q", err, tt.wantMsg)
+            }
+            var backendErr *BackendError
+            if errors.As(err, &backendErr) != (tt.want != nil) {
+                t.Fatalf("DeleteUser error %q: errors.As(*BackendError) = %v", err, tt.want == nil)
+            }
+            if tt.want != nil && *backendErr != *tt.want {
+                t.Fatalf("BackendError = %+v, want %+v", *backendErr, *tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,71 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/vault/sdk/logical"
+    "google.golang.org/protobuf/types/known/structpb"
+)
+
+// Credential lifecycle events published through the event sender.
+const (
+    EventCredentialCreate logical.EventType = "mgtv-mysql/credential-create"
+    EventCredentialDelete logical.EventType = "mgtv-mysql/credential-delete"
+    EventCredentialRotate logical.EventType = "mgtv-mysql/credential-rotate"
+)
+
+// emitEvent publishes eventType for username with the given non-secret
+// metadata. It is a no-op unless emit_events is set. Failures are logged and
+// never fail the operation. It must be called with the lock held, for reading
+// at least.
+func (c *mgtvMysqlConnectionProducer) emitEvent(ctx context.Context, eventType logical.EventType, username string, metadata map[string]interface{}) {
+    if !c.EmitEvents {
+        return
+    }
+    sender := c.eventSender
+    if sender == nil {
+        sender = logEventSender{logger: c.logger, logName: c.logName}
+    }
+    event, err := logical.NewEvent()
+    if err != nil {
+        c.logger.Warn("failed to create event", "type", eventType, "error", err)
+        return
+    }
+    fields := map[string]interface{}{
+        "plugin":   mysqlTypeName,
+        "username": username,
+    }
+    for k, v := range metadata {
+        fields[k] = v
+    }
+    event.Metadata, err = structpb.NewStruct(fields)
+    if err != nil {
+        c.logger.Warn("failed to encode event metadata", "type", eventType, "error", err)
+        return
+    }
+    event.EntityIds = []string{username}
+    if err := sender.Send(ctx, eventType, event); err != nil {
+        c.logger.Warn("failed to send event", "type", eventType, "error", err)
+    }
+}
+
+// logEventSender writes events to the plugin log, for plugins built without an
+// event sender. The username is logged as logName has it, as on every other
+// log line.
+type logEventSender struct {
+    logger  hclog.Logger
+    logName func(username string) string
+}
+
+func (s logEventSender) Send(_ context.Context, eventType logical.EventType, event *logical.EventData) error {
+    metadata := event.Metadata.AsMap()
+    if username, ok := metadata["username"].(string); ok {
+        metadata["username"] = s.logName(username)
+    }
+    s.logger.Info("credential event", "type", eventType, "id", event.Id, "metadata", metadata)
+    return nil
+}
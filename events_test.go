@@ -0,0 +1,130 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "bytes"
+    "context"
+    "strings"
+    "sync"
+    "testing"
+
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/vault/sdk/logical"
+)
+
+// fakeEventSender records the events it is sent.
+type fakeEventSender struct {
+    mu     sync.Mutex
+    events []sentEvent
+}
+
+type sentEvent struct {
+    eventType logical.EventType
+    metadata  map[string]interface{}
+}
+
+func (s *fakeEventSender) Send(_ context.Context, eventType logical.EventType, event *logical.EventData) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.events = append(s.events, sentEvent{eventType: eventType, metadata: event.Metadata.AsMap()})
+    return nil
+}
+
+func (s *fakeEventSender) sent() []sentEvent {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return append([]sentEvent(nil), s.events...)
+}
+
+// lifecycle creates, rotates and deletes a user of role.
+func lifecycle(t *testing.T, db *MgtvMysql) string {
+    t.Helper()
+    username, err := newUser(db, "role", testCreateStatement)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := db.RotatePassword(context.Background(), username, statements(testDeleteStatement)); err != nil {
+        t.Fatal(err)
+    }
+    if err := deleteUser(db, username, testDeleteStatement); err != nil {
+        t.Fatal(err)
+    }
+    return username
+}
+
+func TestEmitEvents(t *testing.T) {
+    tests := []struct {
+        name       string
+        emitEvents bool
+        want       []logical.EventType
+    }{
+        {name: "off"},
+        {name: "on", emitEvents: true, want: []logical.EventType{EventCredentialCreate, EventCredentialRotate, EventCredentialDelete}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            sender := &fakeEventSender{}
+            db := newTestDB(t, backend.URL, map[string]interface{}{"emit_events": tt.emitEvents}, WithEventSender(sender))
+            username := lifecycle(t, db)
+
+            sent := sender.sent()
+            if len(sent) != len(tt.want) {
+                t.Fatalf("%d events sent, want %v", len(sent), tt.want)
+            }
+            for i, event := range sent {
+                if event.eventType != tt.want[i] {
+                    t.Errorf("event %d is %s, want %s", i, event.eventType, tt.want[i])
+                }
+                if event.metadata["username"] != username || event.metadata["plugin"] != mysqlTypeName {
+                    t.Errorf("event %s metadata = %v", event.eventType, event.metadata)
+                }
+                for _, field := range []string{"password", "token"} {
+                    if _, ok := event.metadata[field]; ok {
+                        t.Errorf("event %s metadata carries %s", event.eventType, field)
+                    }
+                }
+            }
+            if len(sent) > 0 && sent[0].metadata["role"] != "role" {
+                t.Errorf("create event metadata = %v, want the role", sent[0].metadata)
+            }
+        })
+    }
+}
+
+// TestEmitEventsLog checks that events are logged when the plugin wasn't built
+// with an event sender, as it isn't by main.
+func TestEmitEventsLog(t *testing.T) {
+    tests := []struct {
+        name string
+        mask bool
+    }{
+        {name: "usernames shown"},
+        {name: "usernames masked", mask: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, map[string]interface{}{"emit_events": true, "mask_usernames": tt.mask})
+            var buf bytes.Buffer
+            db.Lock()
+            db.logger = hclog.New(&hclog.LoggerOptions{Output: &buf})
+            db.Unlock()
+            username := lifecycle(t, db)
+
+            for _, eventType := range []logical.EventType{EventCredentialCreate, EventCredentialRotate, EventCredentialDelete} {
+                if !strings.Contains(buf.String(), "credential event: type="+string(eventType)) {
+                    t.Errorf("%s not logged in:\n%s", eventType, buf.String())
+                }
+            }
+            if strings.Contains(buf.String(), username) == tt.mask {
+                t.Errorf("%q in the logs: %v, want %v:\n%s", username, tt.mask, !tt.mask, buf.String())
+            }
+            if masked := db.logName(username); tt.mask && strings.Count(buf.String(), "username:"+masked) != 3 {
+                t.Errorf("events don't carry %q as the username:\n%s", masked, buf.String())
+            }
+        })
+    }
+}
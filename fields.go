@@ -0,0 +1,63 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import "fmt"
+
+// canonicalFields returns the request fields the plugin knows of, each sent
+// under its own name unless field_names maps it.
+func canonicalFields() map[string]bool {
+    fields := map[string]bool{"cid": true}
+    for field := range reservedFields {
+        fields[field] = true
+    }
+    for _, spec := range actionSpecs {
+        for _, field := range spec.required {
+            fields[field] = true
+        }
+    }
+    return fields
+}
+
+// validateFieldNames checks that field_names maps every canonical field to a
+// distinct, non-empty wire name, which no unmapped field is sent as.
+func validateFieldNames(names map[string]string) error {
+    seen := make(map[string]string, len(names))
+    for canonical, wire := range names {
+        if len(wire) == 0 {
+            return fmt.Errorf("invalid field_names: %q is mapped to an empty name", canonical)
+        }
+        if other, ok := seen[wire]; ok {
+            return fmt.Errorf("invalid field_names: %q and %q are both mapped to %q", other, canonical, wire)
+        }
+        seen[wire] = canonical
+    }
+    canonical := canonicalFields()
+    for field, wire := range names {
+        if _, mapped := names[wire]; canonical[wire] && !mapped {
+            return fmt.Errorf("invalid field_names: %q is mapped to %q, the name of the unmapped field %q", field, wire, wire)
+        }
+    }
+    return nil
+}
+
+// wireName returns the name field is sent as.
+func (c *mgtvMysqlConnectionProducer) wireName(field string) string {
+    if wire, ok := c.FieldNames[field]; ok {
+        return wire
+    }
+    return field
+}
+
+// wireBody renames the canonical fields of body to their wire names.
+func (c *mgtvMysqlConnectionProducer) wireBody(body map[string]interface{}) map[string]interface{} {
+    if len(c.FieldNames) == 0 {
+        return body
+    }
+    wire := make(map[string]interface{}, len(body))
+    for field, v := range body {
+        wire[c.wireName(field)] = v
+    }
+    return wire
+}
@@ -0,0 +1,101 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestFieldNames(t *testing.T) {
+    tests := []struct {
+        name       string
+        fieldNames map[string]interface{}
+        wantFields []string
+        // unwantedFields are canonical names that were renamed away.
+        unwantedFields []string
+        wantErr        string
+    }{
+        {name: "default", wantFields: []string{"username", "password", "action", "cid", "dbname"}},
+        {
+            name:           "camelCase",
+            fieldNames:     map[string]interface{}{"username": "userName", "password": "passWord", "dbname": "dbName"},
+            wantFields:     []string{"userName", "passWord", "dbName", "action", "cid"},
+            unwantedFields: []string{"username", "password", "dbname"},
+        },
+        {
+            name:           "action",
+            fieldNames:     map[string]interface{}{"action": "op"},
+            wantFields:     []string{"op", "username"},
+            unwantedFields: []string{"action"},
+        },
+        {name: "empty name", fieldNames: map[string]interface{}{"username": ""}, wantErr: `"username" is mapped to an empty name`},
+        {name: "duplicate name", fieldNames: map[string]interface{}{"username": "name", "dbname": "name"}, wantErr: `are both mapped to "name"`},
+        {
+            name:       "unmapped field's name",
+            fieldNames: map[string]interface{}{"role": "username"},
+            wantErr:    `"role" is mapped to "username", the name of the unmapped field "username"`,
+        },
+        {
+            name:       "unmapped cid's name",
+            fieldNames: map[string]interface{}{"dbname": "cid"},
+            wantErr:    `"dbname" is mapped to "cid", the name of the unmapped field "cid"`,
+        },
+        {
+            name:       "swapped names",
+            fieldNames: map[string]interface{}{"username": "password", "password": "username"},
+            wantFields: []string{"username", "password"},
+        },
+        {
+            name:       "mapped to itself",
+            fieldNames: map[string]interface{}{"username": "username"},
+            wantFields: []string{"username"},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"field_names": tt.fieldNames}
+            if len(tt.wantErr) > 0 {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+            if _, err := newUser(db, "role", testCreateStatement); err != nil {
+                t.Fatal(err)
+            }
+            sent := backend.received("")
+            req := sent[len(sent)-1]
+            for _, field := range tt.wantFields {
+                if _, ok := req.Body[field]; !ok {
+                    t.Errorf("create body %s lacks %q", req.Raw, field)
+                }
+            }
+            for _, field := range tt.unwantedFields {
+                if _, ok := req.Body[field]; ok {
+                    t.Errorf("create body %s has %q, want it renamed", req.Raw, field)
+                }
+            }
+        })
+    }
+}
+
+func TestFieldNamesQueryAction(t *testing.T) {
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, map[string]interface{}{
+        "action_placement": "query",
+        "field_names":      map[string]interface{}{"action": "op"},
+    })
+    if err := deleteUser(db, "V_USER_R", testDeleteStatement); err != nil {
+        t.Fatal(err)
+    }
+    sent := backend.received("")
+    query := sent[len(sent)-1].Query
+    if got := query.Get("op"); got != string(actionDelUser) || query.Has("action") {
+        t.Fatalf("query = %v, want op=%s", query, actionDelUser)
+    }
+}
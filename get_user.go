@@ -0,0 +1,68 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+)
+
+// getUser asks the backend whether username exists. base holds the statement
+// fields, such as cid, sent along with the lookup; it is not modified. The
+// decoded result is returned when the user exists. Results are cached for
+// get_user_cache_ttl by username and statement fields. Once the backend
+// turned out not to implement GetUser, the error matches errUnsupportedAction
+// without calling it again, so that features relying on it can fall back to
+// not verifying.
+func (c *mgtvMysqlConnectionProducer) getUser(ctx context.Context, username string, base map[string]interface{}) (map[string]interface{}, bool, error) {
+    if c.caps.isUnsupported(actionGetUser) {
+        return nil, false, fmt.Errorf("get user:%s failed: %w", username, errUnsupportedAction)
+    }
+    key, cacheable := userCacheKey(ctx, base)
+    cacheable = cacheable && c.GetUserCacheTTL > 0
+    generation := c.users.current()
+    if cacheable {
+        if cached, ok := c.users.get(username, key, c.clock.Now()); ok {
+            return cached.result, cached.exists, nil
+        }
+    }
+    body, err := c.buildRequest(ctx, actionGetUser, base, map[string]interface{}{"username": username})
+    var result map[string]interface{}
+    if err == nil {
+        result, err = c.invoke(ctx, actionGetUser, body)
+    }
+    if errors.Is(err, errUnsupportedAction) {
+        c.logger.Warn("backend does not support GetUser, features relying on it no longer verify", "error", err)
+        c.caps.markUnsupported(actionGetUser)
+    }
+    if err != nil {
+        return nil, false, fmt.Errorf("get user:%s failed: %w", username, err)
+    }
+    exists, ok := result["exists"].(bool)
+    if !ok {
+        return nil, false, errors.New("get user response does not report whether the user exists")
+    }
+    if !exists {
+        result = nil
+    }
+    if cacheable {
+        c.users.put(username, key, generation, cachedUser{
+            result:  result,
+            exists:  exists,
+            expires: c.clock.Now().Add(c.GetUserCacheTTL * time.Second),
+        })
+    }
+    return result, exists, nil
+}
+
+// copyBody returns a shallow copy of body.
+func copyBody(body map[string]interface{}) map[string]interface{} {
+    copied := make(map[string]interface{}, len(body))
+    for k, v := range body {
+        copied[k] = v
+    }
+    return copied
+}
@@ -0,0 +1,141 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "bytes"
+    "net/http"
+    "strings"
+    "testing"
+
+    "github.com/hashicorp/go-hclog"
+)
+
+func TestVerifyAfterDelete(t *testing.T) {
+    tests := []struct {
+        name   string
+        verify bool
+        // keep has the backend acknowledge the delete without deleting.
+        keep bool
+        // getUserCode, when set, is the http status GetUser fails with.
+        getUserCode  int
+        wantGetUsers int
+        wantErr      string
+    }{
+        {name: "disabled", keep: true},
+        {name: "gone", verify: true, wantGetUsers: 1},
+        {name: "still exists", verify: true, keep: true, wantGetUsers: 1, wantErr: "delete user:V_USER_R reported success but the user still exists"},
+        {name: "GetUser unsupported", verify: true, keep: true, getUserCode: http.StatusNotFound, wantGetUsers: 1},
+        {name: "GetUser failure", verify: true, getUserCode: http.StatusInternalServerError, wantGetUsers: 1, wantErr: "verify delete user:V_USER_R failed"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.users["V_USER_R"] = map[string]interface{}{"username": "V_USER_R"}
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                switch {
+                case req.action() == string(actionDelUser) && tt.keep:
+                    writeJSON(w, map[string]interface{}{"status": 0})
+                    return true
+                case req.action() == string(actionGetUser) && tt.getUserCode != 0:
+                    w.WriteHeader(tt.getUserCode)
+                    return true
+                }
+                return false
+            })
+            db := newTestDB(t, backend.URL, map[string]interface{}{"verify_after_delete": tt.verify})
+
+            err := deleteUser(db, "V_USER_R", testDeleteStatement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("DeleteUser error = %v, want %q", err, tt.wantErr)
+                }
+            } else if err != nil {
+                t.Fatal(err)
+            }
+            if got := len(backend.received(actionGetUser)); got != tt.wantGetUsers {
+                t.Fatalf("%d GetUser calls, want %d", got, tt.wantGetUsers)
+            }
+        })
+    }
+}
+
+// TestGetUserUnsupported degrades the features relying on GetUser to not
+// verifying once the backend turns out not to implement it, asking it only
+// once.
+func TestGetUserUnsupported(t *testing.T) {
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // getUserCode is the http status GetUser is answered with, unless
+        // zero.
+        getUserCode int
+        // ambiguous cuts the create responses short, so that they are
+        // verified with GetUser.
+        ambiguous    bool
+        wantGetUsers int
+    }{
+        {name: "verify_after_delete, 404", config: map[string]interface{}{"verify_after_delete": true}, getUserCode: http.StatusNotFound, wantGetUsers: 1},
+        {name: "verify_after_delete, 501", config: map[string]interface{}{"verify_after_delete": true}, getUserCode: http.StatusNotImplemented, wantGetUsers: 1},
+        {
+            name:   "verify_after_delete, not among capabilities",
+            config: map[string]interface{}{"verify_after_delete": true, "check_capabilities": true},
+        },
+        {
+            name:         "ambiguous create verify, 404",
+            config:       map[string]interface{}{"on_ambiguous_create": ambiguousVerify},
+            getUserCode:  http.StatusNotFound,
+            ambiguous:    true,
+            wantGetUsers: 1,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            report := reportCapabilities(actionAddUser, actionDelUser)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                switch backendAction(req.action()) {
+                case actionGetUser:
+                    if tt.getUserCode != 0 {
+                        w.WriteHeader(tt.getUserCode)
+                        return true
+                    }
+                case actionAddUser:
+                    if tt.ambiguous {
+                        backend.result(req)
+                        truncateResponse(t, w)
+                        return true
+                    }
+                }
+                return report(w, req)
+            })
+            db := newTestDB(t, backend.URL, tt.config)
+            var logs bytes.Buffer
+            db.Lock()
+            db.logger = hclog.New(&hclog.LoggerOptions{Output: &logs})
+            db.Unlock()
+
+            for i := 0; i < 2; i++ {
+                if !tt.ambiguous {
+                    if err := deleteUser(db, "V_USER_R", testDeleteStatement); err != nil {
+                        t.Fatalf("DeleteUser: %v", err)
+                    }
+                    continue
+                }
+                if _, err := newUser(db, "role", testCreateStatement); err == nil {
+                    t.Fatal("ambiguous NewUser succeeded without verifying")
+                }
+            }
+            if n := len(backend.received(actionGetUser)); n != tt.wantGetUsers {
+                t.Fatalf("%d GetUser calls, want %d", n, tt.wantGetUsers)
+            }
+            if tt.ambiguous && len(backend.usernames()) != 0 {
+                t.Errorf("unverified creates not cleaned up: %v", backend.usernames())
+            }
+            if !strings.Contains(logs.String(), "does not support GetUser") {
+                t.Errorf("degradation not warned about:\n%s", logs.String())
+            }
+        })
+    }
+}
@@ -0,0 +1,79 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+)
+
+// verifyConnection checks the health endpoint of every backend. It is a no-op
+// unless health_path is configured, since not every backend exposes one.
+func (c *mgtvMysqlConnectionProducer) verifyConnection(ctx context.Context) error {
+    if len(c.HealthPath) == 0 {
+        return nil
+    }
+    for _, base := range c.backendURLs() {
+        if err := c.checkHealth(ctx, base); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (c *mgtvMysqlConnectionProducer) checkHealth(ctx context.Context, base string) error {
+    u, err := parseBackendURL(base)
+    if err != nil {
+        return fmt.Errorf("invalid connection_url: %w", err)
+    }
+    joinPath(u, c.HealthPath, (&url.URL{Path: c.HealthPath}).EscapedPath())
+    u.RawQuery = ""
+
+    req, err := http.NewRequestWithContext(ctx, c.HealthMethod, u.String(), nil)
+    if err != nil {
+        return err
+    }
+    response, err := c.client().Do(req)
+    if err != nil {
+        return fmt.Errorf("health check %s %s failed: %w", c.HealthMethod, u.Host+u.Path, unreachable(err))
+    }
+    defer response.Body.Close()
+    io.Copy(ioutil.Discard, response.Body)
+    if response.StatusCode != c.HealthExpectedStatus {
+        return fmt.Errorf("health check %s %s failed: http statusCode: %d, expected %d", c.HealthMethod, u.Host+u.Path, response.StatusCode, c.HealthExpectedStatus)
+    }
+    return nil
+}
+
+// errNotInitialized is reported by operations before a successful Initialize.
+var errNotInitialized = errors.New("plugin is not initialized")
+
+// IsHealthy reports whether operations may be sent to the backend: the plugin
+// is initialized and not closed, and not every backend's circuit breaker is
+// open. Operations consult it first, failing fast instead of waiting on a
+// backend that is known to be unusable.
+func (c *mgtvMysqlConnectionProducer) IsHealthy() bool {
+    c.RLock()
+    defer c.RUnlock()
+    return c.health() == nil
+}
+
+// health returns why operations can't be sent to the backend, or nil when
+// they can. It must be called with the lock held.
+func (c *mgtvMysqlConnectionProducer) health() error {
+    switch {
+    case !c.Initialized:
+        return errNotInitialized
+    case c.closed():
+        return errClosed
+    case c.balancer != nil && !c.balancer.available():
+        return errBreakersOpen
+    }
+    return nil
+}
@@ -0,0 +1,179 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// verifyError initializes a plugin with testConfig(config) against backendURL,
+// verifying the connection, and returns the error.
+func verifyError(t *testing.T, backendURL string, config map[string]interface{}) error {
+    t.Helper()
+    setTestEnv(t, backendURL)
+    db := new()
+    db.logger = hclog.NewNullLogger()
+    defer db.Close()
+    _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: testConfig(config), VerifyConnection: true})
+    return err
+}
+
+func TestHealthCheck(t *testing.T) {
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // base is appended to the backend url as connection_url.
+        base string
+        // status is what the backend answers the health check with.
+        status     int
+        wantMethod string
+        wantPath   string
+        wantErr    string
+    }{
+        {name: "no health_path"},
+        {name: "default method", config: map[string]interface{}{"health_path": "/ping"}, wantMethod: "GET", wantPath: "/ping"},
+        {name: "head", config: map[string]interface{}{"health_path": "healthz", "health_method": "head"}, wantMethod: "HEAD", wantPath: "/healthz"},
+        {name: "under a base path", base: "/api/?action=x", config: map[string]interface{}{"health_path": "/status"}, wantMethod: "GET", wantPath: "/api/status"},
+        {name: "expected status", config: map[string]interface{}{"health_path": "/ping", "health_expected_status": 204}, status: 204, wantMethod: "GET", wantPath: "/ping"},
+        {name: "unexpected status", config: map[string]interface{}{"health_path": "/ping"}, status: 503, wantMethod: "GET", wantPath: "/ping", wantErr: "http statusCode: 503, expected 200"},
+        {name: "invalid method", config: map[string]interface{}{"health_path": "/ping", "health_method": "POST"}, wantErr: `invalid health_method "POST"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if tt.status == 0 || req.Path != tt.wantPath {
+                    return false
+                }
+                w.WriteHeader(tt.status)
+                return true
+            })
+            err := verifyError(t, backend.URL+tt.base, tt.config)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+            } else if err != nil {
+                t.Fatalf("Initialize: %v", err)
+            }
+            var checks []recordedRequest
+            for _, req := range backend.received("") {
+                if req.Method != http.MethodPost {
+                    checks = append(checks, req)
+                }
+            }
+            if len(tt.wantPath) == 0 {
+                if len(checks) != 0 {
+                    t.Fatalf("health checked with %v, want no check", checks)
+                }
+                return
+            }
+            if len(checks) != 1 || checks[0].Method != tt.wantMethod || checks[0].Path != tt.wantPath || len(checks[0].Query) != 0 {
+                t.Fatalf("health checked with %+v, want a %s %s", checks, tt.wantMethod, tt.wantPath)
+            }
+        })
+    }
+}
+
+func TestIsHealthy(t *testing.T) {
+    // tripped returns a plugin whose only backend's circuit breaker was
+    // tripped by a failed delete, the backend answering normally since.
+    tripped := func(t *testing.T, backend *fakeBackend, clock *fakeClock) *MgtvMysql {
+        backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+            w.WriteHeader(http.StatusServiceUnavailable)
+            return true
+        })
+        db := newTestDB(t, backend.URL, map[string]interface{}{
+            "backend_urls":      []interface{}{map[string]interface{}{"url": backend.URL, "weight": 1}},
+            "breaker_threshold": 1,
+            "breaker_cooldown":  60,
+        }, WithClock(clock))
+        if err := deleteUser(db, "V_USER_R", testDeleteStatement); err == nil {
+            t.Fatal("DeleteUser succeeded against a failing backend")
+        }
+        backend.setRespond(nil)
+        return db
+    }
+    tests := []struct {
+        name  string
+        setup func(t *testing.T, backend *fakeBackend, clock *fakeClock) *MgtvMysql
+        // wantErr is why operations short-circuit, nil when healthy.
+        wantErr error
+    }{
+        {
+            name: "not initialized",
+            setup: func(t *testing.T, backend *fakeBackend, clock *fakeClock) *MgtvMysql {
+                setTestEnv(t, backend.URL)
+                db := new(WithClock(clock))
+                db.logger = hclog.NewNullLogger()
+                t.Cleanup(func() { db.Close() })
+                return db
+            },
+            wantErr: errNotInitialized,
+        },
+        {
+            name: "initialized",
+            setup: func(t *testing.T, backend *fakeBackend, clock *fakeClock) *MgtvMysql {
+                return newTestDB(t, backend.URL, nil, WithClock(clock))
+            },
+        },
+        {name: "breakers open", setup: tripped, wantErr: errBreakersOpen},
+        {
+            name: "breakers cooled down",
+            setup: func(t *testing.T, backend *fakeBackend, clock *fakeClock) *MgtvMysql {
+                db := tripped(t, backend, clock)
+                clock.Advance(time.Minute)
+                return db
+            },
+        },
+        {
+            name: "closed",
+            setup: func(t *testing.T, backend *fakeBackend, clock *fakeClock) *MgtvMysql {
+                db := newTestDB(t, backend.URL, nil, WithClock(clock))
+                db.Close()
+                return db
+            },
+            wantErr: errClosed,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := tt.setup(t, backend, newFakeClock())
+            if healthy := db.IsHealthy(); healthy != (tt.wantErr == nil) {
+                t.Fatalf("IsHealthy = %v, want %v", healthy, tt.wantErr == nil)
+            }
+
+            before := len(backend.received(""))
+            _, createErr := newUser(db, "role", testCreateStatement)
+            deleteErr := deleteUser(db, "V_USER_R", testDeleteStatement)
+            _, updateErr := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+                Username: "V_USER_R",
+                Password: &dbplugin.ChangePassword{NewPassword: "Passw0rd-0123456789", Statements: statements(testDeleteStatement)},
+            })
+            for op, err := range map[string]error{"NewUser": createErr, "DeleteUser": deleteErr, "UpdateUser": updateErr} {
+                if tt.wantErr == nil {
+                    if err != nil {
+                        t.Errorf("%s: %v", op, err)
+                    }
+                    continue
+                }
+                if !errors.Is(err, tt.wantErr) {
+                    t.Errorf("%s error = %v, want %q", op, err, tt.wantErr)
+                }
+            }
+            if sent := len(backend.received("")) - before; tt.wantErr != nil && sent != 0 {
+                t.Errorf("%d requests sent while unhealthy, want none", sent)
+            }
+        })
+    }
+}
@@ -0,0 +1,30 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "fmt"
+    "net"
+    "strings"
+)
+
+// validateIPList checks that iplist is a comma separated list of CIDRs.
+func validateIPList(iplist string) error {
+    for _, cidr := range strings.Split(iplist, ",") {
+        cidr = strings.TrimSpace(cidr)
+        if _, _, err := net.ParseCIDR(cidr); err != nil {
+            return fmt.Errorf("invalid default_iplist entry %q: must be a CIDR", cidr)
+        }
+    }
+    return nil
+}
+
+// applyDefaultIPList sets the iplist field of body to default_iplist when the
+// create statement omits it, so accounts aren't left open to every address.
+func (c *mgtvMysqlConnectionProducer) applyDefaultIPList(body map[string]interface{}) {
+    if len(c.DefaultIPList) == 0 || body["iplist"] != nil {
+        return
+    }
+    body["iplist"] = c.DefaultIPList
+}
@@ -0,0 +1,58 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestDefaultIPList(t *testing.T) {
+    tests := []struct {
+        name        string
+        defaultList string
+        statement   string
+        // wantIPList is the iplist sent, nil when none is.
+        wantIPList interface{}
+        wantErr    string
+    }{
+        {name: "unset", statement: testCreateStatement},
+        {name: "applied", defaultList: "10.0.0.0/8", statement: testCreateStatement, wantIPList: "10.0.0.0/8"},
+        {name: "applied, several CIDRs", defaultList: "10.0.0.0/8, 192.168.1.0/24", statement: testCreateStatement, wantIPList: "10.0.0.0/8, 192.168.1.0/24"},
+        {name: "statement wins", defaultList: "10.0.0.0/8", statement: `{"cid":"c1","dbname":"d1","iplist":"172.16.0.0/12"}`, wantIPList: "172.16.0.0/12"},
+        {name: "ipv6", defaultList: "fd00::/8", statement: testCreateStatement, wantIPList: "fd00::/8"},
+        {name: "bare address", defaultList: "10.0.0.1", wantErr: `invalid default_iplist entry "10.0.0.1": must be a CIDR`},
+        {name: "empty entry", defaultList: "10.0.0.0/8,", wantErr: `invalid default_iplist entry "": must be a CIDR`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"default_iplist": tt.defaultList}
+            if len(tt.wantErr) > 0 {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+            if _, err := newUser(db, "role", tt.statement); err != nil {
+                t.Fatal(err)
+            }
+            if got := backend.received(actionAddUser)[0].Body["iplist"]; got != tt.wantIPList {
+                t.Fatalf("iplist sent as %v, want %v", got, tt.wantIPList)
+            }
+        })
+    }
+}
+
+// TestDefaultIPListCanary creates the init_canary account under the default
+// iplist as well.
+func TestDefaultIPListCanary(t *testing.T) {
+    backend := newFakeBackend(t)
+    newTestDB(t, backend.URL, map[string]interface{}{"default_iplist": "10.0.0.0/8", "init_canary": true, "init_canary_statement": testCreateStatement})
+    if got := backend.received(actionAddUser)[0].Body["iplist"]; got != "10.0.0.0/8" {
+        t.Fatalf("canary iplist sent as %v, want 10.0.0.0/8", got)
+    }
+}
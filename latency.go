@@ -0,0 +1,90 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "sort"
+    "sync"
+    "time"
+)
+
+// latencyWindowSize bounds the samples kept per action; older ones are
+// overwritten.
+const latencyWindowSize = 1024
+
+// LatencyPercentiles summarizes the most recent backend call latencies of an
+// action.
+type LatencyPercentiles struct {
+    // Count is the number of samples the percentiles were computed from.
+    Count int
+    P50   time.Duration
+    P95   time.Duration
+    P99   time.Duration
+}
+
+// latencyRecorder keeps a bounded window of latencies per action.
+type latencyRecorder struct {
+    mu      sync.Mutex
+    windows map[string]*latencyWindow
+}
+
+type latencyWindow struct {
+    samples []time.Duration
+    next    int
+}
+
+func (r *latencyRecorder) record(action string, d time.Duration) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.windows == nil {
+        r.windows = make(map[string]*latencyWindow)
+    }
+    w, ok := r.windows[action]
+    if !ok {
+        w = &latencyWindow{}
+        r.windows[action] = w
+    }
+    if len(w.samples) < latencyWindowSize {
+        w.samples = append(w.samples, d)
+        return
+    }
+    w.samples[w.next] = d
+    w.next = (w.next + 1) % latencyWindowSize
+}
+
+func (r *latencyRecorder) snapshot() map[string]LatencyPercentiles {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    snapshot := make(map[string]LatencyPercentiles, len(r.windows))
+    for action, w := range r.windows {
+        sorted := make([]time.Duration, len(w.samples))
+        copy(sorted, w.samples)
+        sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+        snapshot[action] = LatencyPercentiles{
+            Count: len(sorted),
+            P50:   percentile(sorted, 50),
+            P95:   percentile(sorted, 95),
+            P99:   percentile(sorted, 99),
+        }
+    }
+    return snapshot
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted.
+func percentile(sorted []time.Duration, p int) time.Duration {
+    if len(sorted) == 0 {
+        return 0
+    }
+    rank := (p*len(sorted) + 99) / 100
+    if rank < 1 {
+        rank = 1
+    }
+    return sorted[rank-1]
+}
+
+// LatencySnapshot returns the backend call latency percentiles per action,
+// computed over the most recent calls.
+func (m *MgtvMysql) LatencySnapshot() map[string]LatencyPercentiles {
+    return m.latency.snapshot()
+}
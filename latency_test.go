@@ -0,0 +1,86 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "math/rand"
+    "net/http"
+    "testing"
+    "time"
+)
+
+func TestLatencyPercentiles(t *testing.T) {
+    ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+    series := func(from, to int) []time.Duration {
+        var samples []time.Duration
+        for i := from; i <= to; i++ {
+            samples = append(samples, ms(i))
+        }
+        return samples
+    }
+    tests := []struct {
+        name    string
+        samples []time.Duration
+        // inOrder records the samples in order rather than shuffled.
+        inOrder bool
+        want    LatencyPercentiles
+    }{
+        {name: "single", samples: []time.Duration{ms(7)}, want: LatencyPercentiles{Count: 1, P50: ms(7), P95: ms(7), P99: ms(7)}},
+        {name: "ten", samples: series(1, 10), want: LatencyPercentiles{Count: 10, P50: ms(5), P95: ms(10), P99: ms(10)}},
+        {name: "hundred", samples: series(1, 100), want: LatencyPercentiles{Count: 100, P50: ms(50), P95: ms(95), P99: ms(99)}},
+        {name: "thousand", samples: series(1, 1000), want: LatencyPercentiles{Count: 1000, P50: ms(500), P95: ms(950), P99: ms(990)}},
+        // The samples from 1..100ms overwrite the oldest, 1001..1100ms,
+        // leaving 1..100 and 1101..2024 in the window.
+        {
+            name:    "window overwritten",
+            samples: append(series(1001, 1000+latencyWindowSize), series(1, 100)...),
+            inOrder: true,
+            want:    LatencyPercentiles{Count: latencyWindowSize, P50: ms(1512), P95: ms(1973), P99: ms(2014)},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var r latencyRecorder
+            // Order doesn't matter within the window.
+            shuffled := append([]time.Duration(nil), tt.samples...)
+            if !tt.inOrder {
+                rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+            }
+            for _, d := range shuffled {
+                r.record("AddUser", d)
+            }
+            if got := r.snapshot()["AddUser"]; got != tt.want {
+                t.Fatalf("percentiles = %+v, want %+v", got, tt.want)
+            }
+        })
+    }
+}
+
+// TestLatencySnapshot has the backend move the fake clock by a known latency
+// per call.
+func TestLatencySnapshot(t *testing.T) {
+    backend := newFakeBackend(t)
+    clock := newFakeClock()
+    db := newTestDB(t, backend.URL, nil, WithClock(clock))
+    var latency time.Duration
+    backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+        clock.Advance(latency)
+        return false
+    })
+    for i := 1; i <= 20; i++ {
+        latency = time.Duration(i) * time.Millisecond
+        if err := deleteUser(db, "V_USER_R", testDeleteStatement); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    snapshot := db.LatencySnapshot()
+    want := LatencyPercentiles{Count: 20, P50: 10 * time.Millisecond, P95: 19 * time.Millisecond, P99: 20 * time.Millisecond}
+    if got := snapshot[string(actionDelUser)]; got != want {
+        t.Fatalf("%s percentiles = %+v, want %+v", actionDelUser, got, want)
+    }
+    if _, ok := snapshot[string(actionAddUser)]; ok {
+        t.Fatalf("snapshot has %s without any such call", actionAddUser)
+    }
+}
@@ -0,0 +1,69 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "fmt"
+    "time"
+)
+
+// errClosed is returned by backend calls aborted because the plugin was
+// closed. It wraps context.Canceled.
+var errClosed = fmt.Errorf("plugin closed: %w", context.Canceled)
+
+// operationContext derives the context of a backend call from ctx, cancelling
+// it as well when the plugin is closed.
+func (c *mgtvMysqlConnectionProducer) operationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+    ctx, cancel := context.WithCancel(ctx)
+    if c.closeCtx == nil {
+        return ctx, cancel
+    }
+    go func() {
+        select {
+        case <-c.closeCtx.Done():
+            cancel()
+        case <-ctx.Done():
+        }
+    }()
+    return ctx, cancel
+}
+
+// closed reports whether Close was called.
+func (c *mgtvMysqlConnectionProducer) closed() bool {
+    return c.closeCtx != nil && c.closeCtx.Err() != nil
+}
+
+// startPostInitDelay holds back backend calls for post_init_delay from now.
+func (c *mgtvMysqlConnectionProducer) startPostInitDelay() {
+    c.readyLock.Lock()
+    defer c.readyLock.Unlock()
+    c.readyAt = c.clock.Now().Add(c.PostInitDelay * time.Second)
+}
+
+// waitReady blocks until post_init_delay has passed since Initialize, ctx is
+// done or the plugin is closed.
+func (c *mgtvMysqlConnectionProducer) waitReady(ctx context.Context) error {
+    c.readyLock.Lock()
+    readyAt := c.readyAt
+    c.readyLock.Unlock()
+    wait := readyAt.Sub(c.clock.Now())
+    if wait <= 0 {
+        return nil
+    }
+    c.logger.Debug("waiting for post_init_delay before calling the backend", "wait", wait)
+    ctx, cancel := c.operationContext(ctx)
+    defer cancel()
+    select {
+    case <-ctx.Done():
+        if c.closed() {
+            return errClosed
+        }
+        // Not wrapped, so that a create given up on before it was sent isn't
+        // taken for an ambiguous one.
+        return fmt.Errorf("gave up waiting for post_init_delay: %v", ctx.Err())
+    case <-c.clock.After(wait):
+        return nil
+    }
+}
@@ -0,0 +1,155 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestCloseCancelsCalls(t *testing.T) {
+    tests := []struct {
+        name   string
+        action backendAction
+        call   func(db *MgtvMysql) error
+    }{
+        {name: "NewUser", action: actionAddUser, call: func(db *MgtvMysql) error {
+            _, err := newUser(db, "role", testCreateStatement)
+            return err
+        }},
+        {name: "DeleteUser", action: actionDelUser, call: func(db *MgtvMysql) error {
+            return deleteUser(db, "V_USER_R", testDeleteStatement)
+        }},
+        {name: "UpdateUser", action: actionChangePassword, call: func(db *MgtvMysql) error {
+            _, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+                Username: "V_USER_R",
+                Password: &dbplugin.ChangePassword{NewPassword: "Passw0rd-0123456789", Statements: statements(testDeleteStatement)},
+            })
+            return err
+        }},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, nil)
+            // The backend holds the call until the test ends.
+            arrived := make(chan struct{}, 1)
+            release := make(chan struct{})
+            t.Cleanup(func() { close(release) })
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(tt.action) {
+                    return false
+                }
+                arrived <- struct{}{}
+                <-release
+                return true
+            })
+
+            done := make(chan error, 1)
+            go func() { done <- tt.call(db) }()
+            <-arrived
+            db.Close()
+            select {
+            case err := <-done:
+                if !errors.Is(err, context.Canceled) {
+                    t.Fatalf("%s error = %v, want a cancellation", tt.name, err)
+                }
+            case <-time.After(5 * time.Second):
+                t.Fatalf("%s didn't return once the plugin was closed", tt.name)
+            }
+
+            // Calls made after Close fail without reaching the backend.
+            before := len(backend.received(tt.action))
+            if err := tt.call(db); !errors.Is(err, context.Canceled) {
+                t.Fatalf("%s after Close error = %v, want a cancellation", tt.name, err)
+            }
+            if after := len(backend.received(tt.action)); after != before {
+                t.Fatalf("%s after Close reached the backend", tt.name)
+            }
+        })
+    }
+}
+
+func TestPostInitDelay(t *testing.T) {
+    tests := []struct {
+        name  string
+        delay int
+        // end is how the wait of the first create ends: "elapsed",
+        // "cancelled" or "closed". It doesn't wait without a delay.
+        end     string
+        wantErr string
+    }{
+        {name: "disabled"},
+        {name: "elapsed", delay: 5, end: "elapsed"},
+        {name: "cancelled", delay: 5, end: "cancelled", wantErr: "gave up waiting for post_init_delay: context canceled"},
+        {name: "closed", delay: 5, end: "closed", wantErr: errClosed.Error()},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            clock := newFakeClock()
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, map[string]interface{}{"post_init_delay": tt.delay}, WithClock(clock))
+            create := func(ctx context.Context) error {
+                _, err := db.NewUser(ctx, dbplugin.NewUserRequest{
+                    UsernameConfig: dbplugin.UsernameMetadata{DisplayName: "token", RoleName: "role"},
+                    Statements:     statements(testCreateStatement),
+                    Password:       "Passw0rd-0123456789",
+                })
+                return err
+            }
+
+            ctx, cancel := context.WithCancel(context.Background())
+            defer cancel()
+            done := make(chan error, 1)
+            go func() { done <- create(ctx) }()
+            if tt.delay > 0 {
+                clock.waitForTimers(t, 1)
+                if n := len(backend.received(actionAddUser)); n != 0 {
+                    t.Fatalf("AddUser sent %d times during post_init_delay", n)
+                }
+                switch tt.end {
+                case "elapsed":
+                    clock.Advance(time.Duration(tt.delay) * time.Second)
+                case "cancelled":
+                    cancel()
+                case "closed":
+                    db.Close()
+                }
+            }
+            var err error
+            select {
+            case err = <-done:
+            case <-time.After(5 * time.Second):
+                t.Fatal("NewUser didn't return")
+            }
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.HasSuffix(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                if n := len(backend.received(actionAddUser)); n != 0 {
+                    t.Fatalf("AddUser sent %d times, want none", n)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            // Only the first operation waited: the next one goes through
+            // without the clock moving.
+            if err := create(context.Background()); err != nil {
+                t.Fatal(err)
+            }
+            if n := len(backend.received(actionAddUser)); n != 2 {
+                t.Fatalf("AddUser sent %d times, want 2", n)
+            }
+        })
+    }
+}
@@ -0,0 +1,33 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "strings"
+)
+
+// logName returns how username appears in log lines: as is, or with
+// mask_usernames as a stable hash, so that lines about the same user can
+// still be correlated. The real username is always what is sent.
+func (c *mgtvMysqlConnectionProducer) logName(username string) string {
+    if !c.MaskUsernames {
+        return username
+    }
+    sum := sha256.Sum256([]byte(username))
+    return "user-" + hex.EncodeToString(sum[:6])
+}
+
+// logError returns the message of err for a log line, with username replaced
+// by its logName.
+func (c *mgtvMysqlConnectionProducer) logError(err error, username string) string {
+    if err == nil {
+        return ""
+    }
+    if !c.MaskUsernames || len(username) == 0 {
+        return err.Error()
+    }
+    return strings.ReplaceAll(err.Error(), username, c.logName(username))
+}
@@ -0,0 +1,79 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "bytes"
+    "net/http"
+    "strings"
+    "sync"
+    "testing"
+
+    "github.com/hashicorp/go-hclog"
+)
+
+func TestMaskUsernames(t *testing.T) {
+    tests := []struct {
+        name string
+        mask bool
+    }{
+        {name: "disabled"},
+        {name: "enabled", mask: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            // The first create is made and its response cut short, so that
+            // the ambiguous create is logged along with its error.
+            var once sync.Once
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                truncated := false
+                if req.action() == string(actionAddUser) {
+                    once.Do(func() {
+                        backend.result(req)
+                        truncateResponse(t, w)
+                        truncated = true
+                    })
+                }
+                return truncated
+            })
+            db := newTestDB(t, backend.URL, map[string]interface{}{
+                "mask_usernames":      tt.mask,
+                "on_ambiguous_create": ambiguousSuccess,
+            })
+            var logs bytes.Buffer
+            db.logger = hclog.New(&hclog.LoggerOptions{Output: &logs, Level: hclog.Debug})
+
+            var usernames []string
+            for i := 0; i < 2; i++ {
+                username, err := newUser(db, "role", testCreateStatement)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                usernames = append(usernames, username)
+            }
+            if !strings.Contains(logs.String(), "create outcome is ambiguous") {
+                t.Fatalf("ambiguous create not logged:\n%s", logs.String())
+            }
+            for i, username := range usernames {
+                // The real name is what the backend gets either way.
+                if !backend.has(username) {
+                    t.Errorf("backend doesn't hold %q", username)
+                }
+                if strings.Contains(logs.String(), username) == tt.mask {
+                    t.Errorf("%q in the logs: %v, want %v:\n%s", username, !tt.mask, !tt.mask, logs.String())
+                }
+                // Masked names are stable, so that the two lines about the
+                // ambiguous create can be correlated.
+                lines := 1
+                if i == 0 {
+                    lines = 2
+                }
+                if masked := db.logName(username); tt.mask && strings.Count(logs.String(), masked) != lines {
+                    t.Errorf("%q logged as %q, want it on %d lines:\n%s", username, masked, lines, logs.String())
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,60 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import "expvar"
+
+// expvarNamespace is the expvar key the plugin's counters are published under.
+const expvarNamespace = "mgtv_mysql"
+
+// Error classes counted in the errors expvar map.
+const (
+    errClassTransport  = "transport"
+    errClassHTTPStatus = "http_status"
+    errClassDecode     = "decode"
+    errClassBackend    = "backend"
+)
+
+// pluginMetrics is published once per process, as expvar names must be unique.
+var pluginMetrics = newMetrics(expvarNamespace)
+
+// metrics are backend call counters published via expvar.
+type metrics struct {
+    operations *expvar.Map
+    errors     *expvar.Map
+    inFlight   *expvar.Int
+    retries    *expvar.Int
+}
+
+func newMetrics(namespace string) *metrics {
+    m := &metrics{
+        operations: (&expvar.Map{}).Init(),
+        errors:     (&expvar.Map{}).Init(),
+        inFlight:   &expvar.Int{},
+        retries:    &expvar.Int{},
+    }
+    root := expvar.NewMap(namespace)
+    root.Set("operations", m.operations)
+    root.Set("errors", m.errors)
+    root.Set("in_flight", m.inFlight)
+    root.Set("retries", m.retries)
+    return m
+}
+
+// begin counts a backend call for action. The returned func marks it done.
+func (m *metrics) begin(action string) func() {
+    m.operations.Add(action, 1)
+    m.inFlight.Add(1)
+    return func() {
+        m.inFlight.Add(-1)
+    }
+}
+
+func (m *metrics) failure(class string) {
+    m.errors.Add(class, 1)
+}
+
+func (m *metrics) retry() {
+    m.retries.Add(1)
+}
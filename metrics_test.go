@@ -0,0 +1,133 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "expvar"
+    "net/http"
+    "testing"
+)
+
+// expvarSnapshot reads the published counters, keyed "operations.<action>",
+// "errors.<class>", "in_flight" and "retries".
+func expvarSnapshot(t *testing.T) map[string]int64 {
+    t.Helper()
+    root, ok := expvar.Get(expvarNamespace).(*expvar.Map)
+    if !ok {
+        t.Fatalf("expvar %q isn't published", expvarNamespace)
+    }
+    snapshot := make(map[string]int64)
+    root.Do(func(kv expvar.KeyValue) {
+        switch v := kv.Value.(type) {
+        case *expvar.Int:
+            snapshot[kv.Key] = v.Value()
+        case *expvar.Map:
+            v.Do(func(inner expvar.KeyValue) {
+                snapshot[kv.Key+"."+inner.Key] = inner.Value.(*expvar.Int).Value()
+            })
+        }
+    })
+    return snapshot
+}
+
+func TestExpvarCounters(t *testing.T) {
+    tests := []struct {
+        name    string
+        respond func(w http.ResponseWriter, req recordedRequest) bool
+        wantErr bool
+        // want are the counters expected to move, by how much. The others
+        // must not.
+        want map[string]int64
+    }{
+        {
+            name: "success",
+            want: map[string]int64{"operations." + string(actionDelUser): 1},
+        },
+        {
+            name: "backend status",
+            respond: func(w http.ResponseWriter, req recordedRequest) bool {
+                writeJSON(w, map[string]interface{}{"status": 1, "error": "no such user"})
+                return true
+            },
+            wantErr: true,
+            want:    map[string]int64{"operations." + string(actionDelUser): 1, "errors." + errClassBackend: 1},
+        },
+        {
+            name: "http status",
+            respond: func(w http.ResponseWriter, req recordedRequest) bool {
+                w.WriteHeader(http.StatusInternalServerError)
+                return true
+            },
+            wantErr: true,
+            want:    map[string]int64{"operations." + string(actionDelUser): 1, "errors." + errClassHTTPStatus: 1},
+        },
+        {
+            name: "decode",
+            respond: func(w http.ResponseWriter, req recordedRequest) bool {
+                w.Write([]byte("not json"))
+                return true
+            },
+            wantErr: true,
+            want:    map[string]int64{"operations." + string(actionDelUser): 1, "errors." + errClassDecode: 1},
+        },
+        {
+            // The resend with the re-read token is part of the same call.
+            name:    "token refresh",
+            respond: rejectFirst(actionDelUser),
+            want:    map[string]int64{"operations." + string(actionDelUser): 1, "retries": 1},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, nil)
+            backend.setRespond(tt.respond)
+
+            before := expvarSnapshot(t)
+            err := deleteUser(db, "V_USER_R", testDeleteStatement)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("DeleteUser error = %v, want an error: %v", err, tt.wantErr)
+            }
+            after := expvarSnapshot(t)
+            for key, value := range after {
+                if got := value - before[key]; got != tt.want[key] {
+                    t.Errorf("%s moved by %d, want %d", key, got, tt.want[key])
+                }
+            }
+            for key := range tt.want {
+                if _, ok := after[key]; !ok {
+                    t.Errorf("%s isn't published", key)
+                }
+            }
+        })
+    }
+}
+
+func TestExpvarInFlight(t *testing.T) {
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, nil)
+    release := make(chan struct{})
+    inFlight := make(chan int64, 1)
+    backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+        if req.action() == string(actionDelUser) {
+            inFlight <- expvarSnapshot(t)["in_flight"]
+            <-release
+        }
+        return false
+    })
+
+    before := expvarSnapshot(t)["in_flight"]
+    done := make(chan error, 1)
+    go func() { done <- deleteUser(db, "V_USER_R", testDeleteStatement) }()
+    if got := <-inFlight - before; got != 1 {
+        t.Errorf("in_flight moved by %d during the call, want 1", got)
+    }
+    close(release)
+    if err := <-done; err != nil {
+        t.Fatal(err)
+    }
+    if got := expvarSnapshot(t)["in_flight"] - before; got != 0 {
+        t.Errorf("in_flight moved by %d after the call, want 0", got)
+    }
+}
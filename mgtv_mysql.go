@@ -4,14 +4,11 @@
 package mgmysql
 
 import (
-    "bytes"
     "context"
     "encoding/json"
     "errors"
     "fmt"
     "github.com/hashicorp/go-hclog"
-    "io/ioutil"
-    "os"
     "strings"
     "time"
 
@@ -25,8 +22,9 @@ const (
     defaultTimeout       = 20000 * time.Millisecond
     maxKeyLength         = 13
     mysqlToken           = "mysql_token"
-    addUser              = "AddUser"
-    delUser              = "VaultDelUser"
+    mysqlRevokeToken     = "mysql_revoke_token"
+    mysqlSigningKey      = "mysql_signing_key"
+    passwordLength       = 20
     vaultMysqlDb         = "vault_mysql_db"
 )
 
@@ -53,19 +51,31 @@ type MgtvMysql struct {
 
 // New implements builtinplugins.BuiltinFactory
 func New() (interface{}, error) {
-    db := new()
+    return NewWithOptions()
+}
+
+// NewWithOptions is like New, applying opts to the plugin before it is wrapped.
+func NewWithOptions(opts ...Option) (interface{}, error) {
+    db := new(opts...)
     // Wrap the plugin with middleware to sanitize errors
     dbType := dbplugin.NewDatabaseErrorSanitizerMiddleware(db, db.secretValues)
     return dbType, nil
 }
 
-func new() *MgtvMysql {
+func new(opts ...Option) *MgtvMysql {
     connProducer := &mgtvMysqlConnectionProducer{}
     connProducer.Type = mysqlTypeName
+    connProducer.logger = hclog.New(&hclog.LoggerOptions{})
+    connProducer.clock = realClock{}
+    connProducer.closeCtx, connProducer.closeCancel = context.WithCancel(context.Background())
 
-    return &MgtvMysql{
+    db := &MgtvMysql{
         mgtvMysqlConnectionProducer: connProducer,
     }
+    for _, opt := range opts {
+        opt(db)
+    }
+    return db
 }
 
 func (c *MgtvMysql) Initialize(ctx context.Context, req dbplugin.InitializeRequest) (dbplugin.InitializeResponse, error) {
@@ -74,7 +84,7 @@ func (c *MgtvMysql) Initialize(ctx context.Context, req dbplugin.InitializeReque
         return dbplugin.InitializeResponse{}, err
     }
     resp := dbplugin.InitializeResponse{
-        Config: req.Config,
+        Config: savedConfig(req.Config),
     }
     return resp, nil
 }
@@ -93,23 +103,32 @@ func nameTrunc(str string, l int) string {
     }
 }
 
-func (c *MgtvMysql) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (dbplugin.NewUserResponse, error) {
-    // Grab the lock
-    c.Lock()
-    defer c.Unlock()
-    username, err := credsutil.GenerateUsername(credsutil.DisplayName("", maxKeyLength))
-    username = nameTrunc(username, maxKeyLength)
-    if err != nil {
-        return dbplugin.NewUserResponse{}, fmt.Errorf("failed to generate username: %w", err)
+func (c *MgtvMysql) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (_ dbplugin.NewUserResponse, err error) {
+    var password string
+    defer func() { err = c.redactError(err, req.Password, password) }()
+
+    // Only the read lock is held, keeping Initialize from replacing the config
+    // during the call, so that creates run concurrently.
+    c.RLock()
+    defer c.RUnlock()
+
+    // The role's slot is held until the create is done, whether it succeeds
+    // or not.
+    role := req.UsernameConfig.RoleName
+    if !c.roleCreates.tryAcquire(role, c.MaxConcurrentCreatesPerRole) {
+        return dbplugin.NewUserResponse{}, fmt.Errorf("too many concurrent creates for role %q: limit is %d", role, c.MaxConcurrentCreatesPerRole)
     }
-    username = strings.ToUpper(username)
+    defer c.roleCreates.release(role)
 
-    statements := req.Statements.Commands
-    token := os.Getenv(mysqlToken)
-    if len(token) == 0 {
-        return dbplugin.NewUserResponse{}, errors.New("not exist mysql token")
+    if err := c.health(); err != nil {
+        return dbplugin.NewUserResponse{}, fmt.Errorf("create user failed: %w", err)
+    }
+    password = c.hashPassword(req.Password)
+    if err := c.checkPasswordLength(req.Password); err != nil {
+        return dbplugin.NewUserResponse{}, err
     }
 
+    statements := req.Statements.Commands
     if len(statements) > 1 {
         return dbplugin.NewUserResponse{}, errors.New("a maximum of one create_statement is supported")
     }
@@ -117,46 +136,133 @@ func (c *MgtvMysql) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (d
         return dbplugin.NewUserResponse{}, errors.New("create_statement is empty")
     }
     statement := statements[0]
+    if c.MaxStatementBytes > 0 && len(statement) > c.MaxStatementBytes {
+        return dbplugin.NewUserResponse{}, fmt.Errorf("create_statement is %d bytes, exceeding max_statement_bytes %d", len(statement), c.MaxStatementBytes)
+    }
     body := make(map[string]interface{})
     err = json.Unmarshal([]byte(statement), &body)
     if err != nil {
         return dbplugin.NewUserResponse{}, err
     }
-    if body["priv"] != nil && body["priv"] != 0 && body["priv"] != "0" {
-        username = fmt.Sprintf("%s_%s", username, "rw")
-    } else {
-        username = fmt.Sprintf("%s_%s", username, "r")
+    if err := c.checkStatementFields(body); err != nil {
+        return dbplugin.NewUserResponse{}, err
     }
-    body["username"] = username
-    body["password"] = req.Password
-    body["action"] = addUser
-    body["token"] = token
-    marshal, err := json.Marshal(body)
+    overrides, err := c.takeOverrides(body)
     if err != nil {
         return dbplugin.NewUserResponse{}, err
     }
-    logger := hclog.New(&hclog.LoggerOptions{})
-    logger.Info("request db create user body:",marshal)
-    response, err := c.httpClient.Post(c.ConnectionURL, "application/json", bytes.NewReader(marshal))
+    ctx = withOverrides(ctx, overrides)
+    passthrough, err := c.takePassthrough(body)
     if err != nil {
-        return dbplugin.NewUserResponse{}, fmt.Errorf("invoke db create user: %s failed: %s", username, err)
+        return dbplugin.NewUserResponse{}, err
     }
-    if response.StatusCode != 200 {
-        return dbplugin.NewUserResponse{}, fmt.Errorf("invoke db create user:%s failed: http statusCode: %s", username,response.StatusCode)
+    explicit, err := c.takeExplicitUsername(body)
+    if err != nil {
+        return dbplugin.NewUserResponse{}, err
     }
-    resp_body, err := ioutil.ReadAll(response.Body)
+    err = c.applyEngine(body)
     if err != nil {
-        return dbplugin.NewUserResponse{}, fmt.Errorf("invoke db create user:%s failed: %s",username, err)
+        return dbplugin.NewUserResponse{}, err
+    }
+    c.applyDefaultIPList(body)
+    if body["priv"] == nil {
+        switch c.DefaultPriv {
+        case defaultPrivError:
+            return dbplugin.NewUserResponse{}, errors.New("create_statement does not contain priv")
+        case defaultPrivReadWrite:
+            body["priv"] = 1
+        }
+    }
+    priv := PrivReadOnly
+    if body["priv"] != nil {
+        priv, err = NormalizePriv(body["priv"])
+        if err != nil {
+            return dbplugin.NewUserResponse{}, err
+        }
+        body["priv"] = priv.wire()
+    }
+    if len(c.maxPriv) > 0 && priv.exceeds(c.maxPriv) {
+        return dbplugin.NewUserResponse{}, fmt.Errorf("create_statement requests priv %s, exceeding max_priv %s", priv, c.maxPriv)
+    }
+    if c.MaxUsersPerRole[role] > 0 {
+        unlock := c.roleCapLocks.lock(role)
+        defer unlock()
+    }
+    if err := c.checkRoleCap(ctx, role, copyBody(body)); err != nil {
+        return dbplugin.NewUserResponse{}, err
+    }
+    var username string
+    if len(explicit) > 0 {
+        username, err = c.explicitUsername(explicit, priv.suffix(), c.usernameCase(body["engine"].(string)))
+    } else {
+        username, err = c.generateUsername(&usernameAttempts{}, role, priv.suffix(), c.usernameCase(body["engine"].(string)))
     }
-    result := make(map[string]interface{})
-    err = json.Unmarshal(resp_body, &result)
     if err != nil {
-        return dbplugin.NewUserResponse{}, fmt.Errorf("invoke db create user:%s failed: %s",username, err)
+        return dbplugin.NewUserResponse{}, err
     }
-    status := result["status"]
-    if status.(float64) != 0 {
-        return dbplugin.NewUserResponse{}, fmt.Errorf("invoke db create user:%s failed: %s",username, result["error"])
+    for field, value := range passthrough {
+        body[field] = value
     }
+    statementFields := copyBody(body)
+    createAction := actionAddUser
+    if c.TwoPhaseCreate {
+        createAction = actionPrepareUser
+    }
+    // role and created_at let users be revoked by role and creation window.
+    body, err = c.buildRequest(ctx, createAction, statementFields, map[string]interface{}{
+        "username":   username,
+        "password":   password,
+        "role":       role,
+        "created_at": c.clock.Now().UTC().Format(createdAtLayout),
+    })
+    if err != nil {
+        return dbplugin.NewUserResponse{}, err
+    }
+    var rendered *renderedBody
+    if c.requestTemplate != nil {
+        data := templateData{
+            Action:    string(createAction),
+            Username:  username,
+            Password:  password,
+            Token:     body["token"].(string),
+            Priv:      body["priv"],
+            Role:      req.UsernameConfig.RoleName,
+            Statement: statementFields,
+        }
+        if !req.Expiration.IsZero() {
+            data.Expiry = req.Expiration.Format(time.RFC3339)
+        }
+        rendered, err = c.renderBody(data)
+        if err != nil {
+            return dbplugin.NewUserResponse{}, err
+        }
+    }
+    c.logger.Info("request db create user", "username", c.logName(username))
+    result, err := c.invokeRendered(ctx, createAction, body, rendered)
+    c.invalidateUser(username)
+    if c.TwoPhaseCreate {
+        result, err = c.finishTwoPhase(ctx, username, statementFields, err)
+    } else if err != nil && isAmbiguous(err) {
+        err = c.resolveAmbiguousCreate(ctx, username, statementFields, err)
+        if err == nil {
+            c.emitEvent(ctx, EventCredentialCreate, username, map[string]interface{}{"role": role})
+            return dbplugin.NewUserResponse{Username: username}, nil
+        }
+    }
+    if err != nil {
+        return dbplugin.NewUserResponse{}, &CreateUserError{Username: username, Err: err}
+    }
+    if c.ConfirmEcho {
+        if err := c.confirmEcho(body, result); err != nil {
+            return dbplugin.NewUserResponse{}, &CreateUserError{Username: username, Err: err}
+        }
+    }
+    c.captureConnectionDetails(username, result)
+    metadata := map[string]interface{}{"role": role}
+    if id := c.accountID(username); len(id) > 0 {
+        metadata["account_id"] = id
+    }
+    c.emitEvent(ctx, EventCredentialCreate, username, metadata)
 
     resp := dbplugin.NewUserResponse{
         Username: username,
@@ -166,19 +272,45 @@ func (c *MgtvMysql) NewUser(ctx context.Context, req dbplugin.NewUserRequest) (d
 
 func (c *MgtvMysql) UpdateUser(ctx context.Context, req dbplugin.UpdateUserRequest) (dbplugin.UpdateUserResponse, error) {
     if req.Password != nil {
-        err := c.changeUserPassword(ctx, req.Username, req.Password.NewPassword)
-        return dbplugin.UpdateUserResponse{}, err
+        err := c.changeUserPassword(ctx, req.Username, req.Password.NewPassword, req.Password.Statements)
+        if err == nil {
+            c.RLock()
+            c.emitEvent(ctx, EventCredentialRotate, req.Username, nil)
+            c.RUnlock()
+        }
+        return dbplugin.UpdateUserResponse{}, c.redactError(err, req.Password.NewPassword)
     }
     return dbplugin.UpdateUserResponse{}, nil
 }
 
-func (c *MgtvMysql) DeleteUser(ctx context.Context, req dbplugin.DeleteUserRequest) (dbplugin.DeleteUserResponse, error) {
+// DeleteUser revokes req.Username. Concurrent identical deletes, as seen in
+// lease revocation storms, are coalesced into a single backend call whose
+// result every caller shares.
+func (c *MgtvMysql) DeleteUser(ctx context.Context, req dbplugin.DeleteUserRequest) (_ dbplugin.DeleteUserResponse, err error) {
+    defer func() { err = c.redactError(err) }()
+
+    key := req.Username + "\x00" + strings.Join(req.Statements.Commands, "\x00")
+    shared, err := c.deletes.do(key, func() error {
+        return c.deleteUser(ctx, req)
+    })
+    if shared {
+        c.RLock()
+        c.logger.Debug("coalesced identical in-flight delete", "username", c.logName(req.Username))
+        c.RUnlock()
+    }
+    return dbplugin.DeleteUserResponse{}, err
+}
+
+func (c *MgtvMysql) deleteUser(ctx context.Context, req dbplugin.DeleteUserRequest) error {
     c.Lock()
     defer c.Unlock()
 
     username := req.Username
+    if err := c.health(); err != nil {
+        return fmt.Errorf("revocation %s failed: %w", username, err)
+    }
     if len(req.Statements.Commands) == 0 {
-        return dbplugin.DeleteUserResponse{}, fmt.Errorf("revocation % failed,Revocation Statements is empty", username)
+        return fmt.Errorf("revocation %s failed,Revocation Statements is empty", username)
     }
     revocation_str := req.Statements.Commands[0]
     //revocationJson, e := json.Marshal(revocation_str)
@@ -188,50 +320,194 @@ func (c *MgtvMysql) DeleteUser(ctx context.Context, req dbplugin.DeleteUserReque
     revocation := make(map[string]interface{})
     err := json.Unmarshal([]byte(revocation_str), &revocation)
     if err != nil {
-        return dbplugin.DeleteUserResponse{}, err
+        return err
     }
-    revocation["action"] = delUser
-    revocation["token"] = os.Getenv(mysqlToken)
-    revocation["username"] = username
-    body, e := json.Marshal(revocation)
-    if e != nil {
-        return dbplugin.DeleteUserResponse{}, e
+    err = c.applyEngine(revocation)
+    if err != nil {
+        return err
+    }
+    fields := map[string]interface{}{"username": username}
+    // Backends keying deletion on their own id get the one captured at create.
+    id := c.accountID(username)
+    if len(id) > 0 {
+        fields["account_id"] = id
     }
-    response, err := c.httpClient.Post(c.ConnectionURL, "application/json", bytes.NewReader(body))
+    body, err := c.buildRequest(ctx, actionDelUser, revocation, fields)
     if err != nil {
-        return dbplugin.DeleteUserResponse{}, err
+        return err
     }
-    if response.StatusCode != 200 {
-        return dbplugin.DeleteUserResponse{}, fmt.Errorf("delete user failed: http statusCode: %s", response.StatusCode)
+    _, err = c.invoke(ctx, actionDelUser, body)
+    c.invalidateUser(username)
+    if err != nil {
+        return fmt.Errorf("delete user failed: %w", err)
     }
-    resp_body, err := ioutil.ReadAll(response.Body)
+    if c.VerifyAfterDelete {
+        _, exists, err := c.getUser(ctx, username, revocation)
+        switch {
+        case errors.Is(err, errUnsupportedAction):
+            c.logger.Warn("skipping verify_after_delete, the backend does not support GetUser", "username", c.logName(username))
+        case err != nil:
+            return fmt.Errorf("verify delete user:%s failed: %w", username, err)
+        case exists:
+            return fmt.Errorf("delete user:%s reported success but the user still exists", username)
+        }
+    }
+    c.forgetConnectionDetails(username)
+    var metadata map[string]interface{}
+    if len(id) > 0 {
+        metadata = map[string]interface{}{"account_id": id}
+    }
+    c.emitEvent(ctx, EventCredentialDelete, username, metadata)
+    return nil
+}
+
+// ListUsers returns the usernames known to the backend. statements are handled
+// the same way as revocation statements and may be empty.
+func (c *MgtvMysql) ListUsers(ctx context.Context, statements dbplugin.Statements) ([]string, error) {
+    records, err := c.listUsers(ctx, statements)
     if err != nil {
-        return dbplugin.DeleteUserResponse{}, fmt.Errorf("delete user failed: %s", err)
+        return nil, err
+    }
+    usernames := make([]string, 0, len(records))
+    for _, record := range records {
+        usernames = append(usernames, resultString(record, "username"))
     }
-    result := make(map[string]interface{})
-    err = json.Unmarshal(resp_body, &result)
+    return usernames, nil
+}
+
+// listUsers returns the backend's user records. The backend may report users
+// as plain names or as objects carrying a username field.
+func (c *MgtvMysql) listUsers(ctx context.Context, statements dbplugin.Statements) ([]map[string]interface{}, error) {
+    c.Lock()
+    defer c.Unlock()
+
+    statement, err := parseStatement(statements)
+    if err != nil {
+        return nil, err
+    }
+    return c.listUserRecords(ctx, statement)
+}
+
+// listUserRecords is listUsers for a decoded statement. It must be called with
+// the lock held.
+func (c *mgtvMysqlConnectionProducer) listUserRecords(ctx context.Context, statement map[string]interface{}) ([]map[string]interface{}, error) {
+    body, err := c.buildRequest(ctx, actionListUsers, statement, nil)
     if err != nil {
-        return dbplugin.DeleteUserResponse{}, fmt.Errorf("delete user failed: %s", err)
+        return nil, err
     }
-    status := result["status"]
-    if status.(float64) != 0  {
-        return dbplugin.DeleteUserResponse{}, fmt.Errorf("delete user failed: %s", result["error"])
+    result, err := c.invoke(ctx, actionListUsers, body)
+    if err != nil {
+        return nil, fmt.Errorf("list users failed: %w", err)
+    }
+    users, _ := result["users"].([]interface{})
+    records := make([]map[string]interface{}, 0, len(users))
+    for _, user := range users {
+        switch user := user.(type) {
+        case string:
+            records = append(records, map[string]interface{}{"username": user})
+        case map[string]interface{}:
+            if len(resultString(user, "username")) > 0 {
+                records = append(records, user)
+            }
+        }
     }
-    return dbplugin.DeleteUserResponse{}, nil
+    return records, nil
 }
 
-func (c *MgtvMysql) changeUserPassword(ctx context.Context, username, password string) error {
-    // nothing to do
+// parseStatement decodes the first of statements, which must be at most one,
+// into a request body. No statement yields an empty body.
+func parseStatement(statements dbplugin.Statements) (map[string]interface{}, error) {
+    if len(statements.Commands) > 1 {
+        return nil, errors.New("a maximum of one statement is supported")
+    }
+    body := make(map[string]interface{})
+    if len(statements.Commands) == 1 {
+        err := json.Unmarshal([]byte(statements.Commands[0]), &body)
+        if err != nil {
+            return nil, err
+        }
+    }
+    return body, nil
+}
+
+// changeUserPassword sets the password of username. It only holds the read
+// lock, keeping Initialize from replacing the config during the call, so that
+// password changes, such as those of RotateRole, run concurrently.
+func (c *MgtvMysql) changeUserPassword(ctx context.Context, username, password string, statements dbplugin.Statements) error {
+    c.RLock()
+    defer c.RUnlock()
+
+    if err := c.health(); err != nil {
+        return fmt.Errorf("change password for user:%s failed: %w", username, err)
+    }
+    if len(statements.Commands) > 1 {
+        return errors.New("a maximum of one rotation_statement is supported")
+    }
+    if err := c.checkPasswordLength(password); err != nil {
+        return err
+    }
+    statement := make(map[string]interface{})
+    if len(statements.Commands) == 1 {
+        err := json.Unmarshal([]byte(statements.Commands[0]), &statement)
+        if err != nil {
+            return err
+        }
+    }
+    body, err := c.buildRequest(ctx, actionChangePassword, statement, map[string]interface{}{
+        "username": username,
+        "password": c.hashPassword(password),
+    })
+    if err != nil {
+        return err
+    }
+    _, err = c.invoke(ctx, actionChangePassword, body)
+    c.invalidateUser(username)
+    if err != nil {
+        return c.redactErrorLocked(fmt.Errorf("change password for user:%s failed: %w", username, err), body["password"].(string))
+    }
     return nil
 }
 
+// RotatePassword generates a new password for username and applies it through
+// the backend, outside of Vault's static role rotation schedule. statements are
+// handled the same way as rotation statements. The new password is returned.
+func (c *MgtvMysql) RotatePassword(ctx context.Context, username string, statements dbplugin.Statements) (string, error) {
+    if len(username) == 0 {
+        return "", errors.New("username is empty")
+    }
+    c.RLock()
+    length := passwordLength
+    if c.PasswordMaxLength > 0 && length > c.PasswordMaxLength {
+        length = c.PasswordMaxLength
+    }
+    if length < c.PasswordMinLength {
+        length = c.PasswordMinLength
+    }
+    c.RUnlock()
+    password, err := credsutil.RandomAlphaNumeric(length, true)
+    if err != nil {
+        return "", fmt.Errorf("failed to generate password: %w", err)
+    }
+    err = c.changeUserPassword(ctx, username, password, statements)
+    if err != nil {
+        return "", c.redactError(err, password)
+    }
+    c.RLock()
+    c.emitEvent(ctx, EventCredentialRotate, username, nil)
+    c.RUnlock()
+    return password, nil
+}
+
 func (c *MgtvMysql) Type() (string, error) {
     return mysqlTypeName, nil
 }
 
-// Close terminates the database connection with locking
+// Close terminates the database connection with locking, cancelling the
+// backend calls in flight.
 func (c *mgtvMysqlConnectionProducer) Close() error {
-    // nothing to do
+    if c.closeCancel != nil {
+        c.closeCancel()
+    }
     return nil
 }
 
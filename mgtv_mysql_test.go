@@ -0,0 +1,159 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "net/http"
+    "strings"
+    "testing"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestRotatePassword(t *testing.T) {
+    tests := []struct {
+        name     string
+        username string
+        // status is the result status the backend answers ChangePassword with.
+        status  int
+        wantErr string
+    }{
+        {name: "rotated", username: "V_USER_R"},
+        {name: "no username", wantErr: "username is empty"},
+        {name: "backend failure", username: "V_USER_R", status: 1, wantErr: "change password for user:V_USER_R failed"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, nil)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(actionChangePassword) || tt.status == 0 {
+                    return false
+                }
+                writeJSON(w, map[string]interface{}{"status": tt.status, "error": "denied"})
+                return true
+            })
+
+            password, err := db.RotatePassword(context.Background(), tt.username, statements(testDeleteStatement))
+            sent := backend.received(actionChangePassword)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("RotatePassword error = %v, want %q", err, tt.wantErr)
+                }
+                for _, req := range sent {
+                    if strings.Contains(err.Error(), req.Body["password"].(string)) {
+                        t.Fatalf("error %q leaks the password", err)
+                    }
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(sent) != 1 {
+                t.Fatalf("ChangePassword sent %d times, want once", len(sent))
+            }
+            if sent[0].Body["username"] != tt.username || sent[0].Body["password"] != password || len(password) != passwordLength {
+                t.Fatalf("sent %v, returned password %q", sent[0].Body, password)
+            }
+            again, err := db.RotatePassword(context.Background(), tt.username, statements(testDeleteStatement))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if again == password {
+                t.Fatalf("two rotations returned the same password %q", password)
+            }
+        })
+    }
+}
+
+func TestMaxStatementBytes(t *testing.T) {
+    padded := func(n int) string {
+        statement := `{"cid":"c1","dbname":"d1","iplist":"`
+        return statement + strings.Repeat("1", n-len(statement)-2) + `"}`
+    }
+    tests := []struct {
+        name      string
+        limit     interface{}
+        statement string
+        wantErr   string
+    }{
+        {name: "default, within", statement: padded(defaultMaxStatementBytes)},
+        {name: "default, over", statement: padded(defaultMaxStatementBytes + 1), wantErr: "exceeding max_statement_bytes 65536"},
+        {name: "configured, within", limit: 100, statement: padded(100)},
+        {name: "configured, over", limit: 100, statement: padded(101), wantErr: "create_statement is 101 bytes, exceeding max_statement_bytes 100"},
+        {name: "disabled", limit: 0, statement: padded(defaultMaxStatementBytes + 1)},
+        {name: "negative", limit: -1, wantErr: "invalid max_statement_bytes -1"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{}
+            if tt.limit != nil {
+                config["max_statement_bytes"] = tt.limit
+            }
+            if len(tt.statement) == 0 {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+            _, err := newUser(db, "role", tt.statement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                if sent := backend.received(actionAddUser); len(sent) > 0 {
+                    t.Fatalf("%d creates sent, want none", len(sent))
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+}
+
+// TestRevocationStatements covers the checks DeleteUser makes of revocation
+// statements. dbplugin never hands them over before a revocation, so this is
+// the earliest a broken role is caught; it is caught before anything is sent.
+func TestRevocationStatements(t *testing.T) {
+    tests := []struct {
+        name       string
+        statements []string
+        wantErr    string
+    }{
+        {name: "valid", statements: []string{testDeleteStatement}},
+        {name: "empty", wantErr: "revocation V_USER_R failed,Revocation Statements is empty"},
+        {name: "unparsable", statements: []string{`{"cid":`}, wantErr: "unexpected end of JSON input"},
+        {name: "not an object", statements: []string{`["c1"]`}, wantErr: "cannot unmarshal array"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, nil)
+            _, err := db.DeleteUser(context.Background(), dbplugin.DeleteUserRequest{
+                Username:   "V_USER_R",
+                Statements: statements(tt.statements...),
+            })
+            sent := len(backend.received(actionDelUser))
+            if len(tt.wantErr) == 0 {
+                if err != nil || sent != 1 {
+                    t.Fatalf("DeleteUser = %v with %d DelUser sent, want success with 1", err, sent)
+                }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Fatalf("DeleteUser error = %v, want %q", err, tt.wantErr)
+            }
+            if sent != 0 {
+                t.Errorf("DelUser sent %d times, want none", sent)
+            }
+        })
+    }
+}
@@ -0,0 +1,44 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "bytes"
+    "encoding/json"
+)
+
+const (
+    batchBodyJSON   = "json"
+    batchBodyNDJSON = "ndjson"
+
+    jsonContentType   = "application/json"
+    ndjsonContentType = "application/x-ndjson"
+)
+
+// ndjsonLines splits a batch wire body into one body per username, each
+// carrying the fields shared by the batch.
+func (c *mgtvMysqlConnectionProducer) ndjsonLines(wire map[string]interface{}) []map[string]interface{} {
+    usernamesField := c.wireName("usernames")
+    usernames, _ := wire[usernamesField].([]string)
+    lines := make([]map[string]interface{}, 0, len(usernames))
+    for _, username := range usernames {
+        line := copyBody(wire)
+        delete(line, usernamesField)
+        line[c.wireName("username")] = username
+        lines = append(lines, line)
+    }
+    return lines
+}
+
+// encodeNDJSON encodes lines as newline-delimited JSON, one object per line.
+func encodeNDJSON(lines []map[string]interface{}) ([]byte, error) {
+    var buf bytes.Buffer
+    enc := json.NewEncoder(&buf)
+    for _, line := range lines {
+        if err := enc.Encode(line); err != nil {
+            return nil, err
+        }
+    }
+    return buf.Bytes(), nil
+}
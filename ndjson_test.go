@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestBatchBodyNDJSON(t *testing.T) {
+    usernames := []string{"V_A_R", "V_B_R", "V_C_R"}
+    tests := []struct {
+        name       string
+        fieldNames map[string]interface{}
+        // usernameField is the wire name of username.
+        usernameField string
+    }{
+        {name: "default names", usernameField: "username"},
+        {name: "renamed", fieldNames: map[string]interface{}{"username": "user"}, usernameField: "user"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.Header.Get("Content-Type") != ndjsonContentType {
+                    return false
+                }
+                results := make([]interface{}, 0, len(usernames))
+                for _, username := range usernames {
+                    results = append(results, map[string]interface{}{"username": username, "status": 0})
+                }
+                writeJSON(w, map[string]interface{}{"status": 0, "results": results})
+                return true
+            })
+            db := newTestDB(t, backend.URL, map[string]interface{}{"batch_body": "ndjson", "field_names": tt.fieldNames})
+            if _, err := db.DeleteUsers(context.Background(), usernames, statements(testDeleteStatement)); err != nil {
+                t.Fatal(err)
+            }
+
+            sent := backend.received("")
+            req := sent[len(sent)-1]
+            if got := req.Header.Get("Content-Type"); got != ndjsonContentType {
+                t.Fatalf("Content-Type = %q, want %q", got, ndjsonContentType)
+            }
+            if !bytes.HasSuffix(req.Raw, []byte("\n")) {
+                t.Errorf("body %q doesn't end its last line", req.Raw)
+            }
+            lines := strings.Split(strings.TrimSuffix(string(req.Raw), "\n"), "\n")
+            var got []string
+            for _, line := range lines {
+                var object map[string]interface{}
+                if err := json.Unmarshal([]byte(line), &object); err != nil {
+                    t.Fatalf("line %q isn't a JSON object: %v", line, err)
+                }
+                if object["action"] != string(actionBatchDelUser) || object["cid"] != "c1" {
+                    t.Errorf("line %q lacks the fields shared by the batch", line)
+                }
+                if _, ok := object["usernames"]; ok {
+                    t.Errorf("line %q carries the usernames list", line)
+                }
+                username, _ := object[tt.usernameField].(string)
+                got = append(got, username)
+            }
+            if !reflect.DeepEqual(got, usernames) {
+                t.Fatalf("lines carry usernames %v, want one line each for %v", got, usernames)
+            }
+        })
+    }
+}
+
+func TestBatchBodyJSON(t *testing.T) {
+    tests := []struct {
+        name      string
+        batchBody string
+        wantErr   string
+    }{
+        {name: "default"},
+        {name: "json", batchBody: "json"},
+        {name: "invalid", batchBody: "csv", wantErr: "invalid batch_body"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"batch_body": tt.batchBody}
+            if len(tt.wantErr) > 0 {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+            if _, err := db.DeleteUsers(context.Background(), []string{"V_A_R", "V_B_R"}, statements(testDeleteStatement)); err != nil {
+                t.Fatal(err)
+            }
+            req := backend.received(actionBatchDelUser)[0]
+            if got := req.Header.Get("Content-Type"); got != jsonContentType {
+                t.Fatalf("Content-Type = %q, want %q", got, jsonContentType)
+            }
+            if got, _ := req.Body["usernames"].([]interface{}); len(got) != 2 {
+                t.Fatalf("body %s, want one object listing both usernames", req.Raw)
+            }
+        })
+    }
+}
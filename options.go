@@ -0,0 +1,52 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "io"
+
+    "github.com/hashicorp/vault/sdk/logical"
+)
+
+// Option configures a MgtvMysql created by NewWithOptions.
+type Option func(*MgtvMysql)
+
+// WithKVSource sets the source token_kv_ref is read from.
+func WithKVSource(kv KVSource) Option {
+    return func(c *MgtvMysql) {
+        c.kvSource = kv
+    }
+}
+
+// WithSlowCallHook sets a func called, synchronously, for every backend call
+// slower than slow_call_threshold. It should return quickly.
+func WithSlowCallHook(hook func(SlowCall)) Option {
+    return func(c *MgtvMysql) {
+        c.slowCallHook = hook
+    }
+}
+
+// WithEventSender sets where credential lifecycle events are published under
+// emit_events. Without one, they are written to the plugin log.
+func WithEventSender(sender logical.EventSender) Option {
+    return func(c *MgtvMysql) {
+        c.eventSender = sender
+    }
+}
+
+// WithRandomSource sets the source generated usernames are drawn from, such as
+// a seeded math/rand source to make them reproducible in tests. Without one
+// they come from crypto/rand.
+func WithRandomSource(source io.Reader) Option {
+    return func(c *MgtvMysql) {
+        c.randomSource = source
+    }
+}
+
+// WithClock sets the Clock used for time dependent behavior.
+func WithClock(clock Clock) Option {
+    return func(c *MgtvMysql) {
+        c.clock = clock
+    }
+}
@@ -0,0 +1,107 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "fmt"
+    "math"
+    "net/url"
+    "strings"
+    "time"
+)
+
+// overridesField is the create statement field holding connection settings
+// that override the mount config for that create only.
+const overridesField = "connection_overrides"
+
+// connectionOverrides are the connection settings a statement may override.
+// Zero values keep the mount config. url is one of the configured backends,
+// bypassing the balancer; path replaces the path of the backend picked.
+type connectionOverrides struct {
+    timeout time.Duration
+    url     string
+    path    string
+}
+
+type overridesKey struct{}
+
+func withOverrides(ctx context.Context, o connectionOverrides) context.Context {
+    return context.WithValue(ctx, overridesKey{}, o)
+}
+
+func overridesFrom(ctx context.Context) connectionOverrides {
+    o, _ := ctx.Value(overridesKey{}).(connectionOverrides)
+    return o
+}
+
+// takeOverrides removes connection_overrides from body and validates it.
+// Unknown settings are ignored so that statements stay portable across
+// plugin versions.
+func (c *mgtvMysqlConnectionProducer) takeOverrides(body map[string]interface{}) (connectionOverrides, error) {
+    var o connectionOverrides
+    raw, ok := body[overridesField]
+    if !ok {
+        return o, nil
+    }
+    delete(body, overridesField)
+    fields, ok := raw.(map[string]interface{})
+    if !ok {
+        return o, fmt.Errorf("invalid %s: must be an object", overridesField)
+    }
+    for field, value := range fields {
+        switch field {
+        case "timeout":
+            seconds, ok := value.(float64)
+            if !ok || seconds <= 0 || seconds != math.Trunc(seconds) {
+                return o, fmt.Errorf("invalid %s timeout %v: must be a positive number of seconds", overridesField, value)
+            }
+            o.timeout = time.Duration(seconds) * time.Second
+        case "url":
+            s, _ := value.(string)
+            u, err := url.Parse(s)
+            if err == nil && len(u.Scheme) == 0 && len(u.Host) == 0 && strings.HasPrefix(u.Path, "/") {
+                o.path = s
+                continue
+            }
+            if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+                return o, fmt.Errorf("invalid %s url %q: must be a path or an absolute http or https url", overridesField, s)
+            }
+            // The request carries the mount's token, so it may only go to a
+            // backend the mount is configured with.
+            if !c.isBackend(u) {
+                return o, fmt.Errorf("invalid %s url %q: %s is neither connection_url nor one of backend_urls", overridesField, s, u.Host)
+            }
+            if err := c.checkTLS(u); err != nil {
+                return o, fmt.Errorf("invalid %s url: %w", overridesField, err)
+            }
+            o.url = s
+        default:
+            c.logger.Debug("ignoring unknown connection override", "field", field)
+        }
+    }
+    return o, nil
+}
+
+// isBackend reports whether u has the scheme and host of connection_url or
+// of one of backend_urls.
+func (c *mgtvMysqlConnectionProducer) isBackend(u *url.URL) bool {
+    for _, base := range c.backendURLs() {
+        known, err := parseBackendURL(base)
+        if err == nil && strings.EqualFold(known.Scheme, u.Scheme) && strings.EqualFold(known.Host, u.Host) {
+            return true
+        }
+    }
+    return false
+}
+
+// withPath returns u with its path replaced by the path override, which may
+// carry a query of its own.
+func withPath(u *url.URL, path string) (*url.URL, error) {
+    ref, err := url.Parse(path)
+    if err != nil {
+        return nil, err
+    }
+    return u.ResolveReference(ref), nil
+}
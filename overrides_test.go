@@ -0,0 +1,167 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+)
+
+// TestConnectionOverridesTimeout has the backend answer creates after
+// 1.5s, between the mount's and the statement's request_timeout.
+func TestConnectionOverridesTimeout(t *testing.T) {
+    tests := []struct {
+        name           string
+        requestTimeout int
+        overrides      string
+        wantErr        bool
+    }{
+        {name: "mount timeout", requestTimeout: 1, wantErr: true},
+        {name: "longer override", requestTimeout: 1, overrides: `{"timeout":5}`},
+        {name: "shorter override", requestTimeout: 30, overrides: `{"timeout":1}`, wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() == string(actionAddUser) {
+                    time.Sleep(1500 * time.Millisecond)
+                }
+                return false
+            })
+            db := newTestDB(t, backend.URL, map[string]interface{}{
+                "request_timeout":     tt.requestTimeout,
+                "on_ambiguous_create": "assume_failed_cleanup",
+            })
+            statement := testCreateStatement
+            if len(tt.overrides) > 0 {
+                statement = `{"cid":"c1","dbname":"d1","connection_overrides":` + tt.overrides + `}`
+            }
+            _, err := newUser(db, "role", statement)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("NewUser error = %v, want an error: %v", err, tt.wantErr)
+            }
+            if err != nil && !strings.Contains(err.Error(), "Timeout") {
+                t.Fatalf("NewUser error = %v, want a timeout", err)
+            }
+            if _, ok := backend.received(actionAddUser)[0].Body[overridesField]; ok {
+                t.Fatalf("%s sent to the backend", overridesField)
+            }
+
+            // The override applies to that create only.
+            if err := deleteUser(db, "V_USER_R", testDeleteStatement); err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+}
+
+func TestConnectionOverridesURL(t *testing.T) {
+    mount, second, foreign := newFakeBackend(t), newFakeBackend(t), newFakeBackend(t)
+    tests := []struct {
+        name string
+        // backends are the backend_urls configured, none when empty.
+        backends []string
+        url      string
+        // wantBackend receives the overridden create, at wantPath.
+        wantBackend *fakeBackend
+        wantPath    string
+        wantErr     string
+    }{
+        {name: "connection_url", url: mount.URL + "/v2", wantBackend: mount, wantPath: "/v2"},
+        {name: "one of backend_urls", backends: []string{mount.URL, second.URL}, url: second.URL, wantBackend: second, wantPath: "/"},
+        {name: "path", url: "/v2/users?tier=gold", wantBackend: mount, wantPath: "/v2/users"},
+        {name: "foreign host", url: foreign.URL, wantErr: "is neither connection_url nor one of backend_urls"},
+        {name: "foreign host among backend_urls", backends: []string{mount.URL, second.URL}, url: foreign.URL + "/v2", wantErr: "is neither connection_url nor one of backend_urls"},
+        {name: "other scheme of a backend", url: strings.Replace(mount.URL, "http://", "https://", 1), wantErr: "is neither connection_url nor one of backend_urls"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            config := map[string]interface{}{}
+            if len(tt.backends) > 0 {
+                var backends []interface{}
+                for _, u := range tt.backends {
+                    backends = append(backends, map[string]interface{}{"url": u, "weight": 1})
+                }
+                config["backend_urls"] = backends
+            }
+            db := newTestDB(t, mount.URL, config)
+            before := map[*fakeBackend]int{}
+            for _, be := range []*fakeBackend{mount, second, foreign} {
+                before[be] = len(be.received(actionAddUser))
+            }
+            _, err := newUser(db, "role", `{"cid":"c1","dbname":"d1","connection_overrides":{"url":"`+tt.url+`"}}`)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                if got := len(foreign.received("")); got != 0 {
+                    t.Fatalf("foreign host got %d requests, want none", got)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            for be, n := range before {
+                sent := be.received(actionAddUser)[n:]
+                if (be == tt.wantBackend) != (len(sent) == 1) {
+                    t.Fatalf("backend got %d of the overridden creates", len(sent))
+                }
+                if be == tt.wantBackend && sent[0].Path != tt.wantPath {
+                    t.Fatalf("create sent to %s, want %s", sent[0].Path, tt.wantPath)
+                }
+            }
+        })
+    }
+
+    // The override applies to that create only.
+    db := newTestDB(t, mount.URL, nil)
+    before := len(mount.received(actionAddUser))
+    if _, err := newUser(db, "role", testCreateStatement); err != nil {
+        t.Fatal(err)
+    }
+    if sent := mount.received(actionAddUser)[before:]; len(sent) != 1 || sent[0].Path != "/" {
+        t.Fatalf("create without override sent %v, want one to /", sent)
+    }
+}
+
+func TestConnectionOverridesInvalid(t *testing.T) {
+    tests := []struct {
+        name      string
+        overrides string
+        wantErr   string
+    }{
+        {name: "not an object", overrides: `"fast"`, wantErr: "invalid connection_overrides: must be an object"},
+        {name: "zero timeout", overrides: `{"timeout":0}`, wantErr: "invalid connection_overrides timeout 0"},
+        {name: "fractional timeout", overrides: `{"timeout":1.5}`, wantErr: "invalid connection_overrides timeout 1.5"},
+        {name: "string timeout", overrides: `{"timeout":"5"}`, wantErr: "invalid connection_overrides timeout 5"},
+        {name: "relative url", overrides: `{"url":"backend"}`, wantErr: `invalid connection_overrides url "backend"`},
+        {name: "scheme-relative url", overrides: `{"url":"//backend.example/v2"}`, wantErr: `invalid connection_overrides url "//backend.example/v2"`},
+        {name: "other scheme", overrides: `{"url":"ftp://backend"}`, wantErr: `invalid connection_overrides url "ftp://backend"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, nil)
+            _, err := newUser(db, "role", `{"cid":"c1","dbname":"d1","connection_overrides":`+tt.overrides+`}`)
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+            }
+            if sent := backend.received(actionAddUser); len(sent) > 0 {
+                t.Fatalf("%d creates sent, want none", len(sent))
+            }
+        })
+    }
+}
+
+func TestConnectionOverridesUnknown(t *testing.T) {
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, nil)
+    if _, err := newUser(db, "role", `{"cid":"c1","dbname":"d1","connection_overrides":{"retries":3}}`); err != nil {
+        t.Fatalf("NewUser with an unknown override: %v", err)
+    }
+}
@@ -0,0 +1,62 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "fmt"
+    "sort"
+)
+
+// passthroughField is the create statement field holding an object whose
+// fields are merged into the backend request verbatim, for backend fields the
+// plugin doesn't know about yet. With allowed_statement_fields set, it has to
+// be listed there like any other field.
+const passthroughField = "extra"
+
+// reservedFields are the request fields the plugin sets itself or derives from
+// the statement, which passthrough fields may not replace.
+var reservedFields = map[string]bool{
+    "action":       true,
+    "token":        true,
+    "username":     true,
+    "password":     true,
+    "role":         true,
+    "created_at":   true,
+    "account_id":   true,
+    "priv":         true,
+    "engine":       true,
+    "iplist":       true,
+    overridesField: true,
+}
+
+// takePassthrough removes the passthrough object from statement and returns
+// its fields. It fails when one of them is reserved, under its canonical or
+// its wire name, or is already a field of the statement.
+func (c *mgtvMysqlConnectionProducer) takePassthrough(statement map[string]interface{}) (map[string]interface{}, error) {
+    raw, ok := statement[passthroughField]
+    if !ok {
+        return nil, nil
+    }
+    delete(statement, passthroughField)
+    fields, ok := raw.(map[string]interface{})
+    if !ok {
+        return nil, fmt.Errorf("invalid %s: must be an object", passthroughField)
+    }
+    reserved := make(map[string]bool, 2*len(reservedFields))
+    for field := range reservedFields {
+        reserved[field] = true
+        reserved[c.wireName(field)] = true
+    }
+    var collisions []string
+    for field := range fields {
+        if _, ok := statement[field]; ok || reserved[field] || field == passthroughField {
+            collisions = append(collisions, field)
+        }
+    }
+    if len(collisions) > 0 {
+        sort.Strings(collisions)
+        return nil, fmt.Errorf("%s fields %q collide with reserved or statement fields", passthroughField, collisions)
+    }
+    return fields, nil
+}
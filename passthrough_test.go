@@ -0,0 +1,77 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestPassthroughFields(t *testing.T) {
+    tests := []struct {
+        name      string
+        config    map[string]interface{}
+        statement string
+        // want are fields the AddUser body must carry.
+        want    map[string]interface{}
+        wantErr string
+    }{
+        {
+            name:      "merged",
+            statement: `{"cid":"c1","dbname":"d1","extra":{"quota":5,"tier":"gold"}}`,
+            want:      map[string]interface{}{"cid": "c1", "quota": float64(5), "tier": "gold"},
+        },
+        {name: "empty", statement: `{"cid":"c1","dbname":"d1","extra":{}}`, want: map[string]interface{}{"cid": "c1"}},
+        {
+            name:      "reserved",
+            statement: `{"cid":"c1","dbname":"d1","extra":{"password":"x","token":"y"}}`,
+            wantErr:   `extra fields ["password" "token"] collide with reserved or statement fields`,
+        },
+        {
+            name:      "reserved wire name",
+            config:    map[string]interface{}{"field_names": map[string]interface{}{"username": "login"}},
+            statement: `{"cid":"c1","dbname":"d1","extra":{"login":"root"}}`,
+            wantErr:   `extra fields ["login"] collide`,
+        },
+        {
+            name:      "statement field",
+            statement: `{"cid":"c1","dbname":"d1","extra":{"cid":"c2"}}`,
+            wantErr:   `extra fields ["cid"] collide`,
+        },
+        {
+            name:      "nested",
+            statement: `{"cid":"c1","dbname":"d1","extra":{"extra":{}}}`,
+            wantErr:   `extra fields ["extra"] collide`,
+        },
+        {name: "not an object", statement: `{"cid":"c1","dbname":"d1","extra":"quota=5"}`, wantErr: "invalid extra: must be an object"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, tt.config)
+            _, err := newUser(db, "role", tt.statement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                if n := len(backend.received(actionAddUser)); n != 0 {
+                    t.Fatalf("AddUser sent %d times, want none", n)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            body := backend.received(actionAddUser)[0].Body
+            for field, want := range tt.want {
+                if body[field] != want {
+                    t.Errorf("AddUser %s = %v, want %v", field, body[field], want)
+                }
+            }
+            if _, ok := body[passthroughField]; ok {
+                t.Errorf("AddUser body carries %s itself: %v", passthroughField, body)
+            }
+        })
+    }
+}
@@ -0,0 +1,62 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "crypto/sha1"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "strings"
+)
+
+const (
+    passwordHashNone        = "none"
+    passwordHashMySQLNative = "mysql_native"
+    passwordHashSHA256      = "sha256"
+)
+
+func validPasswordHash(hash string) bool {
+    switch hash {
+    case passwordHashNone, passwordHashMySQLNative, passwordHashSHA256:
+        return true
+    }
+    return false
+}
+
+// checkPasswordLength fails when password is outside of password_min_length
+// and password_max_length, so it is rejected before reaching the backend.
+func (c *mgtvMysqlConnectionProducer) checkPasswordLength(password string) error {
+    length := len([]rune(password))
+    if c.PasswordMinLength > 0 && length < c.PasswordMinLength {
+        return fmt.Errorf("password is %d characters, shorter than password_min_length %d", length, c.PasswordMinLength)
+    }
+    if c.PasswordMaxLength > 0 && length > c.PasswordMaxLength {
+        return fmt.Errorf("password is %d characters, longer than password_max_length %d", length, c.PasswordMaxLength)
+    }
+    return nil
+}
+
+// hashPassword transforms password into the format password_hash asks the
+// backend to receive.
+func (c *mgtvMysqlConnectionProducer) hashPassword(password string) string {
+    switch c.PasswordHash {
+    case passwordHashMySQLNative:
+        return mysqlNativePassword(password)
+    case passwordHashSHA256:
+        sum := sha256.Sum256([]byte(password))
+        return hex.EncodeToString(sum[:])
+    default:
+        return password
+    }
+}
+
+// mysqlNativePassword returns the mysql_native_password hash of password, as
+// PASSWORD() computed it: "*" followed by the upper case hex of
+// SHA1(SHA1(password)).
+func mysqlNativePassword(password string) string {
+    stage1 := sha1.Sum([]byte(password))
+    stage2 := sha1.Sum(stage1[:])
+    return "*" + strings.ToUpper(hex.EncodeToString(stage2[:]))
+}
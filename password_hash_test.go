@@ -0,0 +1,171 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "strings"
+    "testing"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// TestMySQLNativePassword checks the hashes against those MySQL's PASSWORD()
+// returns.
+func TestMySQLNativePassword(t *testing.T) {
+    tests := []struct {
+        password string
+        want     string
+    }{
+        {password: "password", want: "*2470C0C06DEE42FD1618BB99005ADCA2EC9D1E19"},
+        {password: "root", want: "*81F5E21E35407D884A6CD4A731AEBFB6AF209E1B"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.password, func(t *testing.T) {
+            if got := mysqlNativePassword(tt.password); got != tt.want {
+                t.Fatalf("mysqlNativePassword(%q) = %s, want %s", tt.password, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestPasswordHash(t *testing.T) {
+    const password = "Passw0rd-0123456789"
+    tests := []struct {
+        name    string
+        hash    string
+        want    string
+        wantErr string
+    }{
+        {name: "default", want: password},
+        {name: "none", hash: passwordHashNone, want: password},
+        {name: "mysql_native", hash: passwordHashMySQLNative, want: "*D5683EA003FE3AB36677AF4A02A1B5BE87651C1C"},
+        {name: "sha256", hash: passwordHashSHA256, want: "9fabec9335f32a579ee9fefac91e7eadf475cd2673782db81185c57530b9155e"},
+        {name: "invalid", hash: "md5", wantErr: "invalid password_hash"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"password_hash": tt.hash}
+            if len(tt.wantErr) > 0 {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+            username, err := newUser(db, "role", testCreateStatement)
+            if err != nil {
+                t.Fatal(err)
+            }
+            _, err = db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+                Username: username,
+                Password: &dbplugin.ChangePassword{NewPassword: password, Statements: statements(testDeleteStatement)},
+            })
+            if err != nil {
+                t.Fatal(err)
+            }
+            for _, action := range []backendAction{actionAddUser, actionChangePassword} {
+                if got := backend.received(action)[0].Body["password"]; got != tt.want {
+                    t.Errorf("%s password = %v, want %s", action, got, tt.want)
+                }
+            }
+        })
+    }
+}
+
+func TestPasswordLength(t *testing.T) {
+    tests := []struct {
+        name     string
+        min, max int
+        password string
+        wantErr  string
+    }{
+        {name: "unbounded", password: "p"},
+        {name: "within bounds", min: 8, max: 12, password: "Passw0rd-01"},
+        {name: "at min", min: 8, max: 12, password: "Passw0rd"},
+        {name: "at max", min: 8, max: 12, password: "Passw0rd-012"},
+        {name: "under min", min: 8, max: 12, password: "Pass", wantErr: "password is 4 characters, shorter than password_min_length 8"},
+        {name: "over max", min: 8, max: 12, password: "Passw0rd-0123", wantErr: "password is 13 characters, longer than password_max_length 12"},
+        {name: "counted in characters", max: 4, password: "ÄÖÜß"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, map[string]interface{}{"password_min_length": tt.min, "password_max_length": tt.max})
+
+            _, createErr := db.NewUser(context.Background(), dbplugin.NewUserRequest{
+                UsernameConfig: dbplugin.UsernameMetadata{DisplayName: "token", RoleName: "role"},
+                Statements:     statements(testCreateStatement),
+                Password:       tt.password,
+            })
+            _, updateErr := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+                Username: "V_USER_R",
+                Password: &dbplugin.ChangePassword{NewPassword: tt.password, Statements: statements(testDeleteStatement)},
+            })
+            for op, err := range map[string]error{"NewUser": createErr, "UpdateUser": updateErr} {
+                if len(tt.wantErr) == 0 {
+                    if err != nil {
+                        t.Errorf("%s: %v", op, err)
+                    }
+                    continue
+                }
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Errorf("%s error = %v, want %q", op, err, tt.wantErr)
+                }
+            }
+            if len(tt.wantErr) > 0 && len(backend.received("")) != 0 {
+                t.Fatalf("backend called with an out of bounds password: %v", backend.received(""))
+            }
+        })
+    }
+}
+
+func TestRotatePasswordLength(t *testing.T) {
+    tests := []struct {
+        name       string
+        min, max   int
+        wantLength int
+    }{
+        {name: "default", wantLength: passwordLength},
+        {name: "within bounds", min: 8, max: 32, wantLength: passwordLength},
+        {name: "capped", max: 12, wantLength: 12},
+        {name: "raised", min: 24, wantLength: 24},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, map[string]interface{}{"password_min_length": tt.min, "password_max_length": tt.max})
+            password, err := db.RotatePassword(context.Background(), "V_USER_R", statements(testDeleteStatement))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(password) != tt.wantLength {
+                t.Fatalf("rotated to a %d character password, want %d", len(password), tt.wantLength)
+            }
+        })
+    }
+}
+
+func TestPasswordLengthInvalid(t *testing.T) {
+    tests := []struct {
+        name     string
+        min, max int
+        wantErr  string
+    }{
+        {name: "negative min", min: -1, wantErr: "invalid password_min_length -1"},
+        {name: "negative max", max: -1, wantErr: "invalid password_max_length -1"},
+        {name: "max under min", min: 16, max: 8, wantErr: "invalid password_max_length 8: must not be less than password_min_length 16"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            err := initError(t, backend.URL, map[string]interface{}{"password_min_length": tt.min, "password_max_length": tt.max})
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+            }
+        })
+    }
+}
@@ -0,0 +1,83 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+)
+
+// Priv is the canonical form of a privilege level.
+type Priv string
+
+const (
+    PrivReadOnly  Priv = "read_only"
+    PrivReadWrite Priv = "read_write"
+)
+
+// privAliases maps the accepted string representations, lower cased, to their
+// canonical Priv.
+var privAliases = map[string]Priv{
+    "0":          PrivReadOnly,
+    "r":          PrivReadOnly,
+    "ro":         PrivReadOnly,
+    "read":       PrivReadOnly,
+    "readonly":   PrivReadOnly,
+    "read_only":  PrivReadOnly,
+    "1":          PrivReadWrite,
+    "rw":         PrivReadWrite,
+    "write":      PrivReadWrite,
+    "readwrite":  PrivReadWrite,
+    "read_write": PrivReadWrite,
+}
+
+// NormalizePriv maps any accepted representation of a privilege level, as
+// sent in statements or returned by the backend, to its canonical Priv:
+// 0 and 1 as numbers or strings, booleans, and names such as "RW".
+func NormalizePriv(v interface{}) (Priv, error) {
+    switch v := v.(type) {
+    case Priv:
+        if v == PrivReadOnly || v == PrivReadWrite {
+            return v, nil
+        }
+    case bool:
+        if v {
+            return PrivReadWrite, nil
+        }
+        return PrivReadOnly, nil
+    case int:
+        return NormalizePriv(fmt.Sprint(v))
+    case float64:
+        return NormalizePriv(fmt.Sprint(v))
+    case json.Number:
+        return NormalizePriv(v.String())
+    case string:
+        if priv, ok := privAliases[strings.ToLower(strings.TrimSpace(v))]; ok {
+            return priv, nil
+        }
+    }
+    return "", fmt.Errorf("invalid priv %v: must be 0, 1, r or rw", v)
+}
+
+// exceeds reports whether p is a higher privilege than ceiling.
+func (p Priv) exceeds(ceiling Priv) bool {
+    return p.wire() > ceiling.wire()
+}
+
+// wire returns the value priv is sent to the backend as.
+func (p Priv) wire() int {
+    if p == PrivReadWrite {
+        return 1
+    }
+    return 0
+}
+
+// suffix returns the username suffix of priv.
+func (p Priv) suffix() string {
+    if p == PrivReadWrite {
+        return "rw"
+    }
+    return "r"
+}
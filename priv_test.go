@@ -0,0 +1,216 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "encoding/json"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestDefaultPriv(t *testing.T) {
+    tests := []struct {
+        name        string
+        defaultPriv string
+        statement   string
+        // wantPriv is the priv sent, nil when none is.
+        wantPriv   interface{}
+        wantSuffix string
+        wantErr    string
+    }{
+        {name: "unset", statement: testCreateStatement, wantSuffix: "_r"},
+        {name: "read_only", defaultPriv: "read_only", statement: testCreateStatement, wantSuffix: "_r"},
+        {name: "read_write", defaultPriv: "read_write", statement: testCreateStatement, wantPriv: float64(1), wantSuffix: "_rw"},
+        {name: "error", defaultPriv: "error", statement: testCreateStatement, wantErr: "create_statement does not contain priv"},
+        {name: "explicit priv wins", defaultPriv: "error", statement: `{"cid":"c1","dbname":"d1","priv":0}`, wantPriv: float64(0), wantSuffix: "_r"},
+        {name: "invalid", defaultPriv: "admin", wantErr: `invalid default_priv "admin"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"default_priv": tt.defaultPriv}
+            if len(tt.statement) == 0 {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+            username, err := newUser(db, "role", tt.statement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                if n := len(backend.received(actionAddUser)); n != 0 {
+                    t.Fatalf("AddUser sent %d times, want none", n)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !strings.HasSuffix(username, tt.wantSuffix) {
+                t.Errorf("username %q, want suffix %q", username, tt.wantSuffix)
+            }
+            if priv := backend.received(actionAddUser)[0].Body["priv"]; priv != tt.wantPriv {
+                t.Errorf("priv sent as %v, want %v", priv, tt.wantPriv)
+            }
+        })
+    }
+}
+
+func TestNormalizePriv(t *testing.T) {
+    tests := []struct {
+        name    string
+        in      interface{}
+        want    Priv
+        wantErr bool
+    }{
+        {name: "int 0", in: 0, want: PrivReadOnly},
+        {name: "float 0", in: float64(0), want: PrivReadOnly},
+        {name: "json number 0", in: json.Number("0"), want: PrivReadOnly},
+        {name: "string 0", in: "0", want: PrivReadOnly},
+        {name: "false", in: false, want: PrivReadOnly},
+        {name: "r", in: "r", want: PrivReadOnly},
+        {name: "RO", in: "RO", want: PrivReadOnly},
+        {name: "ReadOnly", in: " ReadOnly ", want: PrivReadOnly},
+        {name: "canonical read_only", in: PrivReadOnly, want: PrivReadOnly},
+        {name: "int 1", in: 1, want: PrivReadWrite},
+        {name: "float 1", in: float64(1), want: PrivReadWrite},
+        {name: "json number 1", in: json.Number("1"), want: PrivReadWrite},
+        {name: "string 1", in: "1", want: PrivReadWrite},
+        {name: "true", in: true, want: PrivReadWrite},
+        {name: "RW", in: "RW", want: PrivReadWrite},
+        {name: "read_write", in: "read_write", want: PrivReadWrite},
+        {name: "canonical read_write", in: PrivReadWrite, want: PrivReadWrite},
+        {name: "int 2", in: 2, wantErr: true},
+        {name: "admin", in: "admin", wantErr: true},
+        {name: "unknown Priv", in: Priv("admin"), wantErr: true},
+        {name: "nil", in: nil, wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := NormalizePriv(tt.in)
+            if tt.wantErr {
+                if err == nil {
+                    t.Fatalf("NormalizePriv(%v) = %q, want an error", tt.in, got)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got != tt.want {
+                t.Fatalf("NormalizePriv(%v) = %q, want %q", tt.in, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestPrivNormalizedOnTheWire(t *testing.T) {
+    tests := []struct {
+        name      string
+        statement string
+        // echoed is the priv the backend echoes back under confirm_echo.
+        echoed     interface{}
+        wantPriv   interface{}
+        wantSuffix string
+        wantErr    string
+    }{
+        {name: "RW", statement: `{"cid":"c1","dbname":"d1","priv":"RW"}`, echoed: "RW", wantPriv: float64(1), wantSuffix: "_rw"},
+        {name: "string 1, echoed RW", statement: `{"cid":"c1","dbname":"d1","priv":"1"}`, echoed: "RW", wantPriv: float64(1), wantSuffix: "_rw"},
+        {name: "r, echoed 0", statement: `{"cid":"c1","dbname":"d1","priv":"r"}`, echoed: float64(0), wantPriv: float64(0), wantSuffix: "_r"},
+        {name: "echoed a different priv", statement: `{"cid":"c1","dbname":"d1","priv":"rw"}`, echoed: "r", wantErr: "confirm_echo: response echoes priv"},
+        {name: "invalid", statement: `{"cid":"c1","dbname":"d1","priv":"admin"}`, wantErr: "invalid priv admin"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(actionAddUser) {
+                    return false
+                }
+                writeJSON(w, map[string]interface{}{"status": 0, "username": req.Body["username"], "priv": tt.echoed})
+                return true
+            })
+            db := newTestDB(t, backend.URL, map[string]interface{}{"confirm_echo": true})
+            username, err := newUser(db, "role", tt.statement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !strings.HasSuffix(username, tt.wantSuffix) {
+                t.Errorf("username %q, want suffix %q", username, tt.wantSuffix)
+            }
+            if priv := backend.received(actionAddUser)[0].Body["priv"]; priv != tt.wantPriv {
+                t.Errorf("priv sent as %v, want %v", priv, tt.wantPriv)
+            }
+        })
+    }
+}
+
+func TestMaxPriv(t *testing.T) {
+    tests := []struct {
+        name        string
+        maxPriv     string
+        defaultPriv string
+        statement   string
+        wantErr     string
+        // initErr is set when the config itself is rejected.
+        initErr bool
+    }{
+        {name: "unset", statement: `{"cid":"c1","dbname":"d1","priv":"rw"}`},
+        {name: "read only within", maxPriv: "r", statement: `{"cid":"c1","dbname":"d1","priv":0}`},
+        {name: "priv omitted", maxPriv: "0", statement: testCreateStatement},
+        {name: "read write at ceiling", maxPriv: "RW", statement: `{"cid":"c1","dbname":"d1","priv":1}`},
+        {
+            name:      "read write over ceiling",
+            maxPriv:   "read_only",
+            statement: `{"cid":"c1","dbname":"d1","priv":"RW"}`,
+            wantErr:   "create_statement requests priv read_write, exceeding max_priv read_only",
+        },
+        {
+            name:        "default_priv over ceiling",
+            maxPriv:     "r",
+            defaultPriv: "read_write",
+            wantErr:     `invalid default_priv "read_write": exceeds max_priv "r"`,
+            initErr:     true,
+        },
+        {name: "invalid", maxPriv: "admin", wantErr: "invalid max_priv: invalid priv admin", initErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"max_priv": tt.maxPriv, "default_priv": tt.defaultPriv}
+            if tt.initErr {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+            _, err := newUser(db, "role", tt.statement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                if n := len(backend.received(actionAddUser)); n != 0 {
+                    t.Fatalf("AddUser sent %d times, want none", n)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+}
@@ -0,0 +1,95 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "fmt"
+    "sync"
+    "time"
+)
+
+// rateLimiter is a token bucket holding backend calls to rate_limit per
+// second, with bursts of up to rate_limit_burst calls.
+type rateLimiter struct {
+    mu    sync.Mutex
+    clock Clock
+    rate  float64
+    burst float64
+    // tokens goes negative as calls reserve turns ahead of time.
+    tokens float64
+    last   time.Time
+}
+
+// newRateLimiter returns a limiter for rate calls per second, or nil when rate
+// isn't positive. burst defaults to a single call.
+func newRateLimiter(rate, burst int, clock Clock) *rateLimiter {
+    if rate <= 0 {
+        return nil
+    }
+    if burst <= 0 {
+        burst = 1
+    }
+    return &rateLimiter{
+        clock:  clock,
+        rate:   float64(rate),
+        burst:  float64(burst),
+        tokens: float64(burst),
+        last:   clock.Now(),
+    }
+}
+
+// wait blocks until a call may be made or ctx is done. A nil limiter never
+// blocks.
+func (l *rateLimiter) wait(ctx context.Context) error {
+    if l == nil {
+        return nil
+    }
+    delay := l.reserve()
+    if delay <= 0 {
+        return nil
+    }
+    select {
+    case <-ctx.Done():
+        l.mu.Lock()
+        l.tokens++
+        l.mu.Unlock()
+        // Not wrapped, so that a create given up on before it was sent isn't
+        // taken for an ambiguous one.
+        return fmt.Errorf("gave up waiting for rate_limit: %v", ctx.Err())
+    case <-l.clock.After(delay):
+        return nil
+    }
+}
+
+// reserve takes a turn and returns how long to wait for it.
+func (l *rateLimiter) reserve() time.Duration {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    now := l.clock.Now()
+    l.tokens += now.Sub(l.last).Seconds() * l.rate
+    if l.tokens > l.burst {
+        l.tokens = l.burst
+    }
+    l.last = now
+    l.tokens--
+    if l.tokens >= 0 {
+        return 0
+    }
+    return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// waitRateLimit waits for the turn of a backend call under rate_limit.
+func (c *mgtvMysqlConnectionProducer) waitRateLimit(ctx context.Context) error {
+    if c.limiter == nil {
+        return nil
+    }
+    ctx, cancel := c.operationContext(ctx)
+    defer cancel()
+    err := c.limiter.wait(ctx)
+    if err != nil && c.closed() {
+        return errClosed
+    }
+    return err
+}
@@ -0,0 +1,82 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestRateLimiter(t *testing.T) {
+    clock := newFakeClock()
+    limiter := newRateLimiter(2, 2, clock)
+    ctx := context.Background()
+
+    // The burst goes through at once.
+    for i := 0; i < 2; i++ {
+        if err := limiter.wait(ctx); err != nil {
+            t.Fatalf("call %d: %v", i, err)
+        }
+    }
+    done := make(chan error, 1)
+    go func() { done <- limiter.wait(ctx) }()
+    clock.waitForTimers(t, 1)
+    select {
+    case err := <-done:
+        t.Fatalf("call beyond the burst returned %v before its turn", err)
+    default:
+    }
+    clock.Advance(500 * time.Millisecond)
+    if err := <-done; err != nil {
+        t.Fatal(err)
+    }
+
+    // A cancelled wait gives its turn back.
+    cancelled, cancel := context.WithCancel(ctx)
+    cancel()
+    if err := limiter.wait(cancelled); err == nil || !strings.Contains(err.Error(), "rate_limit") {
+        t.Fatalf("cancelled wait returned %v", err)
+    }
+    clock.Advance(500 * time.Millisecond)
+    if delay := limiter.reserve(); delay != 0 {
+        t.Fatalf("turn after a cancelled wait delayed by %s", delay)
+    }
+
+    if newRateLimiter(0, 5, clock) != nil {
+        t.Fatal("zero rate_limit doesn't disable the limiter")
+    }
+}
+
+func TestRateLimitConfig(t *testing.T) {
+    backend := newFakeBackend(t)
+    for _, config := range []map[string]interface{}{
+        {"rate_limit": -1},
+        {"rate_limit": 1, "rate_limit_burst": -1},
+    } {
+        if err := initError(t, backend.URL, config); err == nil {
+            t.Errorf("Initialize with %v succeeded", config)
+        }
+    }
+
+    clock := newFakeClock()
+    db := newTestDB(t, backend.URL, map[string]interface{}{"rate_limit": 1}, WithClock(clock))
+    if _, err := db.ListUsers(context.Background(), statements()); err != nil {
+        t.Fatal(err)
+    }
+    done := make(chan error, 1)
+    go func() {
+        _, err := db.ListUsers(context.Background(), statements())
+        done <- err
+    }()
+    clock.waitForTimers(t, 1)
+    if n := len(backend.received(actionListUsers)); n != 1 {
+        t.Fatalf("%d calls made before the second one's turn, want 1", n)
+    }
+    clock.Advance(time.Second)
+    if err := <-done; err != nil {
+        t.Fatal(err)
+    }
+}
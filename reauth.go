@@ -0,0 +1,72 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "errors"
+    "fmt"
+    "net/http"
+    "regexp"
+)
+
+// maxRedirects is how many redirects are followed for a request, matching
+// net/http's default policy.
+const maxRedirects = 10
+
+// reauthRedirect recognizes the redirects some gateways answer a stale token
+// with, sending the client to an auth endpoint.
+type reauthRedirect struct {
+    // status is the redirect status to recognize, or zero for any.
+    status   int
+    location *regexp.Regexp
+}
+
+// newReauthRedirect compiles reauth_redirect_location and
+// reauth_redirect_status. It returns nil when no location is configured.
+func newReauthRedirect(location string, status int) (*reauthRedirect, error) {
+    if len(location) == 0 {
+        if status != 0 {
+            return nil, errors.New("reauth_redirect_status requires reauth_redirect_location")
+        }
+        return nil, nil
+    }
+    if status != 0 && (status < 300 || status > 399) {
+        return nil, fmt.Errorf("invalid reauth_redirect_status %d: must be a 3xx status", status)
+    }
+    re, err := regexp.Compile(location)
+    if err != nil {
+        return nil, fmt.Errorf("invalid reauth_redirect_location: %w", err)
+    }
+    return &reauthRedirect{status: status, location: re}, nil
+}
+
+// matches reports whether response redirects to re-authenticate.
+func (r *reauthRedirect) matches(response *http.Response) bool {
+    if r == nil || response == nil || response.StatusCode < 300 || response.StatusCode > 399 {
+        return false
+    }
+    if r.status != 0 && response.StatusCode != r.status {
+        return false
+    }
+    return r.location.MatchString(response.Header.Get("Location"))
+}
+
+// checkRedirect is the client's redirect policy: redirects to re-authenticate
+// are returned instead of followed, so that the token isn't sent on to the
+// auth endpoint and the request can be resent with a refreshed one.
+func (r *reauthRedirect) checkRedirect(req *http.Request, via []*http.Request) error {
+    if r.matches(req.Response) {
+        return http.ErrUseLastResponse
+    }
+    if len(via) >= maxRedirects {
+        return fmt.Errorf("stopped after %d redirects", maxRedirects)
+    }
+    return nil
+}
+
+// needsReauth reports whether response rejects the token, with a 401 or a
+// redirect to re-authenticate.
+func (c *mgtvMysqlConnectionProducer) needsReauth(response *http.Response) bool {
+    return response.StatusCode == http.StatusUnauthorized || c.reauth.matches(response)
+}
@@ -0,0 +1,102 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestReauthRedirect(t *testing.T) {
+    const authPath = "/auth/login"
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // status is what the backend redirects a stale token to authPath
+        // with.
+        status int
+        // wantRefreshed is whether the delete was resent with a refreshed
+        // token, rather than the redirect followed.
+        wantRefreshed bool
+        wantInit      string
+    }{
+        {name: "matching", config: map[string]interface{}{"reauth_redirect_location": "/auth/"}, status: http.StatusFound, wantRefreshed: true},
+        {
+            name:          "matching status",
+            config:        map[string]interface{}{"reauth_redirect_location": "/auth/", "reauth_redirect_status": http.StatusTemporaryRedirect},
+            status:        http.StatusTemporaryRedirect,
+            wantRefreshed: true,
+        },
+        {
+            name:   "other status",
+            config: map[string]interface{}{"reauth_redirect_location": "/auth/", "reauth_redirect_status": http.StatusTemporaryRedirect},
+            status: http.StatusFound,
+        },
+        {name: "other location", config: map[string]interface{}{"reauth_redirect_location": "/sso/"}, status: http.StatusFound},
+        {name: "unconfigured", status: http.StatusFound},
+        {name: "status alone", config: map[string]interface{}{"reauth_redirect_status": http.StatusFound}, wantInit: "reauth_redirect_status requires reauth_redirect_location"},
+        {
+            name:     "not a redirect status",
+            config:   map[string]interface{}{"reauth_redirect_location": "/auth/", "reauth_redirect_status": http.StatusOK},
+            wantInit: "invalid reauth_redirect_status 200",
+        },
+        {name: "invalid location", config: map[string]interface{}{"reauth_redirect_location": "(auth"}, wantInit: "invalid reauth_redirect_location"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.Path == authPath {
+                    writeJSON(w, map[string]interface{}{"status": 0})
+                    return true
+                }
+                if req.Body["token"] == "token-good" {
+                    return false
+                }
+                w.Header().Set("Location", authPath+"?next=%2F")
+                w.WriteHeader(tt.status)
+                return true
+            })
+            config := map[string]interface{}{"token_kv_ref": "secret/mysql"}
+            for k, v := range tt.config {
+                config[k] = v
+            }
+            kv := &rotatingKV{tokens: []string{"token-old", "token-good"}}
+            if len(tt.wantInit) > 0 {
+                err := initError(t, backend.URL, config, WithKVSource(kv))
+                if err == nil || !strings.Contains(err.Error(), tt.wantInit) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantInit)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config, WithKVSource(kv))
+
+            err := deleteUser(db, "V_USER_R", testDeleteStatement)
+            var deletes, auths []recordedRequest
+            for _, req := range backend.received("") {
+                if req.Path == authPath {
+                    auths = append(auths, req)
+                } else if req.action() == string(actionDelUser) {
+                    deletes = append(deletes, req)
+                }
+            }
+            if !tt.wantRefreshed {
+                if len(auths) == 0 || len(deletes) != 1 {
+                    t.Fatalf("%d deletes sent and %d auth requests, want the redirect followed", len(deletes), len(auths))
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(auths) != 0 {
+                t.Fatalf("the redirect to %s was followed", authPath)
+            }
+            if len(deletes) != 2 || deletes[1].Body["token"] != "token-good" {
+                t.Fatalf("deletes sent %v, want a second one with the refreshed token", deletes)
+            }
+        })
+    }
+}
@@ -0,0 +1,55 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// ReconcileReport describes backend accounts that follow the plugin's naming
+// convention but that Vault no longer considers active.
+type ReconcileReport struct {
+    Orphaned []string
+    // Revoked lists the orphaned accounts that were deleted.
+    Revoked []string
+}
+
+// Reconcile lists the backend's users and reports those generated by this
+// plugin that are missing from active. When revoke is true the orphaned
+// accounts are deleted as well; statements are used both for listing and as
+// revocation statements. Failed revocations are aggregated in a *BatchError.
+func (c *MgtvMysql) Reconcile(ctx context.Context, active []string, statements dbplugin.Statements, revoke bool) (ReconcileReport, error) {
+    usernames, err := c.ListUsers(ctx, statements)
+    if err != nil {
+        return ReconcileReport{}, err
+    }
+    known := make(map[string]bool, len(active))
+    for _, username := range active {
+        known[username] = true
+    }
+
+    var report ReconcileReport
+    var failures []error
+    for _, username := range usernames {
+        if known[username] || !generatedUsername.MatchString(username) {
+            continue
+        }
+        report.Orphaned = append(report.Orphaned, username)
+        if !revoke {
+            continue
+        }
+        _, err := c.DeleteUser(ctx, dbplugin.DeleteUserRequest{Username: username, Statements: statements})
+        if err != nil {
+            failures = append(failures, itemError(username, err))
+            continue
+        }
+        report.Revoked = append(report.Revoked, username)
+    }
+    if len(failures) > 0 {
+        return report, &BatchError{Errors: failures}
+    }
+    return report, nil
+}
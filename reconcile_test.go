@@ -0,0 +1,128 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "reflect"
+    "sort"
+    "testing"
+)
+
+func TestReconcile(t *testing.T) {
+    const (
+        active   = "V_Active00001_r"
+        orphanA  = "V_Orphan00001_r"
+        orphanB  = "V_Orphan00002_rw"
+        external = "admin"
+    )
+    tests := []struct {
+        name   string
+        revoke bool
+        // failDelete is the orphan the backend refuses to delete, or with
+        // dropDelete drops the connection of every delete of.
+        failDelete  string
+        dropDelete  bool
+        wantRevoked []string
+        wantUsers   []string
+        wantFailed  []string
+        // wantIs is what the error is expected to match with errors.Is or
+        // errors.As.
+        wantIs interface{}
+    }{
+        {name: "detect only", wantUsers: []string{active, orphanA, orphanB, external}},
+        {name: "detect and revoke", revoke: true, wantRevoked: []string{orphanA, orphanB}, wantUsers: []string{active, external}},
+        {
+            name:        "revoke failure",
+            revoke:      true,
+            failDelete:  orphanB,
+            wantRevoked: []string{orphanA},
+            wantUsers:   []string{active, orphanB, external},
+            wantFailed:  []string{orphanB},
+            wantIs:      (**BackendError)(nil),
+        },
+        {
+            name:        "revoke unreachable",
+            revoke:      true,
+            failDelete:  orphanB,
+            dropDelete:  true,
+            wantRevoked: []string{orphanA},
+            wantUsers:   []string{active, orphanB, external},
+            wantFailed:  []string{orphanB},
+            wantIs:      ErrUnreachable,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            for _, username := range []string{active, orphanA, orphanB, external} {
+                backend.users[username] = map[string]interface{}{"username": username}
+            }
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(actionDelUser) || req.Body["username"] != tt.failDelete {
+                    return false
+                }
+                if tt.dropDelete {
+                    conn, _, err := w.(http.Hijacker).Hijack()
+                    if err != nil {
+                        t.Errorf("hijack: %v", err)
+                        return true
+                    }
+                    conn.Close()
+                    return true
+                }
+                writeJSON(w, map[string]interface{}{"status": 1, "error": "locked"})
+                return true
+            })
+            db := newTestDB(t, backend.URL, nil)
+
+            report, err := db.Reconcile(context.Background(), []string{active}, statements(testDeleteStatement), tt.revoke)
+            var failed []string
+            var batchErr *BatchError
+            switch {
+            case errors.As(err, &batchErr):
+                for _, item := range batchErr.Errors {
+                    var itemErr *BatchItemError
+                    if errors.As(item, &itemErr) {
+                        failed = append(failed, itemErr.Username)
+                    }
+                }
+            case err != nil:
+                t.Fatal(err)
+            }
+
+            orphaned := append([]string(nil), report.Orphaned...)
+            sort.Strings(orphaned)
+            if want := []string{orphanA, orphanB}; !reflect.DeepEqual(orphaned, want) {
+                t.Errorf("orphaned = %v, want %v", orphaned, want)
+            }
+            revoked := append([]string(nil), report.Revoked...)
+            sort.Strings(revoked)
+            if !reflect.DeepEqual(revoked, tt.wantRevoked) {
+                t.Errorf("revoked = %v, want %v", revoked, tt.wantRevoked)
+            }
+            if !reflect.DeepEqual(failed, tt.wantFailed) {
+                t.Errorf("failed = %v, want %v", failed, tt.wantFailed)
+            }
+            switch want := tt.wantIs.(type) {
+            case error:
+                if !errors.Is(err, want) {
+                    t.Errorf("errors.Is(%v, %v) = false", err, want)
+                }
+            case **BackendError:
+                var backendErr *BackendError
+                if !errors.As(err, &backendErr) {
+                    t.Errorf("errors.As(%v, *BackendError) = false", err)
+                }
+            }
+            wantUsers := append([]string(nil), tt.wantUsers...)
+            sort.Strings(wantUsers)
+            if got := backend.usernames(); !reflect.DeepEqual(got, wantUsers) {
+                t.Errorf("backend users = %v, want %v", got, wantUsers)
+            }
+        })
+    }
+}
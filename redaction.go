@@ -0,0 +1,76 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "os"
+    "strings"
+)
+
+// redactError replaces any known token and the given secrets in err's message
+// when strict_redaction is enabled. It doesn't rely on secretValues, so secrets
+// are kept out of errors even if the sanitizer middleware can't redact them.
+// err is returned untouched when nothing needed redacting, and a
+// *CreateUserError keeps its type. It takes the read lock, so callers holding
+// the lock use redactErrorLocked instead.
+func (c *mgtvMysqlConnectionProducer) redactError(err error, secrets ...string) error {
+    if err == nil {
+        return nil
+    }
+    c.RLock()
+    defer c.RUnlock()
+    return c.redactErrorLocked(err, secrets...)
+}
+
+// redactErrorLocked is redactError for callers holding the lock.
+func (c *mgtvMysqlConnectionProducer) redactErrorLocked(err error, secrets ...string) error {
+    if err == nil || !c.StrictRedaction {
+        return err
+    }
+    if createErr, ok := err.(*CreateUserError); ok {
+        inner := c.redactErrorLocked(createErr.Err, secrets...)
+        if inner == createErr.Err {
+            return err
+        }
+        return &CreateUserError{Username: createErr.Username, Err: inner}
+    }
+    msg := err.Error()
+    redacted := msg
+    for _, secret := range append(c.knownTokens(), secrets...) {
+        if len(secret) == 0 {
+            continue
+        }
+        redacted = strings.ReplaceAll(redacted, secret, redactedValue)
+    }
+    if redacted == msg {
+        return err
+    }
+    return &redactedError{msg: redacted, err: err}
+}
+
+// redactedError is an error whose message had secrets redacted. It unwraps to
+// the original error, so errors.Is and errors.As still match it.
+type redactedError struct {
+    msg string
+    err error
+}
+
+func (e *redactedError) Error() string {
+    return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+    return e.err
+}
+
+// knownTokens returns every token value the producer may have sent.
+func (c *mgtvMysqlConnectionProducer) knownTokens() []string {
+    raw := os.Getenv(mysqlToken)
+    revoke := os.Getenv(mysqlRevokeToken)
+    tokens := []string{raw, strings.TrimSpace(raw), revoke, strings.TrimSpace(revoke), c.Token, strings.TrimSpace(c.Token)}
+
+    c.tokenCacheLock.Lock()
+    defer c.tokenCacheLock.Unlock()
+    return append(tokens, c.tokenCache.value, strings.TrimSpace(c.tokenCache.value), c.tokenCache.revoke, strings.TrimSpace(c.tokenCache.revoke))
+}
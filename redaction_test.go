@@ -0,0 +1,133 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "testing"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// TestStrictRedaction has the backend echo the token and password back in its
+// errors. The plugin isn't wrapped in the sanitizer middleware, as if
+// secretValues were empty.
+func TestStrictRedaction(t *testing.T) {
+    const password = "Passw0rd-0123456789"
+    tests := []struct {
+        name       string
+        strict     bool
+        wantLeaked bool
+    }{
+        {name: "disabled", wantLeaked: true},
+        {name: "enabled", strict: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                writeJSON(w, map[string]interface{}{
+                    "status": 1,
+                    "error":  "rejected token " + testToken + " with password " + password,
+                })
+                return true
+            })
+            db := newTestDB(t, backend.URL, map[string]interface{}{"strict_redaction": tt.strict})
+
+            _, createErr := newUser(db, "role", testCreateStatement)
+            _, updateErr := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+                Username: "V_USER_R",
+                Password: &dbplugin.ChangePassword{NewPassword: password, Statements: statements(testDeleteStatement)},
+            })
+            deleteErr := deleteUser(db, "V_USER_R", testDeleteStatement)
+            // A delete doesn't know any password, only the token is kept out
+            // of its error.
+            ops := []struct {
+                name    string
+                err     error
+                secrets []string
+            }{
+                {name: "NewUser", err: createErr, secrets: []string{testToken, password}},
+                {name: "UpdateUser", err: updateErr, secrets: []string{testToken, password}},
+                {name: "DeleteUser", err: deleteErr, secrets: []string{testToken}},
+            }
+            for _, op := range ops {
+                if op.err == nil {
+                    t.Fatalf("%s succeeded", op.name)
+                }
+                msg := op.err.Error()
+                leaked := false
+                for _, secret := range op.secrets {
+                    leaked = leaked || strings.Contains(msg, secret)
+                }
+                if leaked != tt.wantLeaked {
+                    t.Errorf("%s error %q: secrets leaked %v, want %v", op.name, msg, leaked, tt.wantLeaked)
+                }
+                if !tt.wantLeaked && !strings.Contains(msg, redactedValue) {
+                    t.Errorf("%s error %q doesn't contain %s", op.name, msg, redactedValue)
+                }
+            }
+        })
+    }
+}
+
+func TestStrictRedactionKeepsCreateUserError(t *testing.T) {
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, map[string]interface{}{"strict_redaction": true})
+    err := db.redactError(&CreateUserError{Username: "V_USER_R", Err: &BackendError{Message: "bad " + testToken}})
+    createErr, ok := err.(*CreateUserError)
+    if !ok {
+        t.Fatalf("redacted error is %T, want *CreateUserError", err)
+    }
+    if createErr.Username != "V_USER_R" || strings.Contains(createErr.Error(), testToken) {
+        t.Fatalf("redacted error = %q for %q", createErr.Error(), createErr.Username)
+    }
+}
+
+// TestStrictRedactionKeepsChain checks that a redacted error still matches
+// what the original error matched.
+func TestStrictRedactionKeepsChain(t *testing.T) {
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, map[string]interface{}{"strict_redaction": true})
+    tests := []struct {
+        name string
+        err  error
+        want error
+    }{
+        {
+            name: "unreachable",
+            err:  &unreachableError{op: "Post", host: "mysql.example", err: errors.New("dial " + testToken)},
+            want: ErrUnreachable,
+        },
+        {
+            name: "unauthorized",
+            err:  fmt.Errorf("token %s: %w", testToken, &statusError{code: http.StatusUnauthorized}),
+            want: ErrUnauthorized,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := db.redactError(tt.err)
+            if strings.Contains(err.Error(), testToken) {
+                t.Fatalf("redacted error = %q", err.Error())
+            }
+            if !errors.Is(err, tt.want) {
+                t.Errorf("errors.Is(%q, %v) = false", err.Error(), tt.want)
+            }
+        })
+    }
+
+    err := db.redactError(&BackendError{HTTPStatus: http.StatusOK, Status: 1, Message: "bad " + testToken})
+    var backendErr *BackendError
+    if !errors.As(err, &backendErr) || backendErr.Status != 1 {
+        t.Fatalf("errors.As(%q, *BackendError) = %v", err.Error(), backendErr)
+    }
+    if strings.Contains(err.Error(), testToken) {
+        t.Fatalf("redacted error = %q", err.Error())
+    }
+}
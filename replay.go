@@ -0,0 +1,79 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "net/http"
+    "os"
+    "strconv"
+)
+
+// signatureHeader carries the hex encoded HMAC-SHA256 of a request under
+// sign_requests.
+const signatureHeader = "X-Signature"
+
+// replayStamp is the nonce and timestamp sent under replay_protection. It is
+// made once per call, so that every request the call sends, retries and
+// resends included, carries the same one.
+type replayStamp struct {
+    nonce     string
+    timestamp string
+}
+
+// newReplayStamp returns the stamp of a new call, or the zero stamp when
+// replay_protection is off.
+func (c *mgtvMysqlConnectionProducer) newReplayStamp() (replayStamp, error) {
+    if !c.ReplayProtection {
+        return replayStamp{}, nil
+    }
+    nonce, err := newNonce()
+    if err != nil {
+        return replayStamp{}, err
+    }
+    return replayStamp{nonce: nonce, timestamp: strconv.FormatInt(c.clock.Now().Unix(), 10)}, nil
+}
+
+func (s replayStamp) set(header http.Header) {
+    if len(s.nonce) == 0 {
+        return
+    }
+    header.Set(nonceHeader, s.nonce)
+    header.Set(timestampHeader, s.timestamp)
+}
+
+// configureSigning reads the signing key from the environment when
+// sign_requests is set, and checks sign_replay_headers has something to sign.
+func (c *mgtvMysqlConnectionProducer) configureSigning() error {
+    c.signingKey = nil
+    if c.SignReplayHeaders && (!c.SignRequests || !c.ReplayProtection) {
+        return errors.New("sign_replay_headers requires sign_requests and replay_protection")
+    }
+    if !c.SignRequests {
+        return nil
+    }
+    key := os.Getenv(mysqlSigningKey)
+    if len(key) == 0 {
+        return errors.New(mysqlSigningKey + " is required when sign_requests is set")
+    }
+    c.signingKey = []byte(key)
+    return nil
+}
+
+// sign sets the signature of body, and of stamp under sign_replay_headers, on
+// header. It does nothing unless sign_requests is set.
+func (c *mgtvMysqlConnectionProducer) sign(header http.Header, stamp replayStamp, body []byte) {
+    if c.signingKey == nil {
+        return
+    }
+    mac := hmac.New(sha256.New, c.signingKey)
+    if c.SignReplayHeaders {
+        mac.Write([]byte(stamp.timestamp + "\n" + stamp.nonce + "\n"))
+    }
+    mac.Write(body)
+    header.Set(signatureHeader, hex.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,172 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "testing"
+)
+
+const testSigningKey = "test-signing-key"
+
+// rejectFirst returns a respond func answering the first request for action
+// with a 401, so that it is resent with a re-read token.
+func rejectFirst(action backendAction) func(w http.ResponseWriter, req recordedRequest) bool {
+    var once sync.Once
+    return func(w http.ResponseWriter, req recordedRequest) bool {
+        if req.action() != string(action) {
+            return false
+        }
+        reject := false
+        once.Do(func() { reject = true })
+        if reject {
+            w.WriteHeader(http.StatusUnauthorized)
+        }
+        return reject
+    }
+}
+
+func TestReplayProtectionRetries(t *testing.T) {
+    tests := []struct {
+        name    string
+        respond func(t *testing.T) func(w http.ResponseWriter, req recordedRequest) bool
+    }{
+        {name: "token refresh", respond: func(*testing.T) func(w http.ResponseWriter, req recordedRequest) bool {
+            return rejectFirst(actionDelUser)
+        }},
+        {name: "incomplete response", respond: func(t *testing.T) func(w http.ResponseWriter, req recordedRequest) bool {
+            return truncateFirst(t, actionDelUser)
+        }},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, map[string]interface{}{"replay_protection": true})
+            backend.setRespond(tt.respond(t))
+            if err := deleteUser(db, "V_USER_R", testDeleteStatement); err != nil {
+                t.Fatal(err)
+            }
+            if err := deleteUser(db, "V_OTHER_R", testDeleteStatement); err != nil {
+                t.Fatal(err)
+            }
+
+            sent := backend.received(actionDelUser)
+            if len(sent) != 3 {
+                t.Fatalf("VaultDelUser sent %d times, want the first call resent and a second call", len(sent))
+            }
+            for _, req := range sent {
+                if len(req.Header.Get(nonceHeader)) != 32 {
+                    t.Fatalf("%s = %q, want 16 hex encoded bytes", nonceHeader, req.Header.Get(nonceHeader))
+                }
+                if _, err := strconv.ParseInt(req.Header.Get(timestampHeader), 10, 64); err != nil {
+                    t.Fatalf("%s = %q, want unix seconds", timestampHeader, req.Header.Get(timestampHeader))
+                }
+            }
+            if sent[0].Header.Get(nonceHeader) != sent[1].Header.Get(nonceHeader) || sent[0].Header.Get(timestampHeader) != sent[1].Header.Get(timestampHeader) {
+                t.Errorf("retry changed the stamp from %v to %v", sent[0].Header, sent[1].Header)
+            }
+            if sent[1].Header.Get(nonceHeader) == sent[2].Header.Get(nonceHeader) {
+                t.Errorf("two calls share nonce %q", sent[1].Header.Get(nonceHeader))
+            }
+        })
+    }
+}
+
+func TestSignRequests(t *testing.T) {
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // signed returns the bytes the signature covers.
+        signed func(req recordedRequest) string
+    }{
+        {
+            name:   "body",
+            config: map[string]interface{}{"sign_requests": true, "replay_protection": true},
+            signed: func(req recordedRequest) string { return string(req.Raw) },
+        },
+        {
+            name:   "replay headers",
+            config: map[string]interface{}{"sign_requests": true, "replay_protection": true, "sign_replay_headers": true},
+            signed: func(req recordedRequest) string {
+                return req.Header.Get(timestampHeader) + "\n" + req.Header.Get(nonceHeader) + "\n" + string(req.Raw)
+            },
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            t.Setenv(mysqlSigningKey, testSigningKey)
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, tt.config)
+            if _, err := newUser(db, "role", testCreateStatement); err != nil {
+                t.Fatal(err)
+            }
+            for _, req := range backend.received("") {
+                mac := hmac.New(sha256.New, []byte(testSigningKey))
+                mac.Write([]byte(tt.signed(req)))
+                if want := hex.EncodeToString(mac.Sum(nil)); req.Header.Get(signatureHeader) != want {
+                    t.Fatalf("%s %s = %q, want %q", req.action(), signatureHeader, req.Header.Get(signatureHeader), want)
+                }
+            }
+        })
+    }
+}
+
+func TestSigningConfig(t *testing.T) {
+    backend := newFakeBackend(t)
+    tests := []struct {
+        name    string
+        key     string
+        config  map[string]interface{}
+        wantErr string
+    }{
+        {name: "no key", config: map[string]interface{}{"sign_requests": true}, wantErr: mysqlSigningKey + " is required"},
+        {name: "replay headers unsigned", key: testSigningKey, config: map[string]interface{}{"sign_replay_headers": true, "replay_protection": true}, wantErr: "requires sign_requests"},
+        {name: "replay headers not sent", key: testSigningKey, config: map[string]interface{}{"sign_replay_headers": true, "sign_requests": true}, wantErr: "requires sign_requests and replay_protection"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            t.Setenv(mysqlSigningKey, tt.key)
+            err := initError(t, backend.URL, tt.config)
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+            }
+        })
+    }
+}
+
+// TestSignatureStable checks that the same logical body, whatever the order
+// of its fields, is sent as the same bytes under the same signature.
+func TestSignatureStable(t *testing.T) {
+    t.Setenv(mysqlSigningKey, testSigningKey)
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, map[string]interface{}{"sign_requests": true})
+    orders := []string{
+        `{"cid":"c1","dbname":"d1","host":"h1","extra":{"a":1,"b":[2,3],"c":{"x":"y","w":"z"}}}`,
+        `{"extra":{"c":{"w":"z","x":"y"},"b":[2,3],"a":1},"host":"h1","dbname":"d1","cid":"c1"}`,
+        `{"dbname":"d1","extra":{"b":[2,3],"c":{"x":"y","w":"z"},"a":1},"cid":"c1","host":"h1"}`,
+    }
+    for _, statement := range orders {
+        if err := deleteUser(db, "V_USER_R", statement); err != nil {
+            t.Fatal(err)
+        }
+    }
+    sent := backend.received(actionDelUser)
+    if len(sent) != len(orders) {
+        t.Fatalf("VaultDelUser sent %d times, want %d", len(sent), len(orders))
+    }
+    for _, req := range sent[1:] {
+        if string(req.Raw) != string(sent[0].Raw) {
+            t.Errorf("body %s differs from %s", req.Raw, sent[0].Raw)
+        }
+        if req.Header.Get(signatureHeader) != sent[0].Header.Get(signatureHeader) {
+            t.Errorf("signature %q differs from %q", req.Header.Get(signatureHeader), sent[0].Header.Get(signatureHeader))
+        }
+    }
+}
@@ -0,0 +1,56 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "fmt"
+    "sort"
+)
+
+// envelopeFields are present in every backend result.
+var envelopeFields = []string{"status", "error"}
+
+// knownResponseFields returns the result fields the plugin understands for
+// action. Fields named by configuration, such as host_field, are included,
+// which is why this isn't expressed as a fixed struct.
+func (c *mgtvMysqlConnectionProducer) knownResponseFields(action backendAction) map[string]bool {
+    known := make(map[string]bool)
+    for _, field := range envelopeFields {
+        known[field] = true
+    }
+    for _, field := range actionSpecs[action].responseFields {
+        known[field] = true
+    }
+    if action == actionAddUser || action == actionCommitUser {
+        known[c.HostField] = true
+        known[c.PortField] = true
+        known[c.DatabaseField] = true
+        if len(c.AccountIDField) > 0 {
+            known[c.AccountIDField] = true
+        }
+        if c.ConfirmEcho {
+            for _, field := range echoFields {
+                known[c.wireName(field)] = true
+            }
+        }
+    }
+    return known
+}
+
+// checkResponseFields fails when result has fields the plugin doesn't know for
+// action, so strict_response can detect backend API drift.
+func (c *mgtvMysqlConnectionProducer) checkResponseFields(action backendAction, result map[string]interface{}) error {
+    known := c.knownResponseFields(action)
+    var unknown []string
+    for field := range result {
+        if !known[field] {
+            unknown = append(unknown, field)
+        }
+    }
+    if len(unknown) == 0 {
+        return nil
+    }
+    sort.Strings(unknown)
+    return fmt.Errorf("response for %s contains unknown fields %q", action, unknown)
+}
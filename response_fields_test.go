@@ -0,0 +1,111 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestStrictResponse(t *testing.T) {
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        strict bool
+        // result is what the backend answers the create with.
+        result  map[string]interface{}
+        wantErr string
+    }{
+        {
+            name:   "lenient, extra fields",
+            result: map[string]interface{}{"status": 0, "host": "db1", "shard": 3, "region": "eu"},
+        },
+        {
+            name:   "strict, known fields",
+            strict: true,
+            result: map[string]interface{}{"status": 0, "error": "", "host": "db1", "port": 3306, "database": "d1"},
+        },
+        {
+            name:    "strict, extra fields",
+            strict:  true,
+            result:  map[string]interface{}{"status": 0, "host": "db1", "shard": 3, "region": "eu"},
+            wantErr: "response for " + string(actionAddUser) + ` contains unknown fields ["region" "shard"]`,
+        },
+        {
+            name:   "strict, configured field",
+            config: map[string]interface{}{"host_field": "hostname", "account_id_field": "account"},
+            strict: true,
+            result: map[string]interface{}{"status": 0, "hostname": "db1", "account": "a1"},
+        },
+        {
+            name:    "strict, default name of a configured field",
+            config:  map[string]interface{}{"host_field": "hostname"},
+            strict:  true,
+            result:  map[string]interface{}{"status": 0, "host": "db1"},
+            wantErr: `unknown fields ["host"]`,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(actionAddUser) {
+                    return false
+                }
+                writeJSON(w, tt.result)
+                return true
+            })
+            config := map[string]interface{}{"strict_response": tt.strict}
+            for k, v := range tt.config {
+                config[k] = v
+            }
+            db := newTestDB(t, backend.URL, config)
+            _, err := newUser(db, "role", testCreateStatement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+}
+
+func TestStrictResponseActions(t *testing.T) {
+    tests := []struct {
+        name    string
+        result  map[string]interface{}
+        wantErr string
+    }{
+        {name: "known", result: map[string]interface{}{"status": 0, "exists": false}},
+        {name: "extra", result: map[string]interface{}{"status": 0, "exists": false, "host": "db1"}, wantErr: "response for " + string(actionGetUser) + ` contains unknown fields ["host"]`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(actionGetUser) {
+                    return false
+                }
+                writeJSON(w, tt.result)
+                return true
+            })
+            db := newTestDB(t, backend.URL, map[string]interface{}{"strict_response": true, "verify_after_delete": true})
+            err := deleteUser(db, "V_USER_R", testDeleteStatement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("DeleteUser error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+}
@@ -0,0 +1,76 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestResponseReadTimeout(t *testing.T) {
+    tests := []struct {
+        name    string
+        timeout int
+        // stall has the backend stop writing halfway through the body, until
+        // the test ends.
+        stall   bool
+        wantErr string
+    }{
+        {name: "stalled body", timeout: 5, stall: true, wantErr: "reading the response body took longer than response_read_timeout 5s"},
+        {name: "trickled body in time", timeout: 5},
+        {name: "disabled", timeout: 0},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            release := make(chan struct{})
+            t.Cleanup(func() { close(release) })
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                w.Header().Set("Content-Type", jsonContentType)
+                w.Write([]byte(`{"status":`))
+                w.(http.Flusher).Flush()
+                if tt.stall {
+                    <-release
+                    return true
+                }
+                time.Sleep(20 * time.Millisecond)
+                w.Write([]byte(`0}`))
+                return true
+            })
+            clock := newFakeClock()
+            db := newTestDB(t, backend.URL, map[string]interface{}{"response_read_timeout": tt.timeout}, WithClock(clock))
+
+            done := make(chan error, 1)
+            go func() { done <- deleteUser(db, "V_USER_R", testDeleteStatement) }()
+            if tt.stall {
+                clock.waitForTimers(t, 1)
+                clock.Advance(time.Duration(tt.timeout) * time.Second)
+            }
+            select {
+            case err := <-done:
+                if len(tt.wantErr) > 0 {
+                    if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                        t.Fatalf("DeleteUser error = %v, want %q", err, tt.wantErr)
+                    }
+                    return
+                }
+                if err != nil {
+                    t.Fatal(err)
+                }
+            case <-time.After(5 * time.Second):
+                t.Fatal("DeleteUser didn't return")
+            }
+        })
+    }
+}
+
+func TestResponseReadTimeoutInvalid(t *testing.T) {
+    backend := newFakeBackend(t)
+    err := initError(t, backend.URL, map[string]interface{}{"response_read_timeout": -1})
+    if err == nil || !strings.Contains(err.Error(), "invalid response_read_timeout -1") {
+        t.Fatalf("Initialize error = %v, want an invalid response_read_timeout", err)
+    }
+}
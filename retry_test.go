@@ -0,0 +1,208 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/http"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// truncateFirst returns a respond func cutting the response to the first
+// request for action short, by closing the connection mid-body.
+func truncateFirst(t *testing.T, action backendAction) func(w http.ResponseWriter, req recordedRequest) bool {
+    var once sync.Once
+    return func(w http.ResponseWriter, req recordedRequest) bool {
+        if req.action() != string(action) {
+            return false
+        }
+        truncate := false
+        once.Do(func() { truncate = true })
+        if !truncate {
+            return false
+        }
+        truncateResponse(t, w)
+        return true
+    }
+}
+
+// truncateResponse answers with a response cut short, by closing the
+// connection mid-body.
+func truncateResponse(t *testing.T, w http.ResponseWriter) {
+    conn, buf, err := w.(http.Hijacker).Hijack()
+    if err != nil {
+        t.Errorf("hijack: %v", err)
+        return
+    }
+    defer conn.Close()
+    buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: 64\r\n\r\n{\"status\":0,")
+    buf.Flush()
+}
+
+func TestIncompleteResponseResend(t *testing.T) {
+    tests := []struct {
+        name     string
+        config   map[string]interface{}
+        action   backendAction
+        wantSent int
+    }{
+        {name: "create not resent by default", action: actionAddUser, wantSent: 1},
+        {name: "prepare not resent by default", config: map[string]interface{}{"two_phase_create": true}, action: actionPrepareUser, wantSent: 1},
+        {name: "create resent when listed", config: map[string]interface{}{"retry_actions": []string{"AddUser"}}, action: actionAddUser, wantSent: 2},
+        {name: "delete resent by default", action: actionDelUser, wantSent: 2},
+        {name: "delete not resent when unlisted", config: map[string]interface{}{"retry_actions": []string{"AddUser"}}, action: actionDelUser, wantSent: 1},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, tt.config)
+            backend.setRespond(truncateFirst(t, tt.action))
+            var err error
+            if tt.action == actionDelUser {
+                err = deleteUser(db, "V_EXISTING_R", testDeleteStatement)
+            } else {
+                _, err = newUser(db, "role", testCreateStatement)
+            }
+            if sent := len(backend.received(tt.action)); sent != tt.wantSent {
+                t.Fatalf("%s sent %d times, want %d", tt.action, sent, tt.wantSent)
+            }
+            switch {
+            case tt.wantSent > 1 && err != nil:
+                t.Fatalf("resent %s failed: %v", tt.action, err)
+            case tt.wantSent == 1 && (err == nil || !strings.Contains(err.Error(), "incomplete response")):
+                t.Fatalf("error = %v, want an incomplete response", err)
+            }
+        })
+    }
+}
+
+// dropFirst returns a respond func closing the connection without a response
+// to the first n requests for action, as a load balancer dropping an idle
+// keep-alive connection does.
+func dropFirst(t *testing.T, action backendAction, n int) func(w http.ResponseWriter, req recordedRequest) bool {
+    var mu sync.Mutex
+    dropped := 0
+    return func(w http.ResponseWriter, req recordedRequest) bool {
+        if req.action() != string(action) {
+            return false
+        }
+        mu.Lock()
+        drop := dropped < n
+        dropped++
+        mu.Unlock()
+        if !drop {
+            return false
+        }
+        conn, _, err := w.(http.Hijacker).Hijack()
+        if err != nil {
+            t.Errorf("hijack: %v", err)
+            return true
+        }
+        conn.Close()
+        return true
+    }
+}
+
+func TestDroppedConnectionRetry(t *testing.T) {
+    tests := []struct {
+        name     string
+        config   map[string]interface{}
+        action   backendAction
+        drops    int
+        wantSent int
+        wantErr  bool
+    }{
+        {name: "delete retried once", action: actionDelUser, drops: 1, wantSent: 2},
+        {name: "retried without connect retries", config: map[string]interface{}{"connect_retries": 0}, action: actionDelUser, drops: 1, wantSent: 2},
+        {name: "dropped twice", action: actionDelUser, drops: 2, wantSent: 2, wantErr: true},
+        {name: "create not retried", action: actionAddUser, drops: 1, wantSent: 1, wantErr: true},
+        {name: "create retried when listed", config: map[string]interface{}{"retry_actions": []string{"AddUser"}}, action: actionAddUser, drops: 1, wantSent: 2},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, tt.config)
+            backend.setRespond(dropFirst(t, tt.action, tt.drops))
+            var err error
+            if tt.action == actionDelUser {
+                err = deleteUser(db, "V_USER_R", testDeleteStatement)
+            } else {
+                _, err = newUser(db, "role", testCreateStatement)
+            }
+            if sent := len(backend.received(tt.action)); sent != tt.wantSent {
+                t.Fatalf("%s sent %d times, want %d", tt.action, sent, tt.wantSent)
+            }
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("error = %v, want one: %v", err, tt.wantErr)
+            }
+            if tt.wantErr && !strings.Contains(err.Error(), "EOF") {
+                t.Fatalf("error %q doesn't report the dropped connection", err)
+            }
+        })
+    }
+}
+
+func TestRetryActions(t *testing.T) {
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // wantRetried is whether each action is resent after a dropped
+        // connection.
+        wantRetried map[backendAction]bool
+        wantErr     string
+    }{
+        // Creates aren't resent unless listed: the first send may have
+        // created the user.
+        {name: "unset", wantRetried: map[backendAction]bool{actionAddUser: false, actionDelUser: true}},
+        {
+            name:        "create listed",
+            config:      map[string]interface{}{"retry_actions": []interface{}{string(actionAddUser), string(actionDelUser)}},
+            wantRetried: map[backendAction]bool{actionAddUser: true, actionDelUser: true},
+        },
+        {
+            name:        "delete only",
+            config:      map[string]interface{}{"retry_actions": []interface{}{string(actionDelUser)}},
+            wantRetried: map[backendAction]bool{actionAddUser: false, actionDelUser: true},
+        },
+        {
+            name:        "none",
+            config:      map[string]interface{}{"retry_actions": []interface{}{}},
+            wantRetried: map[backendAction]bool{actionAddUser: false, actionDelUser: false},
+        },
+        {name: "unknown action", config: map[string]interface{}{"retry_actions": []interface{}{"VaultDropUser"}}, wantErr: `invalid retry_actions "VaultDropUser"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if len(tt.wantErr) > 0 {
+                err := initError(t, newFakeBackend(t).URL, tt.config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            for action, wantRetried := range tt.wantRetried {
+                backend := newFakeBackend(t)
+                backend.setRespond(dropFirst(t, action, 1))
+                db := newTestDB(t, backend.URL, tt.config)
+                var err error
+                if action == actionAddUser {
+                    _, err = newUser(db, "role", testCreateStatement)
+                } else {
+                    err = deleteUser(db, "V_USER_R", testDeleteStatement)
+                }
+                sent := len(backend.received(action))
+                if wantRetried {
+                    if err != nil || sent != 2 {
+                        t.Errorf("%s = %v after %d sends, want success after 2", action, err, sent)
+                    }
+                    continue
+                }
+                if err == nil || sent != 1 {
+                    t.Errorf("%s = %v after %d sends, want a failure after 1", action, err, sent)
+                }
+            }
+        })
+    }
+}
@@ -0,0 +1,113 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// createdAtLayout is the format created_at is forwarded and read in.
+const createdAtLayout = time.RFC3339
+
+// RevokeByRole revokes the users created for role between start and end; a
+// zero start or end leaves that side of the window open. When the backend
+// declares revoke_window_supported it selects and revokes the users itself,
+// otherwise the users are listed and filtered on the role and created_at the
+// plugin forwards at creation. statements are used for listing and as
+// revocation statements. Users created before created_at was forwarded can't
+// be attributed and are left alone.
+func (c *MgtvMysql) RevokeByRole(ctx context.Context, role string, start, end time.Time, statements dbplugin.Statements) (_ BatchResult, err error) {
+    defer func() { err = c.redactError(err) }()
+
+    if len(role) == 0 {
+        return BatchResult{}, errors.New("no role to revoke users of")
+    }
+    if !start.IsZero() && !end.IsZero() && end.Before(start) {
+        return BatchResult{}, fmt.Errorf("invalid window: end %s is before start %s", end.Format(createdAtLayout), start.Format(createdAtLayout))
+    }
+    c.Lock()
+    supported := c.RevokeWindowSupported
+    c.Unlock()
+    if supported {
+        return c.revokeWindow(ctx, role, start, end, statements)
+    }
+
+    records, err := c.listUsers(ctx, statements)
+    if err != nil {
+        return BatchResult{}, err
+    }
+    var batch BatchResult
+    for _, record := range records {
+        if resultString(record, "role") != role {
+            continue
+        }
+        created, err := time.Parse(createdAtLayout, resultString(record, "created_at"))
+        if err != nil || !inWindow(created, start, end) {
+            continue
+        }
+        username := resultString(record, "username")
+        _, err = c.DeleteUser(ctx, dbplugin.DeleteUserRequest{Username: username, Statements: statements})
+        if err != nil {
+            err = itemError(username, err)
+        }
+        batch.Items = append(batch.Items, BatchItemResult{Username: username, Err: err})
+    }
+    return batch, batch.Err()
+}
+
+// revokeWindow has the backend revoke the users of role created within the
+// window in a single call.
+func (c *MgtvMysql) revokeWindow(ctx context.Context, role string, start, end time.Time, statements dbplugin.Statements) (BatchResult, error) {
+    c.Lock()
+    defer c.Unlock()
+
+    statement, err := parseStatement(statements)
+    if err != nil {
+        return BatchResult{}, err
+    }
+    fields := map[string]interface{}{"role": role}
+    if !start.IsZero() {
+        fields["created_after"] = start.UTC().Format(createdAtLayout)
+    }
+    if !end.IsZero() {
+        fields["created_before"] = end.UTC().Format(createdAtLayout)
+    }
+    body, err := c.buildRequest(ctx, actionRevokeByRole, statement, fields)
+    if err != nil {
+        return BatchResult{}, err
+    }
+    result, err := c.invoke(ctx, actionRevokeByRole, body)
+    if err != nil {
+        return BatchResult{}, fmt.Errorf("revoke users of role %s failed: %w", role, err)
+    }
+    revoked, _ := result["usernames"].([]interface{})
+    var batch BatchResult
+    for _, raw := range revoked {
+        username, ok := raw.(string)
+        if !ok {
+            continue
+        }
+        c.invalidateUser(username)
+        c.forgetConnectionDetails(username)
+        c.emitEvent(ctx, EventCredentialDelete, username, map[string]interface{}{"role": role})
+        batch.Items = append(batch.Items, BatchItemResult{Username: username})
+    }
+    return batch, nil
+}
+
+// inWindow reports whether t is within [start, end), zero bounds being open.
+func inWindow(t, start, end time.Time) bool {
+    if !start.IsZero() && t.Before(start) {
+        return false
+    }
+    if !end.IsZero() && !t.Before(end) {
+        return false
+    }
+    return true
+}
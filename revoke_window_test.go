@@ -0,0 +1,178 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "net/http"
+    "sort"
+    "strings"
+    "testing"
+    "time"
+)
+
+// TestRevokeByRoleClientFiltered lists the users and revokes those of the role
+// created within the window, by the created_at forwarded at creation.
+func TestRevokeByRoleClientFiltered(t *testing.T) {
+    tests := []struct {
+        name string
+        // start and end are offsets from the first create, zero being open.
+        start, end time.Duration
+        // wantRevoked are indexes into the users created for "role".
+        wantRevoked []int
+    }{
+        {name: "open window", wantRevoked: []int{0, 1, 2}},
+        {name: "from start", start: time.Hour, wantRevoked: []int{1, 2}},
+        {name: "until end, exclusive", end: time.Hour, wantRevoked: []int{0}},
+        {name: "bounded", start: 30 * time.Minute, end: 90 * time.Minute, wantRevoked: []int{1}},
+        {name: "empty window", start: 3 * time.Hour, end: 4 * time.Hour},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            clock := newFakeClock()
+            db := newTestDB(t, backend.URL, nil, WithClock(clock))
+            first := clock.Now()
+            var created, others []string
+            for i := 0; i < 3; i++ {
+                username, err := newUser(db, "role", testCreateStatement)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                created = append(created, username)
+                other, err := newUser(db, "other", testCreateStatement)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                others = append(others, other)
+                clock.Advance(time.Hour)
+            }
+            // A user the plugin didn't forward created_at for is left alone.
+            backend.mu.Lock()
+            backend.users["V_LEGACY_R"] = map[string]interface{}{"role": "role"}
+            backend.mu.Unlock()
+
+            var start, end time.Time
+            if tt.start > 0 {
+                start = first.Add(tt.start)
+            }
+            if tt.end > 0 {
+                end = first.Add(tt.end)
+            }
+            result, err := db.RevokeByRole(context.Background(), "role", start, end, statements(testDeleteStatement))
+            if err != nil {
+                t.Fatal(err)
+            }
+            var want, got []string
+            for _, i := range tt.wantRevoked {
+                want = append(want, created[i])
+            }
+            for _, item := range result.Items {
+                got = append(got, item.Username)
+            }
+            sort.Strings(want)
+            sort.Strings(got)
+            if strings.Join(got, ",") != strings.Join(want, ",") {
+                t.Fatalf("revoked %v, want %v", got, want)
+            }
+            for _, username := range want {
+                if backend.has(username) {
+                    t.Errorf("%s wasn't deleted", username)
+                }
+            }
+            for _, username := range others {
+                if !backend.has(username) {
+                    t.Errorf("%s of another role was revoked", username)
+                }
+            }
+            if !backend.has("V_LEGACY_R") {
+                t.Error("user without created_at was revoked")
+            }
+            if n := len(backend.received(actionRevokeByRole)); n != 0 {
+                t.Errorf("%s sent %d times without revoke_window_supported", actionRevokeByRole, n)
+            }
+        })
+    }
+}
+
+func TestRevokeByRoleBackendFiltered(t *testing.T) {
+    start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.FixedZone("CST", 8*3600))
+    end := start.Add(time.Hour)
+    tests := []struct {
+        name       string
+        start, end time.Time
+        // wantAfter and wantBefore are the window fields sent, "" when
+        // omitted.
+        wantAfter, wantBefore string
+    }{
+        {name: "bounded", start: start, end: end, wantAfter: "2024-01-01T00:00:00Z", wantBefore: "2024-01-01T01:00:00Z"},
+        {name: "open start", end: end, wantBefore: "2024-01-01T01:00:00Z"},
+        {name: "open end", start: start, wantAfter: "2024-01-01T00:00:00Z"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(actionRevokeByRole) {
+                    return false
+                }
+                writeJSON(w, map[string]interface{}{"status": 0, "usernames": []interface{}{"V_A_R", "V_B_RW"}})
+                return true
+            })
+            db := newTestDB(t, backend.URL, map[string]interface{}{"revoke_window_supported": true})
+            result, err := db.RevokeByRole(context.Background(), "role", tt.start, tt.end, statements(testDeleteStatement))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if len(result.Items) != 2 || result.Items[0].Username != "V_A_R" || result.Items[1].Username != "V_B_RW" {
+                t.Fatalf("revoked %+v, want V_A_R and V_B_RW", result.Items)
+            }
+            sent := backend.received(actionRevokeByRole)
+            if len(sent) != 1 {
+                t.Fatalf("%s sent %d times, want once", actionRevokeByRole, len(sent))
+            }
+            for field, want := range map[string]string{"created_after": tt.wantAfter, "created_before": tt.wantBefore} {
+                got, ok := sent[0].Body[field]
+                switch {
+                case len(want) == 0 && ok:
+                    t.Errorf("%s sent as %v for an open window", field, got)
+                case len(want) > 0 && got != want:
+                    t.Errorf("%s sent as %v, want %s", field, got, want)
+                }
+            }
+            if sent[0].Body["role"] != "role" {
+                t.Errorf("role sent as %v, want role", sent[0].Body["role"])
+            }
+            if n := len(backend.received(actionListUsers)); n != 0 {
+                t.Errorf("users listed %d times with revoke_window_supported", n)
+            }
+        })
+    }
+}
+
+func TestRevokeByRoleInvalid(t *testing.T) {
+    now := time.Now()
+    tests := []struct {
+        name       string
+        role       string
+        start, end time.Time
+        wantErr    string
+    }{
+        {name: "no role", wantErr: "no role to revoke users of"},
+        {name: "end before start", role: "role", start: now, end: now.Add(-time.Second), wantErr: "invalid window: end"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, nil)
+            _, err := db.RevokeByRole(context.Background(), tt.role, tt.start, tt.end, statements(testDeleteStatement))
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Fatalf("RevokeByRole error = %v, want %q", err, tt.wantErr)
+            }
+            if n := len(backend.received("")); n != 0 {
+                t.Fatalf("%d requests sent for an invalid window", n)
+            }
+        })
+    }
+}
@@ -0,0 +1,61 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "fmt"
+    "sync"
+)
+
+// checkRoleCap fails when role already has as many active users as
+// max_users_per_role allows it, so that runaway provisioning is stopped at
+// the plugin. The users are counted through the list endpoint, called with
+// the create statement fields, on the role the plugin forwards at creation;
+// users created before it was forwarded aren't counted. It must be called
+// holding the role's roleCapLocks lock until the create is done, which keeps
+// concurrent creates from overshooting the cap.
+func (c *mgtvMysqlConnectionProducer) checkRoleCap(ctx context.Context, role string, statement map[string]interface{}) error {
+    limit := c.MaxUsersPerRole[role]
+    if limit <= 0 {
+        return nil
+    }
+    records, err := c.listUserRecords(ctx, statement)
+    if err != nil {
+        return fmt.Errorf("count users of role %q: %w", role, err)
+    }
+    active := 0
+    for _, record := range records {
+        if resultString(record, "role") == role {
+            active++
+        }
+    }
+    if active >= limit {
+        return fmt.Errorf("role %q already has %d active users, reaching max_users_per_role %d", role, active, limit)
+    }
+    return nil
+}
+
+// keyedMutex is a mutex per key, so that operations on a key are serialized
+// while those on other keys go on.
+type keyedMutex struct {
+    mu    sync.Mutex
+    locks map[string]*sync.Mutex
+}
+
+// lock blocks until key's mutex is held, and returns the func releasing it.
+func (m *keyedMutex) lock(key string) func() {
+    m.mu.Lock()
+    if m.locks == nil {
+        m.locks = make(map[string]*sync.Mutex)
+    }
+    l, ok := m.locks[key]
+    if !ok {
+        l = &sync.Mutex{}
+        m.locks[key] = l
+    }
+    m.mu.Unlock()
+    l.Lock()
+    return l.Unlock
+}
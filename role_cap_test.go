@@ -0,0 +1,124 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/http"
+    "strings"
+    "sync"
+    "testing"
+)
+
+// TestMaxUsersPerRoleConcurrent checks that creates running concurrently
+// don't overshoot max_users_per_role between counting and creating.
+func TestMaxUsersPerRoleConcurrent(t *testing.T) {
+    const limit, creates = 2, 6
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, map[string]interface{}{"max_users_per_role": map[string]interface{}{"capped": limit}})
+
+    errs := make(chan error, creates)
+    var wg sync.WaitGroup
+    for i := 0; i < creates; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            _, err := newUser(db, "capped", testCreateStatement)
+            errs <- err
+        }()
+    }
+    wg.Wait()
+    close(errs)
+    created := 0
+    for err := range errs {
+        switch {
+        case err == nil:
+            created++
+        case !strings.Contains(err.Error(), "max_users_per_role"):
+            t.Errorf("NewUser: %v", err)
+        }
+    }
+    if created != limit || len(backend.usernames()) != limit {
+        t.Fatalf("%d creates succeeded and the backend holds %v, want %d users", created, backend.usernames(), limit)
+    }
+}
+
+func TestMaxUsersPerRole(t *testing.T) {
+    tests := []struct {
+        name string
+        cap  interface{}
+        // existing maps the users the backend already holds to their role,
+        // none when empty.
+        existing map[string]string
+        role     string
+        listFail bool
+        // wantListed is whether the users were counted.
+        wantListed bool
+        wantErr    string
+        wantInit   string
+    }{
+        {name: "under the cap", cap: 2, existing: map[string]string{"V_A_r": "capped"}, role: "capped", wantListed: true},
+        {
+            name:       "reaching the cap",
+            cap:        2,
+            existing:   map[string]string{"V_A_r": "capped", "V_B_r": "capped"},
+            role:       "capped",
+            wantListed: true,
+            wantErr:    `role "capped" already has 2 active users, reaching max_users_per_role 2`,
+        },
+        {name: "other roles' users", cap: 2, existing: map[string]string{"V_A_r": "other", "V_B_r": "other"}, role: "capped", wantListed: true},
+        {name: "users without a role", cap: 2, existing: map[string]string{"V_A_r": "", "V_B_r": ""}, role: "capped", wantListed: true},
+        {name: "uncapped role", cap: 1, existing: map[string]string{"V_A_r": "other", "V_B_r": "other"}, role: "other"},
+        {name: "list failure", cap: 2, role: "capped", listFail: true, wantListed: true, wantErr: `count users of role "capped"`},
+        {name: "zero", cap: 0, wantInit: `invalid max_users_per_role 0 for role "capped": must be positive`},
+        {name: "negative", cap: -1, wantInit: `invalid max_users_per_role -1 for role "capped"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.mu.Lock()
+            for username, role := range tt.existing {
+                backend.users[username] = map[string]interface{}{"username": username}
+                if len(role) > 0 {
+                    backend.users[username]["role"] = role
+                }
+            }
+            backend.mu.Unlock()
+            if tt.listFail {
+                backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                    if req.action() != string(actionListUsers) {
+                        return false
+                    }
+                    w.WriteHeader(http.StatusInternalServerError)
+                    return true
+                })
+            }
+            config := map[string]interface{}{"max_users_per_role": map[string]interface{}{"capped": tt.cap}}
+            if len(tt.wantInit) > 0 {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantInit) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantInit)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+
+            _, err := newUser(db, tt.role, testCreateStatement)
+            if listed := len(backend.received(actionListUsers)) > 0; listed != tt.wantListed {
+                t.Errorf("users listed: %v, want %v", listed, tt.wantListed)
+            }
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                if n := len(backend.received(actionAddUser)); n != 0 {
+                    t.Fatalf("AddUser sent %d times, want none", n)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+}
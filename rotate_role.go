@@ -0,0 +1,113 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "sync"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+// defaultRotateConcurrency is how many rotations RotateRole runs at a time
+// when not told otherwise.
+const defaultRotateConcurrency = 4
+
+// RotateItemResult is the outcome of RotateRole for a single username.
+type RotateItemResult struct {
+    Username string
+    // Password is the new password, set when Err is nil.
+    Password string
+    Err      error
+}
+
+// RotateResult holds the per-username outcome of RotateRole.
+type RotateResult struct {
+    Items []RotateItemResult
+}
+
+// Failed returns the usernames whose password wasn't rotated.
+func (r RotateResult) Failed() []string {
+    var failed []string
+    for _, item := range r.Items {
+        if item.Err != nil {
+            failed = append(failed, item.Username)
+        }
+    }
+    return failed
+}
+
+// Err aggregates the failed items into a *BatchError, or returns nil when
+// every password was rotated.
+func (r RotateResult) Err() error {
+    var errs []error
+    for _, item := range r.Items {
+        if item.Err != nil {
+            errs = append(errs, item.Err)
+        }
+    }
+    if len(errs) == 0 {
+        return nil
+    }
+    return &BatchError{Errors: errs}
+}
+
+// RotateRole rotates the password of every user created for role, as a
+// response to a compromised credential. The users are listed and filtered on
+// the role the plugin forwards at creation, and up to concurrency of them,
+// or defaultRotateConcurrency when it isn't positive, are rotated at a time,
+// each waiting for its turn under rate_limit like any backend call.
+// statements are used for listing and as rotation statements. Once ctx is
+// done no further rotations are started, and the users left are reported as
+// failed.
+func (c *MgtvMysql) RotateRole(ctx context.Context, role string, concurrency int, statements dbplugin.Statements) (_ RotateResult, err error) {
+    defer func() { err = c.redactError(err) }()
+
+    if len(role) == 0 {
+        return RotateResult{}, errors.New("no role to rotate users of")
+    }
+    if concurrency <= 0 {
+        concurrency = defaultRotateConcurrency
+    }
+    records, err := c.listUsers(ctx, statements)
+    if err != nil {
+        return RotateResult{}, err
+    }
+    var result RotateResult
+    for _, record := range records {
+        if resultString(record, "role") == role {
+            result.Items = append(result.Items, RotateItemResult{Username: resultString(record, "username")})
+        }
+    }
+
+    slots := make(chan struct{}, concurrency)
+    var wg sync.WaitGroup
+    for i := range result.Items {
+        item := &result.Items[i]
+        if ctx.Err() == nil {
+            select {
+            case slots <- struct{}{}:
+            case <-ctx.Done():
+            }
+        }
+        if ctx.Err() != nil {
+            item.Err = itemError(item.Username, ctx.Err())
+            continue
+        }
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            defer func() { <-slots }()
+            password, err := c.RotatePassword(ctx, item.Username, statements)
+            if err != nil {
+                item.Err = itemError(item.Username, err)
+                return
+            }
+            item.Password = password
+        }()
+    }
+    wg.Wait()
+    return result, result.Err()
+}
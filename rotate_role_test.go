@@ -0,0 +1,178 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "sort"
+    "sync"
+    "testing"
+    "time"
+)
+
+func TestRotateRole(t *testing.T) {
+    tests := []struct {
+        name string
+        // failing is the number of the role's users the backend fails to
+        // rotate.
+        failing int
+    }{
+        {name: "all succeed"},
+        {name: "partial failure", failing: 2},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, nil)
+            var users []string
+            for i := 0; i < 5; i++ {
+                username, err := newUser(db, "target", testCreateStatement)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                users = append(users, username)
+            }
+            if _, err := newUser(db, "other", testCreateStatement); err != nil {
+                t.Fatal(err)
+            }
+            failing := make(map[string]bool)
+            for _, username := range users[:tt.failing] {
+                failing[username] = true
+            }
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                username, _ := req.Body["username"].(string)
+                if req.action() != string(actionChangePassword) || !failing[username] {
+                    return false
+                }
+                writeJSON(w, map[string]interface{}{"status": 1, "error": "locked"})
+                return true
+            })
+
+            result, err := db.RotateRole(context.Background(), "target", 2, statements(testDeleteStatement))
+            if tt.failing == 0 && err != nil {
+                t.Fatalf("RotateRole: %v", err)
+            }
+            var batchErr *BatchError
+            if tt.failing > 0 && (!errors.As(err, &batchErr) || len(batchErr.Errors) != tt.failing) {
+                t.Fatalf("RotateRole error = %v, want %d failures", err, tt.failing)
+            }
+            var backendErr *BackendError
+            if tt.failing > 0 && (!errors.As(err, &backendErr) || backendErr.Message != "locked") {
+                t.Fatalf("errors.As(%v, *BackendError) = %v, want the backend's failure", err, backendErr)
+            }
+            if len(result.Items) != len(users) {
+                t.Fatalf("rotated %d users, want the role's %d", len(result.Items), len(users))
+            }
+            for _, item := range result.Items {
+                switch {
+                case failing[item.Username] && item.Err == nil:
+                    t.Errorf("%s: rotation reported successful", item.Username)
+                case !failing[item.Username] && (item.Err != nil || len(item.Password) == 0):
+                    t.Errorf("%s: password %q, error %v", item.Username, item.Password, item.Err)
+                }
+            }
+            failed := result.Failed()
+            sort.Strings(failed)
+            want := append([]string(nil), users[:tt.failing]...)
+            sort.Strings(want)
+            if len(failed) != len(want) {
+                t.Fatalf("Failed() = %v, want %v", failed, want)
+            }
+            for i := range want {
+                if failed[i] != want[i] {
+                    t.Fatalf("Failed() = %v, want %v", failed, want)
+                }
+            }
+        })
+    }
+}
+
+// TestRotateRoleConcurrency checks that concurrency rotations are in flight at
+// the same time, and no more.
+func TestRotateRoleConcurrency(t *testing.T) {
+    const concurrency = 3
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, nil)
+    for i := 0; i < 2*concurrency; i++ {
+        if _, err := newUser(db, "target", testCreateStatement); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    var mu sync.Mutex
+    inFlight, peak := 0, 0
+    gate := make(chan struct{})
+    backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+        if req.action() != string(actionChangePassword) {
+            return false
+        }
+        mu.Lock()
+        inFlight++
+        if inFlight > peak {
+            peak = inFlight
+        }
+        mu.Unlock()
+        <-gate
+        mu.Lock()
+        inFlight--
+        mu.Unlock()
+        return false
+    })
+
+    done := make(chan error, 1)
+    go func() {
+        _, err := db.RotateRole(context.Background(), "target", concurrency, statements(testDeleteStatement))
+        done <- err
+    }()
+    deadline := time.Now().Add(5 * time.Second)
+    for {
+        mu.Lock()
+        reached := inFlight == concurrency
+        mu.Unlock()
+        if reached {
+            break
+        }
+        if time.Now().After(deadline) {
+            close(gate)
+            t.Fatalf("%d rotations in flight at most, want %d", peak, concurrency)
+        }
+        time.Sleep(time.Millisecond)
+    }
+    close(gate)
+    if err := <-done; err != nil {
+        t.Fatal(err)
+    }
+    if peak != concurrency {
+        t.Fatalf("%d rotations in flight at most, want %d", peak, concurrency)
+    }
+}
+
+func TestRotateRoleCancelled(t *testing.T) {
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, nil)
+    for i := 0; i < 3; i++ {
+        if _, err := newUser(db, "target", testCreateStatement); err != nil {
+            t.Fatal(err)
+        }
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+        if req.action() == string(actionChangePassword) {
+            cancel()
+        }
+        return false
+    })
+    result, err := db.RotateRole(ctx, "target", 1, statements(testDeleteStatement))
+    if err == nil {
+        t.Fatal("RotateRole succeeded after ctx was cancelled")
+    }
+    if n := len(backend.received(actionChangePassword)); n != 1 {
+        t.Fatalf("%d rotations sent, want only the one cancelling ctx", n)
+    }
+    if len(result.Failed()) < 2 {
+        t.Fatalf("Failed() = %v, want the users left once ctx was cancelled", result.Failed())
+    }
+}
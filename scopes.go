@@ -0,0 +1,75 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "fmt"
+)
+
+// Token scopes the backend reports from WhoAmI.
+const (
+    scopeCreate = "create"
+    scopeDelete = "delete"
+)
+
+// verifyTokenScopes asks the backend, through WhoAmI, which scopes the tokens
+// the plugin uses carry, and fails when the token users are created with lacks
+// the create scope or the token revocations are made with lacks the delete
+// scope. It catches under-privileged tokens before the first credential is
+// requested.
+func (c *mgtvMysqlConnectionProducer) verifyTokenScopes(ctx context.Context) error {
+    token, err := c.token(ctx)
+    if err != nil {
+        return err
+    }
+    revocation, err := c.revocationToken(ctx)
+    if err != nil {
+        return err
+    }
+    if revocation == token {
+        return c.requireScopes(ctx, "token", token, scopeCreate, scopeDelete)
+    }
+    if err := c.requireScopes(ctx, "token", token, scopeCreate); err != nil {
+        return err
+    }
+    return c.requireScopes(ctx, mysqlRevokeToken, revocation, scopeDelete)
+}
+
+// actionScope returns the scope verifyTokenScopes requires of the token action
+// is made with.
+func actionScope(action backendAction) string {
+    if actionSpecs[action].revocation {
+        return scopeDelete
+    }
+    return scopeCreate
+}
+
+// requireScopes fails unless WhoAmI reports every one of scopes for token.
+// name identifies the token in errors. WhoAmI is asked with token itself, so a
+// rejection of it isn't answered by refreshing the token.
+func (c *mgtvMysqlConnectionProducer) requireScopes(ctx context.Context, name, token string, scopes ...string) error {
+    body, err := c.buildRequest(ctx, actionWhoAmI, nil, nil)
+    if err != nil {
+        return err
+    }
+    body["token"] = token
+    result, err := c.invoke(withCallerToken(ctx), actionWhoAmI, body)
+    if err != nil {
+        return fmt.Errorf("verify token scopes failed: %w", err)
+    }
+    granted := make(map[string]bool)
+    reported, _ := result["scopes"].([]interface{})
+    for _, raw := range reported {
+        if scope, ok := raw.(string); ok {
+            granted[scope] = true
+        }
+    }
+    for _, scope := range scopes {
+        if !granted[scope] {
+            return fmt.Errorf("%s is missing the %q scope, the backend reported %q", name, scope, reported)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,185 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "net/http"
+    "strings"
+    "testing"
+
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestVerifyTokenScopes(t *testing.T) {
+    tests := []struct {
+        name   string
+        verify bool
+        // revokeToken is mysql_revoke_token, the token being shared when empty.
+        revokeToken string
+        // scopes are the scopes WhoAmI reports by token.
+        scopes map[string][]interface{}
+        // whoAmIFails answers WhoAmI with a 500, and rejected with a 401 for
+        // those tokens.
+        whoAmIFails bool
+        rejected    map[string]bool
+        wantWhoAmI  []string
+        wantErr     string
+    }{
+        {name: "disabled", scopes: map[string][]interface{}{}},
+        {
+            name:       "shared token",
+            verify:     true,
+            scopes:     map[string][]interface{}{testToken: {scopeCreate, scopeDelete, "list"}},
+            wantWhoAmI: []string{testToken},
+        },
+        {
+            name:       "shared token without delete",
+            verify:     true,
+            scopes:     map[string][]interface{}{testToken: {scopeCreate}},
+            wantWhoAmI: []string{testToken},
+            wantErr:    `token is missing the "delete" scope, the backend reported ["create"]`,
+        },
+        {
+            name:        "separate tokens",
+            verify:      true,
+            revokeToken: "revoke-token",
+            scopes:      map[string][]interface{}{testToken: {scopeCreate}, "revoke-token": {scopeDelete}},
+            wantWhoAmI:  []string{testToken, "revoke-token"},
+        },
+        {
+            name:        "token without create",
+            verify:      true,
+            revokeToken: "revoke-token",
+            scopes:      map[string][]interface{}{testToken: {scopeDelete}, "revoke-token": {scopeDelete}},
+            wantWhoAmI:  []string{testToken},
+            wantErr:     `token is missing the "create" scope`,
+        },
+        {
+            name:        "revocation token without delete",
+            verify:      true,
+            revokeToken: "revoke-token",
+            scopes:      map[string][]interface{}{testToken: {scopeCreate, scopeDelete}, "revoke-token": {scopeCreate}},
+            wantWhoAmI:  []string{testToken, "revoke-token"},
+            wantErr:     mysqlRevokeToken + ` is missing the "delete" scope`,
+        },
+        // The token checked is the one rejected, not swapped for another.
+        {
+            name:        "revocation token rejected",
+            verify:      true,
+            revokeToken: "revoke-token",
+            scopes:      map[string][]interface{}{testToken: {scopeCreate, scopeDelete}},
+            rejected:    map[string]bool{"revoke-token": true},
+            wantWhoAmI:  []string{testToken, "revoke-token"},
+            wantErr:     "verify token scopes failed: http statusCode: 401",
+        },
+        {name: "WhoAmI fails", verify: true, whoAmIFails: true, wantWhoAmI: []string{testToken}, wantErr: "verify token scopes failed: http statusCode: 500"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(actionWhoAmI) {
+                    return false
+                }
+                if tt.whoAmIFails {
+                    w.WriteHeader(http.StatusInternalServerError)
+                    return true
+                }
+                token, _ := req.Body["token"].(string)
+                if tt.rejected[token] {
+                    w.WriteHeader(http.StatusUnauthorized)
+                    return true
+                }
+                writeJSON(w, map[string]interface{}{"status": 0, "scopes": tt.scopes[token]})
+                return true
+            })
+            setTestEnv(t, backend.URL)
+            t.Setenv(mysqlRevokeToken, tt.revokeToken)
+            db := new()
+            db.logger = hclog.NewNullLogger()
+            defer db.Close()
+            _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{
+                Config:           testConfig(map[string]interface{}{"verify_token_scopes": tt.verify}),
+                VerifyConnection: true,
+            })
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+            } else if err != nil {
+                t.Fatalf("Initialize: %v", err)
+            }
+
+            var asked []string
+            for _, req := range backend.received(actionWhoAmI) {
+                token, _ := req.Body["token"].(string)
+                asked = append(asked, token)
+            }
+            if strings.Join(asked, ",") != strings.Join(tt.wantWhoAmI, ",") {
+                t.Fatalf("WhoAmI asked for %v, want %v", asked, tt.wantWhoAmI)
+            }
+        })
+    }
+}
+
+// TestVerifyRefreshedTokenScopes checks the scopes of a token re-read after a
+// 401 before resending with it.
+func TestVerifyRefreshedTokenScopes(t *testing.T) {
+    tests := []struct {
+        name      string
+        newScopes []interface{}
+        wantErr   string
+    }{
+        {name: "refreshed token scoped", newScopes: []interface{}{scopeCreate, scopeDelete}},
+        {name: "refreshed token without delete", newScopes: []interface{}{scopeCreate}, wantErr: `refreshed token is missing the "delete" scope`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            scopes := map[string][]interface{}{"token-old": {scopeCreate, scopeDelete}, "token-new": tt.newScopes}
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                token, _ := req.Body["token"].(string)
+                switch {
+                case req.action() == string(actionWhoAmI):
+                    writeJSON(w, map[string]interface{}{"status": 0, "scopes": scopes[token]})
+                    return true
+                case token == "token-old":
+                    w.WriteHeader(http.StatusUnauthorized)
+                    return true
+                }
+                return false
+            })
+            kv := &rotatingKV{tokens: []string{"token-old", "token-new"}}
+            db := newTestDB(t, backend.URL, map[string]interface{}{"token_kv_ref": "secret/mysql", "verify_token_scopes": true}, WithKVSource(kv))
+
+            err := deleteUser(db, "V_USER_R", testDeleteStatement)
+            var deletedWith []string
+            for _, req := range backend.received(actionDelUser) {
+                token, _ := req.Body["token"].(string)
+                deletedWith = append(deletedWith, token)
+            }
+            asked := backend.received(actionWhoAmI)
+            if token := asked[len(asked)-1].Body["token"]; token != "token-new" {
+                t.Fatalf("WhoAmI last asked for %v, want the refreshed token", token)
+            }
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("DeleteUser error = %v, want %q", err, tt.wantErr)
+                }
+                if strings.Join(deletedWith, ",") != "token-old" {
+                    t.Fatalf("deletes sent with %v, want only the rejected one", deletedWith)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if strings.Join(deletedWith, ",") != "token-old,token-new" {
+                t.Fatalf("deletes sent with %v, want the rejected and the refreshed token", deletedWith)
+            }
+        })
+    }
+}
@@ -0,0 +1,37 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import "sync"
+
+// keyedSemaphore counts in-flight operations per key so that a limit can be
+// enforced for each key independently.
+type keyedSemaphore struct {
+    mu     sync.Mutex
+    counts map[string]int
+}
+
+// tryAcquire takes a slot for key if fewer than limit are in use. A limit of
+// zero or less means unlimited.
+func (s *keyedSemaphore) tryAcquire(key string, limit int) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.counts == nil {
+        s.counts = make(map[string]int)
+    }
+    if limit > 0 && s.counts[key] >= limit {
+        return false
+    }
+    s.counts[key]++
+    return true
+}
+
+func (s *keyedSemaphore) release(key string) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.counts[key]--
+    if s.counts[key] <= 0 {
+        delete(s.counts, key)
+    }
+}
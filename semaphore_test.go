@@ -0,0 +1,98 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "fmt"
+    "net/http"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// TestMaxConcurrentCreatesPerRole fires cap+1 parallel creates for a role,
+// held at the backend, and checks that exactly one is rejected while another
+// role's create still goes through.
+func TestMaxConcurrentCreatesPerRole(t *testing.T) {
+    for _, limit := range []int{1, 3} {
+        t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, map[string]interface{}{"max_concurrent_creates_per_role": limit})
+
+            var mu sync.Mutex
+            inFlight := make(map[string]int)
+            gate := make(chan struct{})
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.action() != string(actionAddUser) {
+                    return false
+                }
+                role, _ := req.Body["role"].(string)
+                mu.Lock()
+                inFlight[role]++
+                mu.Unlock()
+                <-gate
+                return false
+            })
+            waitInFlight := func(role string, n int) {
+                t.Helper()
+                deadline := time.Now().Add(5 * time.Second)
+                for {
+                    mu.Lock()
+                    got := inFlight[role]
+                    mu.Unlock()
+                    if got == n {
+                        return
+                    }
+                    if time.Now().After(deadline) {
+                        t.Fatalf("%d creates of %s reached the backend, want %d", got, role, n)
+                    }
+                    time.Sleep(time.Millisecond)
+                }
+            }
+
+            errs := make(chan error, limit+2)
+            var wg sync.WaitGroup
+            for i := 0; i < limit+1; i++ {
+                wg.Add(1)
+                go func() {
+                    defer wg.Done()
+                    _, err := newUser(db, "capped", testCreateStatement)
+                    errs <- err
+                }()
+            }
+            select {
+            case err := <-errs:
+                if err == nil || !strings.Contains(err.Error(), "too many concurrent creates") {
+                    close(gate)
+                    t.Fatalf("first create done = %v, want it rejected", err)
+                }
+            case <-time.After(5 * time.Second):
+                close(gate)
+                t.Fatal("no create rejected")
+            }
+            waitInFlight("capped", limit)
+            wg.Add(1)
+            go func() {
+                defer wg.Done()
+                _, err := newUser(db, "other", testCreateStatement)
+                errs <- err
+            }()
+            waitInFlight("other", 1)
+            close(gate)
+            wg.Wait()
+            close(errs)
+            for err := range errs {
+                if err != nil {
+                    t.Errorf("NewUser: %v", err)
+                }
+            }
+
+            // The slots are given back once the creates are done.
+            if _, err := newUser(db, "capped", testCreateStatement); err != nil {
+                t.Fatalf("NewUser after the others are done: %v", err)
+            }
+        })
+    }
+}
@@ -0,0 +1,29 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import "time"
+
+// SlowCall describes a backend call that took longer than
+// slow_call_threshold. It never carries secrets.
+type SlowCall struct {
+    Action   string
+    Duration time.Duration
+    // Username is the user the call was about, or empty for calls such as
+    // listing users.
+    Username string
+}
+
+// reportSlowCall passes the call to the slow call hook when it exceeded
+// slow_call_threshold.
+func (c *mgtvMysqlConnectionProducer) reportSlowCall(action backendAction, body map[string]interface{}, d time.Duration) {
+    if c.slowCallHook == nil || c.SlowCallThreshold <= 0 {
+        return
+    }
+    if d <= time.Duration(c.SlowCallThreshold)*time.Millisecond {
+        return
+    }
+    username, _ := body["username"].(string)
+    c.slowCallHook(SlowCall{Action: string(action), Duration: d, Username: username})
+}
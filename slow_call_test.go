@@ -0,0 +1,87 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "net/http"
+    "reflect"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+)
+
+// TestSlowCallHook has the backend move the fake clock by the call's latency.
+func TestSlowCallHook(t *testing.T) {
+    tests := []struct {
+        name      string
+        threshold int
+        latency   time.Duration
+        wantCall  bool
+    }{
+        {name: "fast", threshold: 100, latency: 50 * time.Millisecond},
+        {name: "at threshold", threshold: 100, latency: 100 * time.Millisecond},
+        {name: "slow", threshold: 100, latency: 150 * time.Millisecond, wantCall: true},
+        {name: "disabled", latency: time.Minute},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            clock := newFakeClock()
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                clock.Advance(tt.latency)
+                return false
+            })
+            var mu sync.Mutex
+            var calls []SlowCall
+            hook := func(call SlowCall) {
+                mu.Lock()
+                defer mu.Unlock()
+                calls = append(calls, call)
+            }
+            db := newTestDB(t, backend.URL, map[string]interface{}{"slow_call_threshold": tt.threshold}, WithClock(clock), WithSlowCallHook(hook))
+            if err := deleteUser(db, "V_USER_R", testDeleteStatement); err != nil {
+                t.Fatal(err)
+            }
+
+            mu.Lock()
+            defer mu.Unlock()
+            var want []SlowCall
+            if tt.wantCall {
+                want = []SlowCall{{Action: string(actionDelUser), Duration: tt.latency, Username: "V_USER_R"}}
+            }
+            if !reflect.DeepEqual(calls, want) {
+                t.Fatalf("slow calls = %+v, want %+v", calls, want)
+            }
+        })
+    }
+}
+
+func TestSlowCallHookWithoutUsername(t *testing.T) {
+    backend := newFakeBackend(t)
+    clock := newFakeClock()
+    backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+        clock.Advance(time.Second)
+        return false
+    })
+    var calls []SlowCall
+    db := newTestDB(t, backend.URL, map[string]interface{}{"slow_call_threshold": 1}, WithClock(clock), WithSlowCallHook(func(call SlowCall) {
+        calls = append(calls, call)
+    }))
+    if _, err := db.ListUsers(context.Background(), statements(testDeleteStatement)); err != nil {
+        t.Fatal(err)
+    }
+    if len(calls) != 1 || calls[0].Action != string(actionListUsers) || len(calls[0].Username) > 0 {
+        t.Fatalf("slow calls = %+v, want one ListUsers without username", calls)
+    }
+}
+
+func TestSlowCallThresholdInvalid(t *testing.T) {
+    backend := newFakeBackend(t)
+    err := initError(t, backend.URL, map[string]interface{}{"slow_call_threshold": -1})
+    if err == nil || !strings.Contains(err.Error(), "invalid slow_call_threshold -1") {
+        t.Fatalf("Initialize error = %v, want invalid slow_call_threshold", err)
+    }
+}
@@ -0,0 +1,33 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "fmt"
+    "sort"
+)
+
+// checkStatementFields fails when the create statement has fields missing from
+// allowed_statement_fields, so operators can't smuggle extra fields into the
+// backend request. Without an allowlist every field is accepted.
+func (c *mgtvMysqlConnectionProducer) checkStatementFields(statement map[string]interface{}) error {
+    if len(c.AllowedStatementFields) == 0 {
+        return nil
+    }
+    allowed := make(map[string]bool, len(c.AllowedStatementFields))
+    for _, field := range c.AllowedStatementFields {
+        allowed[field] = true
+    }
+    var disallowed []string
+    for field := range statement {
+        if !allowed[field] {
+            disallowed = append(disallowed, field)
+        }
+    }
+    if len(disallowed) == 0 {
+        return nil
+    }
+    sort.Strings(disallowed)
+    return fmt.Errorf("create_statement contains fields %q not in allowed_statement_fields", disallowed)
+}
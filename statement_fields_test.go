@@ -0,0 +1,77 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "strings"
+    "testing"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestAllowedStatementFields(t *testing.T) {
+    tests := []struct {
+        name      string
+        allowed   []string
+        statement string
+        wantErr   string
+    }{
+        {name: "unset allows every field", statement: `{"cid":"c1","dbname":"d1","note":"x"}`},
+        {name: "allowed only", allowed: []string{"cid", "dbname", "priv"}, statement: `{"cid":"c1","dbname":"d1","priv":1}`},
+        {name: "subset of allowed", allowed: []string{"cid", "dbname", "priv"}, statement: testCreateStatement},
+        {
+            name:      "disallowed field",
+            allowed:   []string{"cid", "dbname"},
+            statement: `{"cid":"c1","dbname":"d1","note":"x"}`,
+            wantErr:   `create_statement contains fields ["note"] not in allowed_statement_fields`,
+        },
+        {
+            name:      "disallowed fields sorted",
+            allowed:   []string{"cid"},
+            statement: `{"cid":"c1","token":"t","dbname":"d1"}`,
+            wantErr:   `create_statement contains fields ["dbname" "token"] not in allowed_statement_fields`,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{}
+            if tt.allowed != nil {
+                config["allowed_statement_fields"] = tt.allowed
+            }
+            db := newTestDB(t, backend.URL, config)
+            _, err := newUser(db, "role", tt.statement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                if n := len(backend.received(actionAddUser)); n != 0 {
+                    t.Fatalf("AddUser sent %d times, want none", n)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+}
+
+// TestAllowedStatementFieldsReinit drops the allowlist when the mount is
+// reconfigured without one.
+func TestAllowedStatementFieldsReinit(t *testing.T) {
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, map[string]interface{}{"allowed_statement_fields": []string{"cid", "dbname"}})
+    statement := `{"cid":"c1","dbname":"d1","note":"x"}`
+    if _, err := newUser(db, "role", statement); err == nil {
+        t.Fatal("NewUser succeeded with a disallowed field")
+    }
+    if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: testConfig(nil)}); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := newUser(db, "role", statement); err != nil {
+        t.Fatalf("NewUser after re-Init without allowed_statement_fields: %v", err)
+    }
+}
@@ -0,0 +1,68 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestSuccessHeader(t *testing.T) {
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // header is the X-Result the backend answers with, unset when empty.
+        header  string
+        detail  string
+        code    int
+        body    string
+        wantErr string
+    }{
+        {name: "ok", header: "ok"},
+        {name: "ok, case and space", header: " OK "},
+        // Neither the status nor the body decides the outcome.
+        {name: "ok over http status", header: "ok", code: http.StatusInternalServerError},
+        {name: "ok over body status", header: "ok", body: `{"status":1}`},
+        {name: "custom value", config: map[string]interface{}{"success_value": "yes"}, header: "yes"},
+        {name: "custom value, default rejected", config: map[string]interface{}{"success_value": "yes"}, header: "ok", wantErr: `X-Result: "ok"`},
+        {name: "failure", header: "fail", wantErr: `X-Result: "fail"`},
+        {name: "failure detail", header: "fail", detail: "no such user", wantErr: "no such user"},
+        {name: "missing", wantErr: `X-Result: ""`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"success_header": "X-Result", "error_header": "X-Error"}
+            for k, v := range tt.config {
+                config[k] = v
+            }
+            db := newTestDB(t, backend.URL, config)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if len(tt.header) > 0 {
+                    w.Header().Set("X-Result", tt.header)
+                }
+                if len(tt.detail) > 0 {
+                    w.Header().Set("X-Error", tt.detail)
+                }
+                if tt.code != 0 {
+                    w.WriteHeader(tt.code)
+                }
+                w.Write([]byte(tt.body))
+                return true
+            })
+
+            err := deleteUser(db, "V_USER_R", testDeleteStatement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("DeleteUser error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+}
@@ -0,0 +1,77 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "text/template"
+    "time"
+)
+
+// templateData holds the variables available to request_template.
+type templateData struct {
+    Action   string
+    Username string
+    Password string
+    Token    string
+    Priv     interface{}
+    Role     string
+    // Expiry is the credential's expiration in RFC 3339, or empty if none.
+    Expiry string
+    // Statement is the decoded create statement.
+    Statement map[string]interface{}
+}
+
+// renderedBody is a request body rendered from request_template, along with
+// a rendering with secrets redacted for the debug sink.
+type renderedBody struct {
+    wire     []byte
+    redacted []byte
+}
+
+var templateFuncs = template.FuncMap{
+    // json encodes a value as JSON, so strings can be embedded safely.
+    "json": func(v interface{}) (string, error) {
+        b, err := json.Marshal(v)
+        return string(b), err
+    },
+}
+
+// parseRequestTemplate parses request_template and renders it once with
+// placeholder values, so that errors surface at Init rather than on create.
+func parseRequestTemplate(text string) (*template.Template, error) {
+    tmpl, err := template.New("request_template").Funcs(templateFuncs).Parse(text)
+    if err != nil {
+        return nil, fmt.Errorf("invalid request_template: %w", err)
+    }
+    sample := templateData{
+        Action:    string(actionAddUser),
+        Username:  "V_SAMPLE_r",
+        Password:  redactedValue,
+        Token:     redactedValue,
+        Priv:      0,
+        Expiry:    time.Time{}.Format(time.RFC3339),
+        Statement: map[string]interface{}{},
+    }
+    if err := tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+        return nil, fmt.Errorf("invalid request_template: %w", err)
+    }
+    return tmpl, nil
+}
+
+// renderBody renders request_template with data.
+func (c *mgtvMysqlConnectionProducer) renderBody(data templateData) (*renderedBody, error) {
+    var wire, redacted bytes.Buffer
+    if err := c.requestTemplate.Execute(&wire, data); err != nil {
+        return nil, fmt.Errorf("render request_template: %w", err)
+    }
+    data.Password = redactedValue
+    data.Token = redactedValue
+    if err := c.requestTemplate.Execute(&redacted, data); err != nil {
+        return nil, fmt.Errorf("render request_template: %w", err)
+    }
+    return &renderedBody{wire: wire.Bytes(), redacted: redacted.Bytes()}, nil
+}
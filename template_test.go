@@ -0,0 +1,80 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "encoding/json"
+    "io/ioutil"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestRequestTemplate(t *testing.T) {
+    const tmpl = `{"op":{{json .Action}},"user":{{json .Username}},"pass":{{json .Password}},` +
+        `"auth":{{json .Token}},"role":{{json .Role}},"db":{{json (index .Statement "dbname")}}}`
+    backend := newFakeBackend(t)
+    sink := filepath.Join(t.TempDir(), "requests.ndjson")
+    db := newTestDB(t, backend.URL, map[string]interface{}{
+        "request_template":   tmpl,
+        "debug_request_sink": sink,
+    })
+    username, err := newUser(db, "role", testCreateStatement)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    sent := backend.received("")
+    req := sent[len(sent)-1]
+    want := map[string]interface{}{
+        "op":   string(actionAddUser),
+        "user": username,
+        "pass": "Passw0rd-0123456789",
+        "auth": testToken,
+        "role": "role",
+        "db":   "d1",
+    }
+    if !reflect.DeepEqual(req.Body, want) {
+        t.Fatalf("create body = %s, want %v", req.Raw, want)
+    }
+
+    logged, err := ioutil.ReadFile(sink)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var redacted map[string]interface{}
+    if err := json.Unmarshal(logged, &redacted); err != nil {
+        t.Fatalf("debug sink %s: %v", logged, err)
+    }
+    for _, field := range []string{"pass", "auth"} {
+        if redacted[field] != redactedValue {
+            t.Errorf("debug sink %s = %v, want %s", field, redacted[field], redactedValue)
+        }
+    }
+    if redacted["user"] == nil || redacted["db"] != "d1" {
+        t.Errorf("debug sink %s lost the non secret fields", logged)
+    }
+}
+
+func TestRequestTemplateInvalid(t *testing.T) {
+    tests := []struct {
+        name    string
+        tmpl    string
+        wantErr string
+    }{
+        {name: "parse error", tmpl: `{"user":{{.Username}`, wantErr: "invalid request_template"},
+        {name: "unknown field", tmpl: `{"user":{{json .Nope}}}`, wantErr: "invalid request_template"},
+        {name: "unknown func", tmpl: `{"user":{{yaml .Username}}}`, wantErr: "invalid request_template"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            err := initError(t, backend.URL, map[string]interface{}{"request_template": tt.tmpl})
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+            }
+        })
+    }
+}
@@ -0,0 +1,77 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "crypto/sha256"
+    "crypto/subtle"
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "net"
+    "strings"
+)
+
+// parsePin decodes a hex SHA-256 fingerprint, optionally colon separated.
+func parsePin(pin string) ([]byte, error) {
+    decoded, err := hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+    if err != nil || len(decoded) != sha256.Size {
+        return nil, fmt.Errorf("invalid tls_pin_sha256 %q: must be a hex SHA-256 fingerprint", pin)
+    }
+    return decoded, nil
+}
+
+// tlsConfig returns the client TLS configuration, or nil when neither
+// tls_pin_sha256 nor tls_require_san is set. The checks run after the usual
+// chain verification and fail the handshake on mismatch.
+func (c *mgtvMysqlConnectionProducer) tlsConfig() *tls.Config {
+    if len(c.TLSPinSHA256) == 0 && len(c.TLSRequireSAN) == 0 {
+        return nil
+    }
+    pin, _ := parsePin(c.TLSPinSHA256)
+    requireSAN := c.TLSRequireSAN
+    return &tls.Config{
+        VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+            if len(rawCerts) == 0 {
+                return errors.New("backend presented no certificate")
+            }
+            if pin != nil {
+                sum := sha256.Sum256(rawCerts[0])
+                if subtle.ConstantTimeCompare(sum[:], pin) != 1 {
+                    return fmt.Errorf("backend certificate fingerprint %s does not match tls_pin_sha256", hex.EncodeToString(sum[:]))
+                }
+            }
+            if len(requireSAN) > 0 {
+                cert, err := x509.ParseCertificate(rawCerts[0])
+                if err != nil {
+                    return err
+                }
+                if !hasSAN(cert, requireSAN) {
+                    return fmt.Errorf("backend certificate does not carry the SAN %q", requireSAN)
+                }
+            }
+            return nil
+        },
+    }
+}
+
+// hasSAN reports whether cert lists san as a DNS name or IP address.
+func hasSAN(cert *x509.Certificate, san string) bool {
+    if ip := net.ParseIP(san); ip != nil {
+        for _, certIP := range cert.IPAddresses {
+            if certIP.Equal(ip) {
+                return true
+            }
+        }
+        return false
+    }
+    for _, name := range cert.DNSNames {
+        if strings.EqualFold(name, san) {
+            return true
+        }
+    }
+    return false
+}
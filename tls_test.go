@@ -0,0 +1,138 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/hex"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestRequireTLS(t *testing.T) {
+    backend := newFakeBackend(t)
+    tests := []struct {
+        name string
+        // connectionURL is backend.URL unless set.
+        connectionURL string
+        config        map[string]interface{}
+        wantErr       bool
+    }{
+        {name: "default", config: map[string]interface{}{}, wantErr: true},
+        {name: "on", config: map[string]interface{}{"require_tls": true}, wantErr: true},
+        {name: "off", config: map[string]interface{}{"require_tls": false}},
+        {
+            name:          "backend_urls",
+            connectionURL: "https://backend.invalid",
+            config:        map[string]interface{}{"backend_urls": []interface{}{map[string]interface{}{"url": backend.URL, "weight": 1}}},
+            wantErr:       true,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            connectionURL := tt.connectionURL
+            if len(connectionURL) == 0 {
+                connectionURL = backend.URL
+            }
+            setTestEnv(t, connectionURL)
+            db := new()
+            db.logger = hclog.NewNullLogger()
+            defer db.Close()
+            // Not testConfig, which turns require_tls off.
+            _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: tt.config})
+            switch {
+            case tt.wantErr && (err == nil || !strings.Contains(err.Error(), "set require_tls=false")):
+                t.Fatalf("Initialize error = %v, want one naming require_tls=false", err)
+            case !tt.wantErr && err != nil:
+                t.Fatalf("Initialize: %v", err)
+            }
+            if err == nil {
+                if _, err := newUser(db, "role", testCreateStatement); err != nil {
+                    t.Fatalf("NewUser: %v", err)
+                }
+            }
+        })
+    }
+}
+
+func TestTLSPinAndSAN(t *testing.T) {
+    srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        writeJSON(w, map[string]interface{}{"status": 0})
+    }))
+    t.Cleanup(srv.Close)
+    sum := sha256.Sum256(srv.Certificate().Raw)
+    pin := hex.EncodeToString(sum[:])
+    var colons []string
+    for _, b := range sum {
+        colons = append(colons, fmt.Sprintf("%02X", b))
+    }
+    other := sha256.Sum256([]byte("another certificate"))
+
+    tests := []struct {
+        name    string
+        config  map[string]interface{}
+        wantErr string
+    }{
+        {name: "matching pin", config: map[string]interface{}{"tls_pin_sha256": pin}},
+        {name: "matching pin, colon separated", config: map[string]interface{}{"tls_pin_sha256": strings.Join(colons, ":")}},
+        {name: "mismatching pin", config: map[string]interface{}{"tls_pin_sha256": hex.EncodeToString(other[:])}, wantErr: "does not match tls_pin_sha256"},
+        {name: "DNS SAN", config: map[string]interface{}{"tls_require_san": "example.com"}},
+        {name: "IP SAN", config: map[string]interface{}{"tls_require_san": "127.0.0.1"}},
+        {name: "missing SAN", config: map[string]interface{}{"tls_require_san": "backend.example.org"}, wantErr: `does not carry the SAN "backend.example.org"`},
+        {name: "pin and SAN", config: map[string]interface{}{"tls_pin_sha256": pin, "tls_require_san": "example.com"}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL, tt.config)
+            // The test server's certificate isn't among the system roots, so
+            // it is trusted here for the chain verification the checks follow.
+            config := db.tlsConfig()
+            config.RootCAs = x509.NewCertPool()
+            config.RootCAs.AddCert(srv.Certificate())
+            client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+            defer client.CloseIdleConnections()
+
+            resp, err := client.Get(srv.URL)
+            if err == nil {
+                resp.Body.Close()
+            }
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("handshake error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+        })
+    }
+}
+
+func TestTLSConfigUnset(t *testing.T) {
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, nil)
+    if config := db.tlsConfig(); config != nil {
+        t.Fatalf("tlsConfig() = %v without tls_pin_sha256 or tls_require_san, want nil", config)
+    }
+}
+
+func TestTLSPinInvalid(t *testing.T) {
+    backend := newFakeBackend(t)
+    for _, pin := range []string{"not hex", "abcd"} {
+        err := initError(t, backend.URL, map[string]interface{}{"tls_pin_sha256": pin})
+        if err == nil || !strings.Contains(err.Error(), "invalid tls_pin_sha256") {
+            t.Errorf("Initialize with tls_pin_sha256 %q error = %v, want invalid tls_pin_sha256", pin, err)
+        }
+    }
+}
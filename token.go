@@ -0,0 +1,354 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "os"
+    "strings"
+    "time"
+)
+
+// defaultKVTokenKey is the key read from the secret at token_kv_ref when the
+// reference doesn't name one.
+const defaultKVTokenKey = "token"
+
+// defaultTokenCacheTTL is how long, in seconds, a token read from a file or KV
+// source is reused when token_cache_ttl isn't set.
+const defaultTokenCacheTTL = 30
+
+// tokenSnapshotAttempts is how often the token files are read again when one
+// of them changes while they are being read.
+const tokenSnapshotAttempts = 5
+
+// KVSource reads secrets from a Vault compatible key/value store.
+type KVSource interface {
+    Read(ctx context.Context, path string) (map[string]interface{}, error)
+}
+
+// savedConfig returns a copy of config without the token, so that Vault doesn't
+// persist or echo it.
+func savedConfig(config map[string]interface{}) map[string]interface{} {
+    saved := copyBody(config)
+    delete(saved, "token")
+    return saved
+}
+
+// retainedConfig returns the copy of config kept on the producer as RawConfig:
+// the saved config, with passwords embedded in backend urls redacted as well.
+// Nothing reads secrets back from it, so it shouldn't hold any.
+func retainedConfig(config map[string]interface{}) map[string]interface{} {
+    retained := savedConfig(config)
+    if raw, ok := retained["connection_url"].(string); ok {
+        retained["connection_url"] = redactURL(raw)
+    }
+    if backends, ok := retained["backend_urls"].([]interface{}); ok {
+        redacted := make([]interface{}, len(backends))
+        for i, be := range backends {
+            redacted[i] = be
+            if fields, ok := be.(map[string]interface{}); ok {
+                fields = copyBody(fields)
+                if raw, ok := fields["url"].(string); ok {
+                    fields["url"] = redactURL(raw)
+                }
+                redacted[i] = fields
+            }
+        }
+        retained["backend_urls"] = redacted
+    }
+    return retained
+}
+
+// redactURL replaces the password in raw, if any.
+func redactURL(raw string) string {
+    u, err := url.Parse(raw)
+    if err != nil || u.User == nil {
+        return raw
+    }
+    return u.Redacted()
+}
+
+// parseKVRef splits a token_kv_ref of the form path#key.
+func parseKVRef(ref string) (path, key string, err error) {
+    path, key = ref, defaultKVTokenKey
+    if i := strings.LastIndex(ref, "#"); i >= 0 {
+        path, key = ref[:i], ref[i+1:]
+    }
+    if len(path) == 0 || len(key) == 0 {
+        return "", "", fmt.Errorf("invalid token_kv_ref %q: must be path or path#key", ref)
+    }
+    return path, key, nil
+}
+
+// token returns the backend token with surrounding whitespace removed. Tokens
+// injected via env, files or stored secrets often carry a trailing newline,
+// which the backend rejects.
+func (c *mgtvMysqlConnectionProducer) token(ctx context.Context) (string, error) {
+    raw, source, err := c.readToken(ctx)
+    if err != nil {
+        return "", err
+    }
+    token := strings.TrimSpace(raw)
+    if token != raw {
+        c.tokenTrimOnce.Do(func() {
+            c.logger.Warn("mysql token contains surrounding whitespace, trimming it", "source", source)
+        })
+    }
+    if len(token) == 0 {
+        return "", errors.New("not exist mysql token")
+    }
+    return token, nil
+}
+
+// readToken reads the untrimmed token from the token config field,
+// token_file or token_kv_ref when configured, or from the environment
+// otherwise. source describes where it came from. Tokens read from a file or
+// KV are reused for token_cache_ttl.
+func (c *mgtvMysqlConnectionProducer) readToken(ctx context.Context) (token, source string, err error) {
+    if len(c.Token) > 0 {
+        return c.Token, "config", nil
+    }
+    if len(c.TokenFile) == 0 && len(c.TokenKVRef) == 0 {
+        return os.Getenv(mysqlToken), mysqlToken, nil
+    }
+    tokens, err := c.readTokens(ctx)
+    if err != nil {
+        return "", "", err
+    }
+    return tokens.value, tokens.source, nil
+}
+
+// readTokens returns the tokens read from token_file or token_kv_ref and from
+// revoke_token_file, reading them again once token_cache_ttl has passed. The
+// tokens are read and cached together, so that when their sources rotate
+// together a request never pairs a new token with an old one.
+func (c *mgtvMysqlConnectionProducer) readTokens(ctx context.Context) (cachedToken, error) {
+    c.tokenCacheLock.Lock()
+    defer c.tokenCacheLock.Unlock()
+    if c.tokenCache.read && c.clock.Now().Before(c.tokenCache.expires) {
+        return c.tokenCache, nil
+    }
+
+    var tokens cachedToken
+    var paths []string
+    if len(c.TokenFile) > 0 {
+        paths = append(paths, c.TokenFile)
+    }
+    if len(c.RevokeTokenFile) > 0 {
+        paths = append(paths, c.RevokeTokenFile)
+    }
+    contents, err := readFileSnapshot(paths, ioutil.ReadFile)
+    if err != nil {
+        return cachedToken{}, fmt.Errorf("read mysql token: %w", err)
+    }
+    if len(c.TokenFile) > 0 {
+        tokens.value, tokens.source = contents[0], c.TokenFile
+    }
+    if len(c.RevokeTokenFile) > 0 {
+        tokens.revoke = contents[len(contents)-1]
+    }
+    if len(c.TokenKVRef) > 0 {
+        path, key, err := parseKVRef(c.TokenKVRef)
+        if err != nil {
+            return cachedToken{}, err
+        }
+        data, err := c.kvSource.Read(ctx, path)
+        if err != nil {
+            return cachedToken{}, fmt.Errorf("read mysql token from %q: %w", path, err)
+        }
+        value, ok := data[key].(string)
+        if !ok {
+            return cachedToken{}, fmt.Errorf("mysql token %q not found at %q", key, path)
+        }
+        tokens.value, tokens.source = value, c.TokenKVRef
+    }
+    tokens.read = true
+    tokens.expires = c.clock.Now().Add(c.TokenCacheTTL * time.Second)
+    c.tokenCache = tokens
+    return tokens, nil
+}
+
+// readFileSnapshot reads every one of paths with read, and reads them all
+// again until two reads in a row return the same contents with none of the
+// files replaced or modified in between, so that files rotated together are
+// never returned half old and half new. The contents are compared as well as
+// the file info, since a rewrite keeping the size can land within the mtime
+// granularity.
+func readFileSnapshot(paths []string, read func(path string) ([]byte, error)) ([]string, error) {
+    if len(paths) == 0 {
+        return nil, nil
+    }
+    previous, err := readFiles(paths, read)
+    if err != nil {
+        return nil, err
+    }
+    for attempt := 0; attempt < tokenSnapshotAttempts; attempt++ {
+        before, err := statFiles(paths)
+        if err != nil {
+            return nil, err
+        }
+        contents, err := readFiles(paths, read)
+        if err != nil {
+            return nil, err
+        }
+        after, err := statFiles(paths)
+        if err != nil {
+            return nil, err
+        }
+        if sameFiles(before, after) && sameContents(previous, contents) {
+            return contents, nil
+        }
+        previous = contents
+    }
+    return nil, fmt.Errorf("%s kept changing while being read", strings.Join(paths, ", "))
+}
+
+func readFiles(paths []string, read func(path string) ([]byte, error)) ([]string, error) {
+    contents := make([]string, len(paths))
+    for i, path := range paths {
+        data, err := read(path)
+        if err != nil {
+            return nil, err
+        }
+        contents[i] = string(data)
+    }
+    return contents, nil
+}
+
+func sameContents(before, after []string) bool {
+    for i := range before {
+        if before[i] != after[i] {
+            return false
+        }
+    }
+    return true
+}
+
+func statFiles(paths []string) ([]os.FileInfo, error) {
+    infos := make([]os.FileInfo, len(paths))
+    for i, path := range paths {
+        info, err := os.Stat(path)
+        if err != nil {
+            return nil, err
+        }
+        infos[i] = info
+    }
+    return infos, nil
+}
+
+func sameFiles(before, after []os.FileInfo) bool {
+    for i := range before {
+        if !os.SameFile(before[i], after[i]) || !before[i].ModTime().Equal(after[i].ModTime()) || before[i].Size() != after[i].Size() {
+            return false
+        }
+    }
+    return true
+}
+
+// revocationToken returns the token revocations are made with: the narrower
+// scoped one read from revoke_token_file or the mysql_revoke_token environment
+// variable when set, or the shared token otherwise.
+func (c *mgtvMysqlConnectionProducer) revocationToken(ctx context.Context) (string, error) {
+    if len(c.RevokeTokenFile) > 0 {
+        tokens, err := c.readTokens(ctx)
+        if err != nil {
+            return "", err
+        }
+        token := strings.TrimSpace(tokens.revoke)
+        if len(token) == 0 {
+            return "", fmt.Errorf("revoke_token_file %q is blank", c.RevokeTokenFile)
+        }
+        return token, nil
+    }
+    raw := os.Getenv(mysqlRevokeToken)
+    if len(raw) == 0 {
+        return c.token(ctx)
+    }
+    token := strings.TrimSpace(raw)
+    if len(token) == 0 {
+        return "", fmt.Errorf("%s is blank", mysqlRevokeToken)
+    }
+    return token, nil
+}
+
+// invalidateToken drops the cached token, so that the next request reads it
+// from its source again.
+func (c *mgtvMysqlConnectionProducer) invalidateToken() {
+    c.tokenCacheLock.Lock()
+    defer c.tokenCacheLock.Unlock()
+    c.tokenCache = cachedToken{}
+}
+
+type callerTokenKey struct{}
+
+// withCallerToken marks the calls made with ctx as carrying a token the caller
+// chose, which a rejection must not swap for another.
+func withCallerToken(ctx context.Context) context.Context {
+    return context.WithValue(ctx, callerTokenKey{}, true)
+}
+
+func hasCallerToken(ctx context.Context) bool {
+    caller, _ := ctx.Value(callerTokenKey{}).(bool)
+    return caller
+}
+
+// retryUnauthorized handles a 401 response, or a redirect to re-authenticate,
+// by re-reading the token, which may have been rotated, and resending body
+// with it, under the call's stamp. With verify_token_scopes, the new token's
+// scopes are checked before it is used. When the new token is rejected as
+// well, the refresh is retried up to token_refresh_retries times with a
+// backoff, as the token source may be mid-rotation. The last response is
+// returned. A token the caller chose is never swapped: its rejection is
+// returned as is.
+func (c *mgtvMysqlConnectionProducer) retryUnauthorized(ctx context.Context, action backendAction, body map[string]interface{}, stamp replayStamp, response *http.Response) (*http.Response, error) {
+    if hasCallerToken(ctx) {
+        return response, nil
+    }
+    minDelay := time.Duration(c.RetryMinDelay) * time.Millisecond
+    maxDelay := time.Duration(c.RetryMaxDelay) * time.Millisecond
+    body = copyBody(body)
+    for attempt := 0; c.needsReauth(response) && attempt <= c.TokenRefreshRetries; attempt++ {
+        response.Body.Close()
+        if attempt > 0 {
+            select {
+            case <-ctx.Done():
+                return nil, ctx.Err()
+            case <-c.clock.After(backoff(attempt-1, minDelay, maxDelay)):
+            }
+        }
+        c.logger.Debug("backend rejected the token, re-reading it", "action", action, "attempt", attempt+1)
+        pluginMetrics.retry()
+        c.invalidateToken()
+        token, err := c.actionToken(ctx, action)
+        if err != nil {
+            return nil, err
+        }
+        if c.VerifyTokenScopes {
+            if err := c.requireScopes(ctx, "refreshed token", token, actionScope(action)); err != nil {
+                return nil, err
+            }
+        }
+        body["token"] = token
+        response, err = c.post(ctx, action, body, nil, stamp)
+        if err != nil {
+            return nil, err
+        }
+    }
+    return response, nil
+}
+
+// cachedToken holds the tokens read from file or KV sources: value, read from
+// source, and revoke, read from revoke_token_file.
+type cachedToken struct {
+    value   string
+    source  string
+    revoke  string
+    read    bool
+    expires time.Time
+}
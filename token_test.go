@@ -0,0 +1,589 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/hashicorp/go-hclog"
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestTokenWhitespace(t *testing.T) {
+    tests := []struct {
+        name string
+        // source is where the token comes from: env, file or config.
+        source  string
+        raw     string
+        wantErr string
+    }{
+        {name: "env trailing newline", source: "env", raw: testToken + "\n"},
+        {name: "file trailing newline", source: "file", raw: testToken + "\r\n"},
+        {name: "config surrounding spaces", source: "config", raw: "  " + testToken + "\t"},
+        {name: "clean", source: "env", raw: testToken},
+        {name: "only whitespace", source: "env", raw: " \n", wantErr: "not exist mysql token"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            var config map[string]interface{}
+            switch tt.source {
+            case "file":
+                path := filepath.Join(t.TempDir(), "token")
+                if err := ioutil.WriteFile(path, []byte(tt.raw), 0o600); err != nil {
+                    t.Fatal(err)
+                }
+                config = map[string]interface{}{"token_file": path}
+            case "config":
+                config = map[string]interface{}{"token": tt.raw}
+            }
+            db := newTestDB(t, backend.URL, config)
+            if tt.source == "env" {
+                t.Setenv(mysqlToken, tt.raw)
+            }
+            var logs bytes.Buffer
+            db.Lock()
+            db.logger = hclog.New(&hclog.LoggerOptions{Output: &logs})
+            db.Unlock()
+
+            for i := 0; i < 2; i++ {
+                _, err := newUser(db, "role", testCreateStatement)
+                if len(tt.wantErr) > 0 {
+                    if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                        t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                    }
+                    return
+                }
+                if err != nil {
+                    t.Fatal(err)
+                }
+            }
+            for _, req := range backend.received(actionAddUser) {
+                if req.Body["token"] != testToken {
+                    t.Fatalf("token sent as %q, want %q", req.Body["token"], testToken)
+                }
+            }
+            wantWarnings := 1
+            if tt.raw == testToken {
+                wantWarnings = 0
+            }
+            if n := strings.Count(logs.String(), "surrounding whitespace"); n != wantWarnings {
+                t.Fatalf("warned %d times, want %d:\n%s", n, wantWarnings, logs.String())
+            }
+        })
+    }
+}
+
+// TestReadFileSnapshot rotates the files behind the reads' back, keeping their
+// size and mtime, as a rewrite within the mtime granularity does.
+func TestReadFileSnapshot(t *testing.T) {
+    tests := []struct {
+        name string
+        // rotated returns what reading path the n-th time, from 0, returns
+        // instead of the file, if anything.
+        rotated func(path string, n int) (string, bool)
+        want    []string
+        wantErr string
+    }{
+        {
+            name:    "stable",
+            rotated: func(string, int) (string, bool) { return "", false },
+            want:    []string{"token-a1", "revoke-a1"},
+        },
+        {
+            // The first read of the token catches a rewrite that is undone
+            // by the next one.
+            name: "changed during the first read",
+            rotated: func(path string, n int) (string, bool) {
+                if filepath.Base(path) == "token" && n == 0 {
+                    return "token-b2", true
+                }
+                return "", false
+            },
+            want: []string{"token-a1", "revoke-a1"},
+        },
+        {
+            name: "always changing",
+            rotated: func(path string, n int) (string, bool) {
+                return strings.Repeat("x", n%2+1), true
+            },
+            wantErr: "kept changing",
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            paths := []string{filepath.Join(dir, "token"), filepath.Join(dir, "revoke")}
+            for path, content := range map[string]string{paths[0]: "token-a1", paths[1]: "revoke-a1"} {
+                if err := ioutil.WriteFile(path, []byte(content), 0o600); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            reads := make(map[string]int)
+            read := func(path string) ([]byte, error) {
+                n := reads[path]
+                reads[path]++
+                if content, ok := tt.rotated(path, n); ok {
+                    return []byte(content), nil
+                }
+                return ioutil.ReadFile(path)
+            }
+
+            got, err := readFileSnapshot(paths, read)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("readFileSnapshot error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+                t.Fatalf("readFileSnapshot = %q, want %q", got, tt.want)
+            }
+        })
+    }
+}
+
+// fakeKV is a KVSource serving fixed secrets.
+type fakeKV struct {
+    mu      sync.Mutex
+    secrets map[string]map[string]interface{}
+    reads   int
+}
+
+func (kv *fakeKV) Read(_ context.Context, path string) (map[string]interface{}, error) {
+    kv.mu.Lock()
+    defer kv.mu.Unlock()
+    kv.reads++
+    data, ok := kv.secrets[path]
+    if !ok {
+        return nil, errors.New("no secret at " + path)
+    }
+    return data, nil
+}
+
+func TestTokenKVRef(t *testing.T) {
+    secrets := map[string]map[string]interface{}{
+        "secret/mysql": {"token": "kv-token", "api": "kv-api-token"},
+    }
+    tests := []struct {
+        name      string
+        ref       string
+        noSource  bool
+        config    map[string]interface{}
+        wantToken string
+        wantErr   string
+        // initErr is set when the config itself is rejected.
+        initErr bool
+    }{
+        {name: "default key", ref: "secret/mysql", wantToken: "kv-token"},
+        {name: "named key", ref: "secret/mysql#api", wantToken: "kv-api-token"},
+        {name: "missing key", ref: "secret/mysql#other", wantErr: `mysql token "other" not found at "secret/mysql"`},
+        {name: "missing path", ref: "secret/other", wantErr: `read mysql token from "secret/other": no secret at secret/other`},
+        {name: "no source", ref: "secret/mysql", noSource: true, wantErr: "no KV source is configured", initErr: true},
+        {name: "empty key", ref: "secret/mysql#", wantErr: "invalid token_kv_ref", initErr: true},
+        {name: "with token", ref: "secret/mysql", config: map[string]interface{}{"token": "config-token"}, wantErr: "only one of token, token_file and token_kv_ref", initErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"token_kv_ref": tt.ref}
+            for k, v := range tt.config {
+                config[k] = v
+            }
+            kv := &fakeKV{secrets: secrets}
+            var opts []Option
+            if !tt.noSource {
+                opts = append(opts, WithKVSource(kv))
+            }
+            if tt.initErr {
+                err := initError(t, backend.URL, config, opts...)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config, opts...)
+            for i := 0; i < 2; i++ {
+                _, err := newUser(db, "role", testCreateStatement)
+                if len(tt.wantErr) > 0 {
+                    if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                        t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                    }
+                    return
+                }
+                if err != nil {
+                    t.Fatal(err)
+                }
+            }
+            for _, req := range backend.received(actionAddUser) {
+                if req.Body["token"] != tt.wantToken {
+                    t.Fatalf("token sent as %q, want %q", req.Body["token"], tt.wantToken)
+                }
+            }
+            if kv.reads != 1 {
+                t.Fatalf("KV read %d times, want once within token_cache_ttl", kv.reads)
+            }
+        })
+    }
+}
+
+func TestTokenCacheTTL(t *testing.T) {
+    tests := []struct {
+        name string
+        // ttl is token_cache_ttl, unset when negative.
+        ttl     int
+        wantTTL time.Duration
+    }{
+        {name: "default", ttl: -1, wantTTL: defaultTokenCacheTTL * time.Second},
+        {name: "configured", ttl: 5, wantTTL: 5 * time.Second},
+        {name: "disabled", ttl: 0},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            path := filepath.Join(t.TempDir(), "token")
+            write := func(token string) {
+                t.Helper()
+                if err := ioutil.WriteFile(path, []byte(token), 0o600); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            write("token-1")
+            config := map[string]interface{}{"token_file": path}
+            if tt.ttl >= 0 {
+                config["token_cache_ttl"] = tt.ttl
+            }
+            clock := newFakeClock()
+            db := newTestDB(t, backend.URL, config, WithClock(clock))
+            sentToken := func() string {
+                t.Helper()
+                if err := deleteUser(db, "V_USER_R", testDeleteStatement); err != nil {
+                    t.Fatal(err)
+                }
+                sent := backend.received(actionDelUser)
+                return sent[len(sent)-1].Body["token"].(string)
+            }
+
+            if got := sentToken(); got != "token-1" {
+                t.Fatalf("token sent as %q, want token-1", got)
+            }
+            write("token-2")
+            if tt.wantTTL > 0 {
+                clock.Advance(tt.wantTTL - time.Second)
+                if got := sentToken(); got != "token-1" {
+                    t.Fatalf("token sent as %q within token_cache_ttl, want the cached token-1", got)
+                }
+                clock.Advance(time.Second)
+            }
+            if got := sentToken(); got != "token-2" {
+                t.Fatalf("token sent as %q once token_cache_ttl passed, want token-2", got)
+            }
+        })
+    }
+}
+
+func TestRevocationToken(t *testing.T) {
+    tests := []struct {
+        name string
+        // revokeEnv is mysql_revoke_token, and revokeFile the content of
+        // revoke_token_file when set.
+        revokeEnv  string
+        revokeFile string
+        wantRevoke string
+        wantErr    string
+    }{
+        {name: "shared fallback", wantRevoke: testToken},
+        {name: "environment", revokeEnv: "revoke-token\n", wantRevoke: "revoke-token"},
+        {name: "file", revokeFile: "file-revoke-token\n", wantRevoke: "file-revoke-token"},
+        {name: "file over environment", revokeEnv: "revoke-token", revokeFile: "file-revoke-token", wantRevoke: "file-revoke-token"},
+        {name: "blank environment", revokeEnv: " \n", wantErr: mysqlRevokeToken + " is blank"},
+        {name: "blank file", revokeFile: "\n", wantErr: "is blank"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{}
+            if len(tt.revokeFile) > 0 {
+                path := filepath.Join(t.TempDir(), "revoke-token")
+                if err := ioutil.WriteFile(path, []byte(tt.revokeFile), 0o600); err != nil {
+                    t.Fatal(err)
+                }
+                config["revoke_token_file"] = path
+            }
+            db := newTestDB(t, backend.URL, config)
+            t.Setenv(mysqlRevokeToken, tt.revokeEnv)
+
+            username, err := newUser(db, "role", testCreateStatement)
+            if err != nil {
+                t.Fatal(err)
+            }
+            err = deleteUser(db, username, testDeleteStatement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("DeleteUser error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if _, err := db.DeleteUsers(context.Background(), []string{username}, statements(testDeleteStatement)); err != nil {
+                t.Fatal(err)
+            }
+
+            want := map[backendAction]string{actionAddUser: testToken, actionDelUser: tt.wantRevoke, actionBatchDelUser: tt.wantRevoke}
+            for action, token := range want {
+                if got := backend.received(action)[0].Body["token"]; got != token {
+                    t.Errorf("%s sent token %v, want %s", action, got, token)
+                }
+            }
+        })
+    }
+}
+
+func TestConfigToken(t *testing.T) {
+    tests := []struct {
+        name    string
+        config  map[string]interface{}
+        env     string
+        want    string
+        wantErr string
+    }{
+        {name: "config over environment", config: map[string]interface{}{"token": "config-token"}, env: testToken, want: "config-token"},
+        {name: "config without environment", config: map[string]interface{}{"token": "config-token"}, want: "config-token"},
+        {name: "environment", config: map[string]interface{}{}, env: testToken, want: testToken},
+        {
+            name:    "with token_file",
+            config:  map[string]interface{}{"token": "config-token", "token_file": "/nonexistent"},
+            wantErr: "only one of token, token_file and token_kv_ref may be set",
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            setTestEnv(t, backend.URL)
+            t.Setenv(mysqlToken, tt.env)
+            db := new()
+            db.logger = hclog.NewNullLogger()
+            defer db.Close()
+            config := testConfig(tt.config)
+            config["strict_redaction"] = true
+            resp, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: config})
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if _, ok := resp.Config["token"]; ok {
+                t.Fatalf("saved config %v carries the token", resp.Config)
+            }
+            if _, ok := tt.config["token"]; ok && config["token"] != tt.config["token"] {
+                t.Fatalf("Initialize changed the given config to %v", config)
+            }
+
+            if _, ok := tt.config["token"]; ok && len(db.secretValues()[tt.want]) == 0 {
+                t.Fatalf("secretValues %v don't cover the token", db.secretValues())
+            }
+
+            if _, err := newUser(db, "role", testCreateStatement); err != nil {
+                t.Fatal(err)
+            }
+            if got := backend.received(actionAddUser)[0].Body["token"]; got != tt.want {
+                t.Fatalf("token sent as %v, want %s", got, tt.want)
+            }
+
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                writeJSON(w, map[string]interface{}{"status": 1, "error": "bad token " + tt.want})
+                return true
+            })
+            _, err = newUser(db, "role", testCreateStatement)
+            if err == nil {
+                t.Fatal("NewUser succeeded")
+            }
+            if strings.Contains(err.Error(), tt.want) {
+                t.Fatalf("NewUser error %q carries the token", err)
+            }
+        })
+    }
+}
+
+// rotatingKV is a KVSource returning the next of tokens on every read, and
+// the last one once they ran out.
+type rotatingKV struct {
+    mu     sync.Mutex
+    tokens []string
+    reads  int
+}
+
+func (kv *rotatingKV) Read(context.Context, string) (map[string]interface{}, error) {
+    kv.mu.Lock()
+    defer kv.mu.Unlock()
+    token := kv.tokens[len(kv.tokens)-1]
+    if kv.reads < len(kv.tokens) {
+        token = kv.tokens[kv.reads]
+    }
+    kv.reads++
+    return map[string]interface{}{"token": token}, nil
+}
+
+func TestTokenRefreshRetries(t *testing.T) {
+    tests := []struct {
+        name    string
+        retries int
+        // tokens are read in turn, only "token-good" being accepted.
+        tokens   []string
+        wantSent int
+        wantErr  bool
+        wantInit string
+    }{
+        {name: "first re-read accepted", tokens: []string{"token-old", "token-good"}, wantSent: 2},
+        {name: "no retries, re-read rejected", tokens: []string{"token-old", "token-old", "token-good"}, wantSent: 2, wantErr: true},
+        {name: "two re-reads", retries: 1, tokens: []string{"token-old", "token-old", "token-good"}, wantSent: 3},
+        {name: "retries exhausted", retries: 1, tokens: []string{"token-old", "token-old", "token-old", "token-good"}, wantSent: 3, wantErr: true},
+        {name: "negative", retries: -1, wantInit: "invalid token_refresh_retries -1"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if req.Body["token"] == "token-good" {
+                    return false
+                }
+                w.WriteHeader(http.StatusUnauthorized)
+                return true
+            })
+            config := map[string]interface{}{
+                "token_kv_ref":          "secret/mysql",
+                "token_refresh_retries": tt.retries,
+                "retry_min_delay":       1,
+                "retry_max_delay":       1,
+            }
+            kv := &rotatingKV{tokens: tt.tokens}
+            if len(tt.wantInit) > 0 {
+                err := initError(t, backend.URL, config, WithKVSource(kv))
+                if err == nil || !strings.Contains(err.Error(), tt.wantInit) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantInit)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config, WithKVSource(kv))
+
+            err := deleteUser(db, "V_USER_R", testDeleteStatement)
+            switch {
+            case tt.wantErr && !errors.Is(err, ErrUnauthorized):
+                t.Fatalf("DeleteUser error = %v, want ErrUnauthorized", err)
+            case !tt.wantErr && err != nil:
+                t.Fatal(err)
+            }
+            if sent := len(backend.received(actionDelUser)); sent != tt.wantSent {
+                t.Fatalf("%d deletes sent, want %d", sent, tt.wantSent)
+            }
+        })
+    }
+}
+
+// TestTokenRefreshCancelled gives up on a refresh backoff once ctx is done.
+func TestTokenRefreshCancelled(t *testing.T) {
+    backend := newFakeBackend(t)
+    backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+        w.WriteHeader(http.StatusUnauthorized)
+        return true
+    })
+    clock := newFakeClock()
+    db := newTestDB(t, backend.URL, map[string]interface{}{
+        "token_refresh_retries": 5,
+        "retry_min_delay":       60000,
+        "retry_max_delay":       60000,
+    }, WithClock(clock))
+
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan error, 1)
+    go func() {
+        _, err := db.DeleteUser(ctx, dbplugin.DeleteUserRequest{Username: "V_USER_R", Statements: statements(testDeleteStatement)})
+        done <- err
+    }()
+    clock.waitForTimers(t, 1)
+    cancel()
+    select {
+    case err := <-done:
+        if !errors.Is(err, context.Canceled) {
+            t.Fatalf("DeleteUser error = %v, want context.Canceled", err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("DeleteUser didn't return once ctx was cancelled")
+    }
+    if sent := len(backend.received(actionDelUser)); sent != 2 {
+        t.Fatalf("%d deletes sent, want 2", sent)
+    }
+}
+
+func TestRetainedConfig(t *testing.T) {
+    backend := newFakeBackend(t)
+    withPassword := strings.Replace(backend.URL, "http://", "http://admin:hunter2@", 1)
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // want are entries RawConfig must hold as is.
+        want map[string]interface{}
+    }{
+        {name: "token", config: map[string]interface{}{"token": "config-token"}, want: map[string]interface{}{"require_tls": false}},
+        {
+            name:   "connection_url",
+            config: map[string]interface{}{"connection_url": withPassword},
+            want:   map[string]interface{}{"connection_url": strings.Replace(withPassword, "hunter2", "xxxxx", 1)},
+        },
+        {name: "connection_url without password", config: map[string]interface{}{"connection_url": backend.URL}, want: map[string]interface{}{"connection_url": backend.URL}},
+        {
+            name: "backend_urls",
+            config: map[string]interface{}{"backend_urls": []interface{}{
+                map[string]interface{}{"url": withPassword, "weight": 1},
+                map[string]interface{}{"url": backend.URL, "weight": 2},
+            }},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            before := fmt.Sprint(tt.config)
+            db := newTestDB(t, backend.URL, tt.config)
+            retained := fmt.Sprint(db.RawConfig)
+            for _, secret := range []string{"config-token", "hunter2"} {
+                if strings.Contains(retained, secret) {
+                    t.Errorf("RawConfig %s carries %q", retained, secret)
+                }
+            }
+            for k, v := range tt.want {
+                if db.RawConfig[k] != v {
+                    t.Errorf("RawConfig %s = %v, want %v", k, db.RawConfig[k], v)
+                }
+            }
+            if backends, ok := tt.config["backend_urls"].([]interface{}); ok {
+                kept, _ := db.RawConfig["backend_urls"].([]interface{})
+                if len(kept) != len(backends) || !strings.Contains(retained, backend.URL) || !strings.Contains(retained, "weight:2") {
+                    t.Errorf("RawConfig backend_urls = %v, want them all kept, passwords aside", kept)
+                }
+            }
+            // The config handed in is left alone.
+            if after := fmt.Sprint(tt.config); after != before {
+                t.Errorf("config changed from %s to %s", before, after)
+            }
+        })
+    }
+}
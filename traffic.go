@@ -0,0 +1,118 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "encoding/json"
+    "strings"
+    "sync"
+    "time"
+)
+
+// defaultTrafficBufferSize applies when traffic_buffer_size isn't set.
+const defaultTrafficBufferSize = 8
+
+// TrafficEntry is a redacted backend call kept for post-mortem inspection.
+type TrafficEntry struct {
+    Time   time.Time
+    Action string
+    // Request and Response are the bodies with sensitive fields redacted.
+    Request  string
+    Response string
+    // HTTPStatus is zero when no response was received.
+    HTTPStatus int
+    Err        string
+}
+
+// trafficBuffer is a ring buffer holding the most recent backend calls.
+type trafficBuffer struct {
+    mu      sync.Mutex
+    entries []TrafficEntry
+    next    int
+    full    bool
+}
+
+// resize empties the buffer and makes it hold the last size entries.
+func (t *trafficBuffer) resize(size int) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    t.entries = make([]TrafficEntry, size)
+    t.next = 0
+    t.full = false
+}
+
+func (t *trafficBuffer) add(entry TrafficEntry) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if len(t.entries) == 0 {
+        return
+    }
+    t.entries[t.next] = entry
+    t.next = (t.next + 1) % len(t.entries)
+    if t.next == 0 {
+        t.full = true
+    }
+}
+
+// snapshot returns the buffered entries, oldest first.
+func (t *trafficBuffer) snapshot() []TrafficEntry {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if !t.full {
+        return append([]TrafficEntry(nil), t.entries[:t.next]...)
+    }
+    return append(append([]TrafficEntry(nil), t.entries[t.next:]...), t.entries[:t.next]...)
+}
+
+// RecentTraffic returns the last traffic_buffer_size backend calls, oldest
+// first, with tokens and passwords redacted, so that recent traffic can be
+// inspected after a failure without debug logging having been on.
+func (m *MgtvMysql) RecentTraffic() []TrafficEntry {
+    return m.traffic.snapshot()
+}
+
+// recordTraffic adds a call for action to the traffic buffer. Sensitive
+// fields are redacted, and known tokens and the password of body are scrubbed
+// wherever they appear, regardless of strict_redaction, as the buffer is read
+// outside of the sanitizer middleware. It is called by invoke, with the lock
+// held.
+func (c *mgtvMysqlConnectionProducer) recordTraffic(action backendAction, body map[string]interface{}, rendered *renderedBody, httpStatus int, responseBody []byte, err error) {
+    if c.TrafficBufferSize == 0 {
+        return
+    }
+    password, _ := body["password"].(string)
+    var pairs []string
+    for _, secret := range append(c.knownTokens(), password) {
+        if len(secret) > 0 {
+            pairs = append(pairs, secret, redactedValue)
+        }
+    }
+    scrub := strings.NewReplacer(pairs...)
+
+    entry := TrafficEntry{
+        Time:       c.clock.Now(),
+        Action:     string(action),
+        HTTPStatus: httpStatus,
+    }
+    if rendered != nil {
+        entry.Request = string(rendered.redacted)
+    } else if request, err := json.Marshal(c.redactBody(c.wireBody(body))); err == nil {
+        entry.Request = string(request)
+    }
+    if len(responseBody) > 0 {
+        entry.Response = redactedValue
+        result := make(map[string]interface{})
+        if json.Unmarshal(responseBody, &result) == nil {
+            if response, err := json.Marshal(c.redactBody(result)); err == nil {
+                entry.Response = string(response)
+            }
+        }
+    }
+    entry.Request = scrub.Replace(entry.Request)
+    entry.Response = scrub.Replace(entry.Response)
+    if err != nil {
+        entry.Err = scrub.Replace(err.Error())
+    }
+    c.traffic.add(entry)
+}
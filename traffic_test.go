@@ -0,0 +1,128 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "fmt"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestRecentTraffic(t *testing.T) {
+    tests := []struct {
+        name string
+        // size is traffic_buffer_size, left unset when negative.
+        size  int
+        calls int
+        // wantUsers are the numbers of the users whose deletes are kept.
+        wantUsers []int
+    }{
+        {name: "default size", size: -1, calls: 3, wantUsers: []int{1, 2, 3}},
+        {name: "default size evicts", size: -1, calls: defaultTrafficBufferSize + 2, wantUsers: []int{3, 4, 5, 6, 7, 8, 9, 10}},
+        {name: "exactly full", size: 3, calls: 3, wantUsers: []int{1, 2, 3}},
+        {name: "evicts oldest", size: 3, calls: 5, wantUsers: []int{3, 4, 5}},
+        {name: "wraps around twice", size: 2, calls: 5, wantUsers: []int{4, 5}},
+        {name: "single entry", size: 1, calls: 4, wantUsers: []int{4}},
+        {name: "disabled", size: 0, calls: 3},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{}
+            if tt.size >= 0 {
+                config["traffic_buffer_size"] = tt.size
+            }
+            db := newTestDB(t, backend.URL, config)
+            for i := 1; i <= tt.calls; i++ {
+                if err := deleteUser(db, fmt.Sprintf("V_USER%d_R", i), testDeleteStatement); err != nil {
+                    t.Fatal(err)
+                }
+            }
+
+            entries := db.RecentTraffic()
+            if len(entries) != len(tt.wantUsers) {
+                t.Fatalf("%d entries kept, want %d", len(entries), len(tt.wantUsers))
+            }
+            for i, entry := range entries {
+                want := fmt.Sprintf(`"username":"V_USER%d_R"`, tt.wantUsers[i])
+                if entry.Action != string(actionDelUser) || !strings.Contains(entry.Request, want) {
+                    t.Errorf("entry %d is %s %s, want the delete of V_USER%d_R", i, entry.Action, entry.Request, tt.wantUsers[i])
+                }
+            }
+        })
+    }
+}
+
+func TestRecentTrafficEntries(t *testing.T) {
+    tests := []struct {
+        name string
+        // httpStatus is what the backend answers with, or the user store when
+        // zero.
+        httpStatus     int
+        wantHTTPStatus int
+        wantErr        string
+    }{
+        {name: "success", wantHTTPStatus: http.StatusOK},
+        {name: "http failure", httpStatus: http.StatusInternalServerError, wantHTTPStatus: http.StatusInternalServerError, wantErr: "http statusCode: 500"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                if tt.httpStatus == 0 {
+                    return false
+                }
+                w.WriteHeader(tt.httpStatus)
+                return true
+            })
+            db := newTestDB(t, backend.URL, nil)
+            newUser(db, "role", testCreateStatement)
+
+            entries := db.RecentTraffic()
+            if len(entries) == 0 {
+                t.Fatal("no traffic kept")
+            }
+            entry := entries[0]
+            if entry.Action != string(actionAddUser) || entry.HTTPStatus != tt.wantHTTPStatus {
+                t.Errorf("entry is %s answered %d, want %s answered %d", entry.Action, entry.HTTPStatus, actionAddUser, tt.wantHTTPStatus)
+            }
+            switch {
+            case len(tt.wantErr) == 0 && len(entry.Err) > 0:
+                t.Errorf("entry error %q, want none", entry.Err)
+            case !strings.Contains(entry.Err, tt.wantErr):
+                t.Errorf("entry error %q, want %q", entry.Err, tt.wantErr)
+            }
+            if entry.Time.IsZero() {
+                t.Error("entry time not set")
+            }
+            for _, secret := range []string{testToken, "Passw0rd-0123456789", mysqlNativePassword("Passw0rd-0123456789")} {
+                if strings.Contains(entry.Request+entry.Response+entry.Err, secret) {
+                    t.Errorf("entry %+v carries %q", entry, secret)
+                }
+            }
+        })
+    }
+}
+
+func TestRecentTrafficUnreachable(t *testing.T) {
+    backend := newFakeBackend(t)
+    db := newTestDB(t, backend.URL, nil)
+    backend.Close()
+    if err := deleteUser(db, "V_USER_R", testDeleteStatement); err == nil {
+        t.Fatal("DeleteUser succeeded against a closed backend")
+    }
+    entries := db.RecentTraffic()
+    if len(entries) != 1 || entries[0].HTTPStatus != 0 || len(entries[0].Err) == 0 || len(entries[0].Response) != 0 {
+        t.Fatalf("traffic = %+v, want one entry without a response", entries)
+    }
+}
+
+func TestTrafficBufferSizeInvalid(t *testing.T) {
+    backend := newFakeBackend(t)
+    err := initError(t, backend.URL, map[string]interface{}{"traffic_buffer_size": -1})
+    if err == nil || !strings.Contains(err.Error(), "invalid traffic_buffer_size -1") {
+        t.Fatalf("Initialize error = %v, want an invalid traffic_buffer_size", err)
+    }
+}
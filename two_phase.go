@@ -0,0 +1,52 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "fmt"
+)
+
+// finishTwoPhase completes a two_phase_create of username once its
+// PrepareUser call returned prepareErr: the prepared user is committed with
+// CommitUser, and aborted with AbortUser when the commit fails, or when the
+// prepare failed ambiguously and may have gone through. statement holds the
+// create statement fields sent along with both. The commit result is returned.
+func (c *mgtvMysqlConnectionProducer) finishTwoPhase(ctx context.Context, username string, statement map[string]interface{}, prepareErr error) (map[string]interface{}, error) {
+    if prepareErr != nil {
+        if isAmbiguous(prepareErr) {
+            c.abortUser(ctx, username, statement)
+        }
+        return nil, fmt.Errorf("prepare user failed: %w", prepareErr)
+    }
+    body, err := c.buildRequest(ctx, actionCommitUser, statement, map[string]interface{}{"username": username})
+    if err == nil {
+        var result map[string]interface{}
+        result, err = c.invoke(ctx, actionCommitUser, body)
+        if err == nil {
+            return result, nil
+        }
+    }
+    commitErr := fmt.Errorf("commit user failed: %w", err)
+    if abortErr := c.abortUser(ctx, username, statement); abortErr != nil {
+        return nil, fmt.Errorf("%w; %v", commitErr, abortErr)
+    }
+    return nil, commitErr
+}
+
+// abortUser discards the prepared user username. It runs on a context of its
+// own, as ctx may have timed out.
+func (c *mgtvMysqlConnectionProducer) abortUser(ctx context.Context, username string, statement map[string]interface{}) error {
+    ctx, cancel := c.followUpContext(ctx)
+    defer cancel()
+    body, err := c.buildRequest(ctx, actionAbortUser, statement, map[string]interface{}{"username": username})
+    if err == nil {
+        _, err = c.invoke(ctx, actionAbortUser, body)
+    }
+    if err != nil {
+        c.logger.Warn("abort of prepared user failed, it may be left behind", "username", c.logName(username), "error", c.logError(err, username))
+        return fmt.Errorf("abort user failed: %w", err)
+    }
+    return nil
+}
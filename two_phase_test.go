@@ -0,0 +1,107 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestTwoPhaseCreate(t *testing.T) {
+    tests := []struct {
+        name string
+        // fail lists the actions the backend fails, with a failed status or,
+        // for "truncate", by cutting the response short.
+        fail     map[backendAction]string
+        want    []backendAction
+        wantErr string
+    }{
+        {name: "committed", want: []backendAction{actionPrepareUser, actionCommitUser}},
+        {
+            name:    "commit failed",
+            fail:    map[backendAction]string{actionCommitUser: "status"},
+            want:    []backendAction{actionPrepareUser, actionCommitUser, actionAbortUser},
+            wantErr: "commit user failed",
+        },
+        {
+            name:    "commit and abort failed",
+            fail:    map[backendAction]string{actionCommitUser: "status", actionAbortUser: "status"},
+            want:    []backendAction{actionPrepareUser, actionCommitUser, actionAbortUser},
+            wantErr: "abort user failed",
+        },
+        {
+            name:    "prepare failed",
+            fail:    map[backendAction]string{actionPrepareUser: "status"},
+            want:    []backendAction{actionPrepareUser},
+            wantErr: "prepare user failed",
+        },
+        // The prepare may have gone through.
+        {
+            name:    "prepare ambiguous",
+            fail:    map[backendAction]string{actionPrepareUser: "truncate"},
+            want:    []backendAction{actionPrepareUser, actionAbortUser},
+            wantErr: "prepare user failed",
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+                switch tt.fail[backendAction(req.action())] {
+                case "status":
+                    writeJSON(w, map[string]interface{}{"status": 1, "error": "rejected"})
+                    return true
+                case "truncate":
+                    backend.result(req)
+                    truncateResponse(t, w)
+                    return true
+                }
+                return false
+            })
+            db := newTestDB(t, backend.URL, map[string]interface{}{"two_phase_create": true})
+            username, err := newUser(db, "role", testCreateStatement)
+
+            var got []backendAction
+            var sentNames []string
+            for _, req := range backend.received("") {
+                action := backendAction(req.action())
+                if action != actionPrepareUser && action != actionCommitUser && action != actionAbortUser {
+                    continue
+                }
+                got = append(got, action)
+                name, _ := req.Body["username"].(string)
+                sentNames = append(sentNames, name)
+                if req.Body["cid"] != "c1" {
+                    t.Errorf("%s sent without the statement fields: %v", action, req.Body)
+                }
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Fatalf("sent %v, want %v", got, tt.want)
+            }
+            for _, name := range sentNames {
+                if name != sentNames[0] || len(name) == 0 {
+                    t.Fatalf("sent usernames %v, want the same one throughout", sentNames)
+                }
+            }
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                // Only a committed user is handed out.
+                if len(username) > 0 {
+                    t.Fatalf("NewUser returned %q along with its error", username)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if username != sentNames[0] || !backend.has(username) {
+                t.Fatalf("NewUser returned %q, want the committed %q", username, sentNames[0])
+            }
+        })
+    }
+}
@@ -0,0 +1,89 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "net"
+    "net/url"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+// unixScheme is the connection_url scheme of backends listening on a unix
+// domain socket, such as unix:///run/backend.sock.
+const unixScheme = "unix"
+
+// socketHostSuffix ends the synthetic hosts socket backends are requested at.
+// Each socket gets its own host so that pooled connections aren't shared
+// between sockets; the Host header sent is socketHostHeader.
+const (
+    socketHostSuffix = ".unix.localhost"
+    socketHostHeader = "localhost"
+)
+
+// socketHost returns the synthetic host requests for the socket at path go to.
+func socketHost(path string) string {
+    sum := sha256.Sum256([]byte(path))
+    return hex.EncodeToString(sum[:8]) + socketHostSuffix
+}
+
+func isSocketHost(host string) bool {
+    return strings.HasSuffix(host, socketHostSuffix)
+}
+
+// validateSocketURL checks that the socket path of the unix url u is absolute
+// and, when it already exists, that it is a socket.
+func validateSocketURL(u *url.URL) error {
+    path := u.Path
+    if len(u.Host) > 0 || !filepath.IsAbs(path) {
+        return fmt.Errorf("invalid unix socket url %q: the socket path must be absolute, as in unix:///run/backend.sock", u.String())
+    }
+    if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket == 0 {
+        return fmt.Errorf("invalid unix socket path %q: not a socket", path)
+    }
+    return nil
+}
+
+// parseBackendURL parses a backend url, turning a unix socket url into the
+// http url of its synthetic host.
+func parseBackendURL(base string) (*url.URL, error) {
+    u, err := url.Parse(base)
+    if err != nil || u.Scheme != unixScheme {
+        return u, err
+    }
+    return &url.URL{Scheme: "http", Host: socketHost(u.Path), RawQuery: u.RawQuery}, nil
+}
+
+// socketDial dials the unix socket behind the synthetic hosts of sockets, by
+// host, and leaves every other address to next.
+func socketDial(next dialFunc, sockets map[string]string) dialFunc {
+    return func(ctx context.Context, network, addr string) (net.Conn, error) {
+        host, _, err := net.SplitHostPort(addr)
+        if err != nil {
+            return next(ctx, network, addr)
+        }
+        if path, ok := sockets[host]; ok {
+            var d net.Dialer
+            return d.DialContext(ctx, "unix", path)
+        }
+        return next(ctx, network, addr)
+    }
+}
+
+// socketPaths maps the synthetic host of every unix socket backend to its
+// path.
+func (c *mgtvMysqlConnectionProducer) socketPaths() map[string]string {
+    sockets := make(map[string]string)
+    for _, base := range c.backendURLs() {
+        if u, err := url.Parse(base); err == nil && u.Scheme == unixScheme {
+            sockets[socketHost(u.Path)] = u.Path
+        }
+    }
+    return sockets
+}
@@ -0,0 +1,104 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "io/ioutil"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// newSocketBackend returns a fakeBackend listening on a unix socket, and the
+// socket's path.
+func newSocketBackend(t *testing.T) (*fakeBackend, string) {
+    t.Helper()
+    // Socket paths are limited to about a hundred bytes, which t.TempDir can
+    // exceed.
+    dir, err := ioutil.TempDir("", "mgmysql")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { os.RemoveAll(dir) })
+    path := filepath.Join(dir, "backend.sock")
+    listener, err := net.Listen("unix", path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    b := &fakeBackend{users: make(map[string]map[string]interface{})}
+    b.Server = httptest.NewUnstartedServer(http.HandlerFunc(b.serve))
+    b.Listener.Close()
+    b.Listener = listener
+    b.Start()
+    t.Cleanup(b.Close)
+    return b, path
+}
+
+func TestUnixSocket(t *testing.T) {
+    backend, path := newSocketBackend(t)
+    db := newTestDB(t, "unix://"+path, nil)
+
+    username, err := newUser(db, "role", testCreateStatement)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := deleteUser(db, username, testDeleteStatement); err != nil {
+        t.Fatal(err)
+    }
+    requests := backend.received("")
+    if len(requests) != 2 {
+        t.Fatalf("%d requests over the socket, want 2", len(requests))
+    }
+    for _, req := range requests {
+        if req.Path != "/" || req.Host != socketHostHeader {
+            t.Errorf("%s sent to %s%s, want %s/", req.action(), req.Host, req.Path, socketHostHeader)
+        }
+    }
+    if len(backend.usernames()) != 0 {
+        t.Errorf("backend still holds %v", backend.usernames())
+    }
+}
+
+func TestUnixSocketHealthCheck(t *testing.T) {
+    backend, path := newSocketBackend(t)
+    if err := verifyError(t, "unix://"+path, map[string]interface{}{"health_path": "/ping"}); err != nil {
+        t.Fatal(err)
+    }
+    var checks []recordedRequest
+    for _, req := range backend.received("") {
+        if req.Method == http.MethodGet {
+            checks = append(checks, req)
+        }
+    }
+    if len(checks) != 1 || checks[0].Path != "/ping" {
+        t.Fatalf("health checked with %+v, want a GET /ping", checks)
+    }
+}
+
+func TestUnixSocketInvalid(t *testing.T) {
+    file := filepath.Join(t.TempDir(), "regular")
+    if err := ioutil.WriteFile(file, nil, 0o600); err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        name    string
+        url     string
+        wantErr string
+    }{
+        {name: "relative path", url: "unix://run/backend.sock", wantErr: "the socket path must be absolute"},
+        {name: "not a socket", url: "unix://" + file, wantErr: "not a socket"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := initError(t, tt.url, nil)
+            if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+            }
+        })
+    }
+}
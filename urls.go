@@ -0,0 +1,18 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/url"
+    "strings"
+)
+
+// joinPath appends elem to the path of u with exactly one slash between them,
+// whether or not the base path ends with a slash and elem starts with one.
+// rawElem is elem in its escaped form.
+func joinPath(u *url.URL, elem, rawElem string) {
+    rawBase := strings.TrimRight(u.EscapedPath(), "/")
+    u.Path = strings.TrimRight(u.Path, "/") + "/" + strings.TrimLeft(elem, "/")
+    u.RawPath = rawBase + "/" + strings.TrimLeft(rawElem, "/")
+}
@@ -0,0 +1,113 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "net/url"
+    "strings"
+    "testing"
+)
+
+func TestDbnamePlacement(t *testing.T) {
+    tests := []struct {
+        name      string
+        placement string
+        statement string
+        wantPath  string
+        wantErr   string
+    }{
+        {name: "body", placement: "body", statement: `{"cid":"c1","dbname":"d1"}`, wantPath: "/"},
+        {name: "path", placement: "path", statement: `{"cid":"c1","dbname":"d1"}`, wantPath: "/db/d1/users"},
+        {name: "special characters", placement: "path", statement: `{"cid":"c1","dbname":"a b/c%d?e"}`, wantPath: "/db/a%20b%2Fc%25d%3Fe/users"},
+        {name: "no dbname", placement: "path", statement: `{"cid":"c1"}`, wantErr: `dbname is required when dbname_placement is "path"`},
+        {name: "invalid", placement: "query", wantErr: `invalid dbname_placement "query"`},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"dbname_placement": tt.placement}
+            if len(tt.statement) == 0 {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+            _, err := newUser(db, "role", tt.statement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            req := backend.received(actionAddUser)[0]
+            if req.EscapedPath != tt.wantPath {
+                t.Errorf("create sent to %q, want %q", req.EscapedPath, tt.wantPath)
+            }
+            if req.Body["dbname"] == nil {
+                t.Errorf("dbname missing from the body %v", req.Body)
+            }
+        })
+    }
+}
+
+func TestJoinPath(t *testing.T) {
+    tests := []struct {
+        name     string
+        base     string
+        elem     string
+        want     string
+        wantPath string
+    }{
+        {name: "no slashes", base: "http://h/api", elem: "db/d1/users", want: "http://h/api/db/d1/users"},
+        {name: "trailing slash", base: "http://h/api/", elem: "db/d1/users", want: "http://h/api/db/d1/users"},
+        {name: "leading slash", base: "http://h/api", elem: "/db/d1/users", want: "http://h/api/db/d1/users"},
+        {name: "both slashes", base: "http://h/api/", elem: "/db/d1/users", want: "http://h/api/db/d1/users"},
+        {name: "doubled slashes", base: "http://h/api//", elem: "//db/d1/users", want: "http://h/api/db/d1/users"},
+        {name: "empty base path", base: "http://h", elem: "/healthz", want: "http://h/healthz"},
+        {name: "root base path", base: "http://h/", elem: "healthz", want: "http://h/healthz"},
+        {name: "query kept", base: "http://h/api/?action=x", elem: "/status", want: "http://h/api/status?action=x"},
+        {name: "escaped", base: "http://h/a%20b/", elem: "/db/c%2Fd/users", want: "http://h/a%20b/db/c%2Fd/users", wantPath: "/a b/db/c/d/users"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            u, err := url.Parse(tt.base)
+            if err != nil {
+                t.Fatal(err)
+            }
+            elem, err := url.PathUnescape(tt.elem)
+            if err != nil {
+                t.Fatal(err)
+            }
+            joinPath(u, elem, tt.elem)
+            if got := u.String(); got != tt.want {
+                t.Errorf("joined url %q, want %q", got, tt.want)
+            }
+            if len(tt.wantPath) > 0 && u.Path != tt.wantPath {
+                t.Errorf("joined path %q, want %q", u.Path, tt.wantPath)
+            }
+        })
+    }
+}
+
+// TestBasePathSlashes sends the dbname path placement under a connection url
+// base path with every slash combination.
+func TestBasePathSlashes(t *testing.T) {
+    for _, base := range []string{"/api", "/api/"} {
+        t.Run(base, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            db := newTestDB(t, backend.URL+base, map[string]interface{}{"dbname_placement": "path"})
+            if _, err := newUser(db, "role", testCreateStatement); err != nil {
+                t.Fatal(err)
+            }
+            if got := backend.received(actionAddUser)[0].EscapedPath; got != "/api/db/d1/users" {
+                t.Fatalf("create sent to %q, want /api/db/d1/users", got)
+            }
+        })
+    }
+}
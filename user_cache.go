@@ -0,0 +1,99 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "encoding/json"
+    "sync"
+    "time"
+)
+
+// userCache holds recent GetUser results by username and the statement fields
+// of the lookup, so that repeated lookups in a short window don't each reach
+// the backend. Every invalidation bumps its generation, and a result read from
+// the backend is only stored if no invalidation happened since the lookup
+// started.
+type userCache struct {
+    mu         sync.Mutex
+    entries    map[string]map[string]cachedUser
+    generation uint64
+}
+
+type cachedUser struct {
+    result  map[string]interface{}
+    exists  bool
+    expires time.Time
+}
+
+// userCacheKey returns the key of a lookup with the statement fields base,
+// which encoding/json writes with sorted keys, sent where the connection
+// overrides of ctx point. ok is false when base can't be encoded, and such
+// lookups aren't cached.
+func userCacheKey(ctx context.Context, base map[string]interface{}) (key string, ok bool) {
+    overrides := overridesFrom(ctx)
+    encoded, err := json.Marshal(struct {
+        Fields map[string]interface{}
+        URL    string
+        Path   string
+    }{base, overrides.url, overrides.path})
+    if err != nil {
+        return "", false
+    }
+    return string(encoded), true
+}
+
+// current returns the generation a lookup starting now passes to put.
+func (u *userCache) current() uint64 {
+    u.mu.Lock()
+    defer u.mu.Unlock()
+    return u.generation
+}
+
+func (u *userCache) get(username, key string, now time.Time) (cachedUser, bool) {
+    u.mu.Lock()
+    defer u.mu.Unlock()
+    entry, ok := u.entries[username][key]
+    if !ok || !now.Before(entry.expires) {
+        return cachedUser{}, false
+    }
+    return entry, true
+}
+
+// put stores entry unless the cache was invalidated after generation.
+func (u *userCache) put(username, key string, generation uint64, entry cachedUser) {
+    u.mu.Lock()
+    defer u.mu.Unlock()
+    if generation != u.generation {
+        return
+    }
+    if u.entries == nil {
+        u.entries = make(map[string]map[string]cachedUser)
+    }
+    if u.entries[username] == nil {
+        u.entries[username] = make(map[string]cachedUser)
+    }
+    u.entries[username][key] = entry
+}
+
+func (u *userCache) forget(username string) {
+    u.mu.Lock()
+    defer u.mu.Unlock()
+    u.generation++
+    delete(u.entries, username)
+}
+
+// reset drops every entry, as Init does for results of the previous config.
+func (u *userCache) reset() {
+    u.mu.Lock()
+    defer u.mu.Unlock()
+    u.generation++
+    u.entries = nil
+}
+
+// invalidateUser drops any cached GetUser result for username. It is called
+// whenever an operation may have changed the user.
+func (c *mgtvMysqlConnectionProducer) invalidateUser(username string) {
+    c.users.forget(username)
+}
@@ -0,0 +1,205 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "context"
+    "net/http"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/hashicorp/vault/sdk/database/dbplugin/v5"
+)
+
+func TestGetUserCache(t *testing.T) {
+    tests := []struct {
+        name string
+        ttl  int
+        // between runs between the two lookups.
+        between      func(t *testing.T, db *MgtvMysql, clock *fakeClock)
+        wantGetUsers int
+        // wantExists is whether the second lookup finds the user.
+        wantExists bool
+    }{
+        {name: "hit", ttl: 60, wantGetUsers: 1, wantExists: true},
+        {name: "disabled", wantGetUsers: 2, wantExists: true},
+        {
+            name: "expired",
+            ttl:  60,
+            between: func(t *testing.T, db *MgtvMysql, clock *fakeClock) {
+                clock.Advance(time.Minute)
+            },
+            wantGetUsers: 2,
+            wantExists:   true,
+        },
+        {
+            name: "not yet expired",
+            ttl:  60,
+            between: func(t *testing.T, db *MgtvMysql, clock *fakeClock) {
+                clock.Advance(59 * time.Second)
+            },
+            wantGetUsers: 1,
+            wantExists:   true,
+        },
+        {
+            name: "invalidated by DeleteUser",
+            ttl:  60,
+            between: func(t *testing.T, db *MgtvMysql, clock *fakeClock) {
+                if err := deleteUser(db, "V_USER_R", testDeleteStatement); err != nil {
+                    t.Fatal(err)
+                }
+            },
+            wantGetUsers: 2,
+        },
+        {
+            name: "invalidated by DeleteUsers",
+            ttl:  60,
+            between: func(t *testing.T, db *MgtvMysql, clock *fakeClock) {
+                if _, err := db.DeleteUsers(context.Background(), []string{"V_USER_R"}, statements(testDeleteStatement)); err != nil {
+                    t.Fatal(err)
+                }
+            },
+            wantGetUsers: 2,
+        },
+        {
+            name: "invalidated by UpdateUser",
+            ttl:  60,
+            between: func(t *testing.T, db *MgtvMysql, clock *fakeClock) {
+                _, err := db.UpdateUser(context.Background(), dbplugin.UpdateUserRequest{
+                    Username: "V_USER_R",
+                    Password: &dbplugin.ChangePassword{NewPassword: "Passw0rd-0123456789", Statements: statements(testDeleteStatement)},
+                })
+                if err != nil {
+                    t.Fatal(err)
+                }
+            },
+            wantGetUsers: 2,
+            wantExists:   true,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            backend.users["V_USER_R"] = map[string]interface{}{"username": "V_USER_R"}
+            clock := newFakeClock()
+            db := newTestDB(t, backend.URL, map[string]interface{}{"get_user_cache_ttl": tt.ttl}, WithClock(clock))
+            base := map[string]interface{}{"cid": "c1"}
+
+            if _, exists, err := db.getUser(context.Background(), "V_USER_R", base); err != nil || !exists {
+                t.Fatalf("getUser = %v, %v, want the user", exists, err)
+            }
+            if tt.between != nil {
+                tt.between(t, db, clock)
+            }
+            _, exists, err := db.getUser(context.Background(), "V_USER_R", base)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if exists != tt.wantExists {
+                t.Errorf("second getUser found the user: %v, want %v", exists, tt.wantExists)
+            }
+            if got := len(backend.received(actionGetUser)); got != tt.wantGetUsers {
+                t.Fatalf("%d GetUser calls, want %d", got, tt.wantGetUsers)
+            }
+        })
+    }
+}
+
+func TestGetUserCacheTTLInvalid(t *testing.T) {
+    backend := newFakeBackend(t)
+    err := initError(t, backend.URL, map[string]interface{}{"get_user_cache_ttl": -1})
+    if err == nil || !strings.Contains(err.Error(), "invalid get_user_cache_ttl -1") {
+        t.Fatalf("Initialize error = %v, want an invalid get_user_cache_ttl", err)
+    }
+}
+
+// TestGetUserCacheKey checks that lookups sent with other statement fields
+// don't share a cached result.
+func TestGetUserCacheKey(t *testing.T) {
+    backend := newFakeBackend(t)
+    backend.users["V_USER_R"] = map[string]interface{}{"username": "V_USER_R"}
+    db := newTestDB(t, backend.URL, map[string]interface{}{"get_user_cache_ttl": 60})
+
+    lookups := []struct {
+        base         map[string]interface{}
+        wantGetUsers int
+    }{
+        {base: map[string]interface{}{"cid": "c1"}, wantGetUsers: 1},
+        {base: map[string]interface{}{"cid": "c2"}, wantGetUsers: 2},
+        {base: map[string]interface{}{"cid": "c1", "scope": "read"}, wantGetUsers: 3},
+        {base: map[string]interface{}{"cid": "c1"}, wantGetUsers: 3},
+        {base: map[string]interface{}{"scope": "read", "cid": "c1"}, wantGetUsers: 3},
+    }
+    for i, lookup := range lookups {
+        if _, exists, err := db.getUser(context.Background(), "V_USER_R", lookup.base); err != nil || !exists {
+            t.Fatalf("lookup %d: getUser = %v, %v, want the user", i, exists, err)
+        }
+        if got := len(backend.received(actionGetUser)); got != lookup.wantGetUsers {
+            t.Fatalf("lookup %d with %v: %d GetUser calls, want %d", i, lookup.base, got, lookup.wantGetUsers)
+        }
+    }
+}
+
+// TestGetUserCacheReinitialized checks that results of the previous config
+// aren't served once the plugin is initialized against another backend.
+func TestGetUserCacheReinitialized(t *testing.T) {
+    first := newFakeBackend(t)
+    first.users["V_USER_R"] = map[string]interface{}{"username": "V_USER_R"}
+    second := newFakeBackend(t)
+    config := map[string]interface{}{"get_user_cache_ttl": 60}
+    db := newTestDB(t, first.URL, config)
+    base := map[string]interface{}{"cid": "c1"}
+
+    if _, exists, err := db.getUser(context.Background(), "V_USER_R", base); err != nil || !exists {
+        t.Fatalf("getUser = %v, %v, want the user", exists, err)
+    }
+    setTestEnv(t, second.URL)
+    if _, err := db.Initialize(context.Background(), dbplugin.InitializeRequest{Config: testConfig(config)}); err != nil {
+        t.Fatalf("Initialize: %v", err)
+    }
+    _, exists, err := db.getUser(context.Background(), "V_USER_R", base)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if exists {
+        t.Error("getUser found the user of the previous backend")
+    }
+    if got := len(second.received(actionGetUser)); got != 1 {
+        t.Fatalf("%d GetUser calls to the new backend, want 1", got)
+    }
+}
+
+// TestGetUserCacheInvalidatedDuringLookup has the user invalidated while its
+// lookup is in flight, as a concurrent DeleteUser would, and checks that the
+// result read before the invalidation isn't cached.
+func TestGetUserCacheInvalidatedDuringLookup(t *testing.T) {
+    backend := newFakeBackend(t)
+    backend.users["V_USER_R"] = map[string]interface{}{"username": "V_USER_R"}
+    db := newTestDB(t, backend.URL, map[string]interface{}{"get_user_cache_ttl": 60})
+    invalidated := false
+    backend.setRespond(func(w http.ResponseWriter, req recordedRequest) bool {
+        if req.action() == string(actionGetUser) && !invalidated {
+            invalidated = true
+            db.invalidateUser("V_USER_R")
+        }
+        return false
+    })
+    base := map[string]interface{}{"cid": "c1"}
+
+    for i := 0; i < 2; i++ {
+        if _, exists, err := db.getUser(context.Background(), "V_USER_R", base); err != nil || !exists {
+            t.Fatalf("lookup %d: getUser = %v, %v, want the user", i, exists, err)
+        }
+    }
+    if got := len(backend.received(actionGetUser)); got != 2 {
+        t.Fatalf("%d GetUser calls, want 2", got)
+    }
+    if _, exists, err := db.getUser(context.Background(), "V_USER_R", base); err != nil || !exists {
+        t.Fatalf("getUser = %v, %v, want the user", exists, err)
+    }
+    if got := len(backend.received(actionGetUser)); got != 2 {
+        t.Fatalf("%d GetUser calls after the result was cached, want 2", got)
+    }
+}
@@ -0,0 +1,147 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+
+    "github.com/hashicorp/vault/sdk/database/helper/credsutil"
+)
+
+// maxUsernameAttempts caps the usernames generated for a single NewUser,
+// across every constraint that may reject one, so that unsatisfiable
+// constraints fail cleanly instead of looping.
+const maxUsernameAttempts = 10
+
+// usernameAttempts counts the usernames generated for one NewUser against
+// maxUsernameAttempts.
+type usernameAttempts struct {
+    used int
+}
+
+// take uses up an attempt, reporting false once none are left.
+func (a *usernameAttempts) take() bool {
+    if a.used >= maxUsernameAttempts {
+        return false
+    }
+    a.used++
+    return true
+}
+
+// exhausted returns the error reported once the attempts ran out, with the
+// reason the last username was rejected.
+func (a *usernameAttempts) exhausted(reason string) error {
+    return fmt.Errorf("could not generate a valid username after %d attempts: %s", a.used, reason)
+}
+
+// generatedUsername matches the usernames generateUsername produces with the
+// credsutil and uuid strategies.
+var generatedUsername = regexp.MustCompile(`^[Vv]_[A-Za-z0-9]{11}_(r|rw)$`)
+
+// generateUsername returns a new username for role in the given casing
+// carrying the given privilege suffix, regenerating it until it matches
+// username_regex when one is configured and isn't among reserved_usernames.
+// Every username generated is taken from attempts.
+func (c *mgtvMysqlConnectionProducer) generateUsername(attempts *usernameAttempts, role, suffix, usernameCase string) (string, error) {
+    reason := "no attempts left"
+    for attempts.take() {
+        username, err := c.randomUsername(role)
+        if err != nil {
+            return "", fmt.Errorf("failed to generate username: %w", err)
+        }
+        username = shapeUsername(username, suffix, usernameCase)
+        if len(username) > maxUsernameLength || !validUsername.MatchString(username) {
+            return "", fmt.Errorf("generated username %q is invalid: it must be at most %d letters, digits and underscores", username, maxUsernameLength)
+        }
+        if c.usernameRegex != nil && !c.usernameRegex.MatchString(username) {
+            reason = fmt.Sprintf("none matched username_regex %q", c.UsernameRegex)
+            continue
+        }
+        if c.reservedUsernames[strings.ToLower(username)] {
+            reason = fmt.Sprintf("%q is reserved", username)
+            continue
+        }
+        return username, nil
+    }
+    return "", attempts.exhausted(reason)
+}
+
+// explicitUsernameField is the create statement field naming the user to
+// create instead of generating a name, for migrations. It is only accepted
+// with allow_explicit_username.
+const explicitUsernameField = "explicit_username"
+
+// shapeUsername applies usernameCase to username and appends the privilege
+// suffix.
+func shapeUsername(username, suffix, usernameCase string) string {
+    switch usernameCase {
+    case usernameCaseUpper:
+        username = strings.ToUpper(username)
+    case usernameCaseLower:
+        username = strings.ToLower(username)
+    }
+    return fmt.Sprintf("%s_%s", username, suffix)
+}
+
+// takeExplicitUsername removes explicit_username from body and returns it, or
+// an empty name when the statement doesn't carry one.
+func (c *mgtvMysqlConnectionProducer) takeExplicitUsername(body map[string]interface{}) (string, error) {
+    raw, ok := body[explicitUsernameField]
+    if !ok {
+        return "", nil
+    }
+    delete(body, explicitUsernameField)
+    if !c.AllowExplicitUsername {
+        return "", fmt.Errorf("create_statement contains %s, which requires allow_explicit_username", explicitUsernameField)
+    }
+    name, _ := raw.(string)
+    if len(name) == 0 {
+        return "", fmt.Errorf("invalid %s: must be a non-empty string", explicitUsernameField)
+    }
+    return name, nil
+}
+
+// explicitUsername returns the username a create naming name in
+// explicit_username is made with: name in the given casing carrying the
+// privilege suffix, held to the rules generated usernames are.
+func (c *mgtvMysqlConnectionProducer) explicitUsername(name, suffix, usernameCase string) (string, error) {
+    username := shapeUsername(name, suffix, usernameCase)
+    if len(username) > maxUsernameLength || !validUsername.MatchString(username) {
+        return "", fmt.Errorf("invalid %s %q: with its suffix it must be at most %d letters, digits and underscores", explicitUsernameField, name, maxUsernameLength)
+    }
+    if c.usernameRegex != nil && !c.usernameRegex.MatchString(username) {
+        return "", fmt.Errorf("invalid %s %q: %q does not match username_regex %q", explicitUsernameField, name, username, c.UsernameRegex)
+    }
+    if c.reservedUsernames[strings.ToLower(username)] {
+        return "", fmt.Errorf("invalid %s %q: %q is reserved", explicitUsernameField, name, username)
+    }
+    return username, nil
+}
+
+// randomUsername returns a random username for role, without suffix, produced
+// by username_strategy. The credsutil and uuid strategies return v_ prefixed
+// usernames of maxKeyLength characters, drawn from the configured random
+// source when there is one.
+func (c *mgtvMysqlConnectionProducer) randomUsername(role string) (string, error) {
+    switch c.UsernameStrategy {
+    case usernameStrategyUUID:
+        return c.uuidUsername()
+    case usernameStrategyTemplate:
+        return c.templateUsername(role)
+    }
+    if c.randomSource == nil {
+        username, err := credsutil.GenerateUsername(credsutil.DisplayName("", maxKeyLength))
+        if err != nil {
+            return "", err
+        }
+        return nameTrunc(username, maxKeyLength), nil
+    }
+    random, err := c.randomString(maxKeyLength - len("v_"))
+    if err != nil {
+        return "", err
+    }
+    return "v_" + random, nil
+}
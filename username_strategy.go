@@ -0,0 +1,86 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "bytes"
+    "crypto/rand"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "regexp"
+    "text/template"
+
+    "github.com/hashicorp/go-secure-stdlib/base62"
+)
+
+// How the random part of generated usernames is produced.
+const (
+    // usernameStrategyCredsutil uses credsutil.GenerateUsername.
+    usernameStrategyCredsutil = "credsutil"
+    // usernameStrategyUUID uses hex digits of a random UUID.
+    usernameStrategyUUID = "uuid"
+    // usernameStrategyTemplate renders username_template.
+    usernameStrategyTemplate = "custom-template"
+)
+
+// maxUsernameLength is the longest username MySQL accepts.
+const maxUsernameLength = 32
+
+// validUsername matches the characters a generated username may consist of.
+var validUsername = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// usernameTemplateData is what username_template is rendered with.
+type usernameTemplateData struct {
+    RoleName string
+}
+
+// parseUsernameTemplate parses username_template, rendering it once with a
+// sample role so that mistakes surface at config time. Its random function
+// returns that many base62 characters from the random source of c.
+func (c *mgtvMysqlConnectionProducer) parseUsernameTemplate(text string) (*template.Template, error) {
+    tmpl, err := template.New("username_template").Funcs(template.FuncMap{
+        "random": c.randomString,
+    }).Parse(text)
+    if err != nil {
+        return nil, fmt.Errorf("invalid username_template: %w", err)
+    }
+    if err := tmpl.Execute(&bytes.Buffer{}, usernameTemplateData{RoleName: "role"}); err != nil {
+        return nil, fmt.Errorf("invalid username_template: %w", err)
+    }
+    return tmpl, nil
+}
+
+// random returns the configured random source, or crypto/rand.
+func (c *mgtvMysqlConnectionProducer) random() io.Reader {
+    if c.randomSource != nil {
+        return c.randomSource
+    }
+    return rand.Reader
+}
+
+func (c *mgtvMysqlConnectionProducer) randomString(length int) (string, error) {
+    return base62.RandomWithReader(length, c.random())
+}
+
+// uuidUsername returns a v_ prefixed username of maxKeyLength characters taken
+// from the hex digits of a random version 4 UUID.
+func (c *mgtvMysqlConnectionProducer) uuidUsername() (string, error) {
+    var id [16]byte
+    if _, err := io.ReadFull(c.random(), id[:]); err != nil {
+        return "", err
+    }
+    id[6] = id[6]&0x0f | 0x40
+    id[8] = id[8]&0x3f | 0x80
+    return "v_" + hex.EncodeToString(id[:])[:maxKeyLength-len("v_")], nil
+}
+
+// templateUsername renders username_template for role.
+func (c *mgtvMysqlConnectionProducer) templateUsername(role string) (string, error) {
+    var username bytes.Buffer
+    if err := c.usernameTemplate.Execute(&username, usernameTemplateData{RoleName: role}); err != nil {
+        return "", err
+    }
+    return username.String(), nil
+}
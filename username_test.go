@@ -0,0 +1,451 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package mgmysql
+
+import (
+    "fmt"
+    "io"
+    "math/rand"
+    "regexp"
+    "strings"
+    "testing"
+)
+
+func TestUsernameRegex(t *testing.T) {
+    tests := []struct {
+        name    string
+        regex   string
+        wantErr string
+        // initErr is set when the config itself is rejected.
+        initErr bool
+    }{
+        {name: "always matching", regex: `^V_[A-Za-z0-9]+_r$`},
+        // Rejects the generated usernames starting with a digit, about one
+        // in six, so that creating several needs regeneration.
+        {name: "needs regeneration", regex: `^V_[A-Za-z]`},
+        {name: "unsatisfiable", regex: `^X`, wantErr: "could not generate a valid username after 10 attempts: none matched username_regex"},
+        {name: "invalid", regex: `^(`, wantErr: "invalid username_regex", initErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"username_regex": tt.regex}
+            if tt.initErr {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+            for i := 0; i < 20; i++ {
+                username, err := newUser(db, "role", testCreateStatement)
+                if len(tt.wantErr) > 0 {
+                    if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                        t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                    }
+                    if n := len(backend.received(actionAddUser)); n != 0 {
+                        t.Fatalf("AddUser sent %d times, want none", n)
+                    }
+                    return
+                }
+                if err != nil {
+                    t.Fatal(err)
+                }
+                if !regexp.MustCompile(tt.regex).MatchString(username) {
+                    t.Fatalf("username %q doesn't match %s", username, tt.regex)
+                }
+            }
+        })
+    }
+}
+
+func TestUsernameCase(t *testing.T) {
+    tests := []struct {
+        name         string
+        engine       string
+        usernameCase string
+        want         string
+        wantErr      string
+    }{
+        {name: "default engine", want: "MIXEDNAME_r"},
+        {name: "mysql", engine: engineMySQL, want: "MIXEDNAME_r"},
+        {name: "percona", engine: enginePercona, want: "MIXEDNAME_r"},
+        {name: "mariadb", engine: engineMariaDB, want: "MixedName_r"},
+        {name: "mysql, lower", engine: engineMySQL, usernameCase: usernameCaseLower, want: "mixedname_r"},
+        {name: "mysql, preserve", engine: engineMySQL, usernameCase: usernameCasePreserve, want: "MixedName_r"},
+        {name: "mariadb, upper", engine: engineMariaDB, usernameCase: usernameCaseUpper, want: "MIXEDNAME_r"},
+        {name: "invalid", usernameCase: "title", wantErr: "invalid username_case"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"allow_explicit_username": true, "username_case": tt.usernameCase}
+            if len(tt.engine) > 0 {
+                config["engine"] = tt.engine
+            }
+            if len(tt.wantErr) > 0 {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config)
+
+            explicit, err := newUser(db, "role", `{"cid":"c1","dbname":"d1","explicit_username":"MixedName"}`)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if explicit != tt.want {
+                t.Errorf("explicit username = %q, want %q", explicit, tt.want)
+            }
+            generated, err := newUser(db, "role", testCreateStatement)
+            if err != nil {
+                t.Fatal(err)
+            }
+            // Generated usernames get the casing the explicit one did.
+            name, want := strings.TrimSuffix(generated, "_r"), strings.TrimSuffix(tt.want, "_r")
+            switch want {
+            case strings.ToUpper(want):
+                if name != strings.ToUpper(name) {
+                    t.Errorf("generated username %q isn't uppercase", generated)
+                }
+            case strings.ToLower(want):
+                if name != strings.ToLower(name) {
+                    t.Errorf("generated username %q isn't lowercase", generated)
+                }
+            }
+        })
+    }
+}
+
+func TestUsernameAttempts(t *testing.T) {
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // creates is how many users are created in a row.
+        creates int
+        wantErr string
+    }{
+        {
+            name:    "reserved",
+            config:  map[string]interface{}{"username_template": "{{.RoleName}}", "reserved_usernames": []interface{}{"role_r"}},
+            creates: 1,
+            wantErr: `could not generate a valid username after 10 attempts: "ROLE_r" is reserved`,
+        },
+        {
+            name:    "regex",
+            config:  map[string]interface{}{"username_template": "{{.RoleName}}", "username_regex": "^X"},
+            creates: 1,
+            wantErr: `could not generate a valid username after 10 attempts: none matched username_regex "^X"`,
+        },
+        {
+            name:    "satisfiable",
+            config:  map[string]interface{}{"username_template": "{{.RoleName}}", "reserved_usernames": []interface{}{"root"}},
+            creates: 1,
+        },
+        // Each NewUser gets its own attempts: the creates need more than
+        // maxUsernameAttempts regenerations between them.
+        {
+            name:    "per NewUser",
+            config:  map[string]interface{}{"username_template": "V_{{random 1}}", "username_regex": "^V_[^0-9]"},
+            creates: 3 * maxUsernameAttempts,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"username_strategy": usernameStrategyTemplate}
+            for k, v := range tt.config {
+                config[k] = v
+            }
+            db := newTestDB(t, backend.URL, config)
+            for i := 0; i < tt.creates; i++ {
+                _, err := newUser(db, "role", testCreateStatement)
+                if len(tt.wantErr) > 0 {
+                    if err == nil || err.Error() != tt.wantErr {
+                        t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                    }
+                    if n := len(backend.received(actionAddUser)); n != 0 {
+                        t.Fatalf("AddUser sent %d times, want none", n)
+                    }
+                    return
+                }
+                if err != nil {
+                    t.Fatal(err)
+                }
+            }
+        })
+    }
+}
+
+func TestRandomSource(t *testing.T) {
+    // usernames returns the usernames of three users created with source.
+    usernames := func(t *testing.T, source io.Reader) []string {
+        backend := newFakeBackend(t)
+        var opts []Option
+        if source != nil {
+            opts = append(opts, WithRandomSource(source))
+        }
+        db := newTestDB(t, backend.URL, nil, opts...)
+        var names []string
+        for i := 0; i < 3; i++ {
+            username, err := newUser(db, "role", testCreateStatement)
+            if err != nil {
+                t.Fatal(err)
+            }
+            names = append(names, username)
+        }
+        return names
+    }
+    tests := []struct {
+        name string
+        // seeds seed the sources of the two runs, crypto/rand being used when
+        // nil.
+        seeds    []int64
+        wantSame bool
+    }{
+        {name: "same seed", seeds: []int64{1, 1}, wantSame: true},
+        {name: "different seeds", seeds: []int64{1, 2}},
+        {name: "crypto/rand"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var runs [2][]string
+            for i := range runs {
+                var source io.Reader
+                if tt.seeds != nil {
+                    source = rand.New(rand.NewSource(tt.seeds[i]))
+                }
+                runs[i] = usernames(t, source)
+            }
+            if same := strings.Join(runs[0], ",") == strings.Join(runs[1], ","); same != tt.wantSame {
+                t.Fatalf("runs generated %v and %v, want the same: %v", runs[0], runs[1], tt.wantSame)
+            }
+            for _, username := range runs[0] {
+                if !regexp.MustCompile(`^V_[A-Z0-9]+_r$`).MatchString(username) {
+                    t.Errorf("generated %q, want the V_..._r form", username)
+                }
+            }
+        })
+    }
+}
+
+func TestUsernameStrategy(t *testing.T) {
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // want matches the usernames the strategy generates for "role".
+        want    string
+        wantErr string
+        // initErr is set when the config itself is rejected.
+        initErr bool
+    }{
+        {name: "default", want: `^V_[A-Z0-9]{11}_r$`},
+        {name: "credsutil", config: map[string]interface{}{"username_strategy": usernameStrategyCredsutil}, want: `^V_[A-Z0-9]{11}_r$`},
+        {name: "uuid", config: map[string]interface{}{"username_strategy": usernameStrategyUUID}, want: `^V_[0-9A-F]{11}_r$`},
+        {
+            name:   "custom-template",
+            config: map[string]interface{}{"username_strategy": usernameStrategyTemplate, "username_template": "{{.RoleName}}_{{random 6}}"},
+            want:   `^ROLE_[A-Z0-9]{6}_r$`,
+        },
+        {
+            name:    "template too long",
+            config:  map[string]interface{}{"username_strategy": usernameStrategyTemplate, "username_template": "{{random 40}}"},
+            wantErr: fmt.Sprintf("it must be at most %d letters, digits and underscores", maxUsernameLength),
+        },
+        {
+            name:    "template with invalid characters",
+            config:  map[string]interface{}{"username_strategy": usernameStrategyTemplate, "username_template": "{{.RoleName}}-x"},
+            wantErr: `generated username "ROLE-X_r" is invalid`,
+        },
+        {name: "invalid", config: map[string]interface{}{"username_strategy": "sequential"}, wantErr: `invalid username_strategy "sequential"`, initErr: true},
+        {
+            name:    "missing template",
+            config:  map[string]interface{}{"username_strategy": usernameStrategyTemplate},
+            wantErr: "username_template is required",
+            initErr: true,
+        },
+        {
+            name:    "unparsable template",
+            config:  map[string]interface{}{"username_strategy": usernameStrategyTemplate, "username_template": "{{.RoleName"},
+            wantErr: "invalid username_template",
+            initErr: true,
+        },
+        // Caught rendering the sample role, before any user is created.
+        {
+            name:    "unknown template field",
+            config:  map[string]interface{}{"username_strategy": usernameStrategyTemplate, "username_template": "{{.DisplayName}}"},
+            wantErr: "invalid username_template",
+            initErr: true,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            if tt.initErr {
+                err := initError(t, backend.URL, tt.config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, tt.config)
+            seen := make(map[string]bool)
+            for i := 0; i < 5; i++ {
+                username, err := newUser(db, "role", testCreateStatement)
+                if len(tt.wantErr) > 0 {
+                    if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                        t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                    }
+                    if n := len(backend.received(actionAddUser)); n != 0 {
+                        t.Fatalf("AddUser sent %d times, want none", n)
+                    }
+                    return
+                }
+                if err != nil {
+                    t.Fatal(err)
+                }
+                if len(username) > maxUsernameLength || !regexp.MustCompile(tt.want).MatchString(username) {
+                    t.Fatalf("generated %q, want %s within %d characters", username, tt.want, maxUsernameLength)
+                }
+                if seen[username] {
+                    t.Fatalf("generated %q twice", username)
+                }
+                seen[username] = true
+            }
+        })
+    }
+}
+
+// TestReservedUsernames reserves the name a seeded random source generates
+// first, so that creating a user has to regenerate it.
+func TestReservedUsernames(t *testing.T) {
+    // generated returns the first two usernames generated with seed 1.
+    generated := func(t *testing.T, config map[string]interface{}) []string {
+        backend := newFakeBackend(t)
+        db := newTestDB(t, backend.URL, config, WithRandomSource(rand.New(rand.NewSource(1))))
+        var names []string
+        for i := 0; i < 2; i++ {
+            username, err := newUser(db, "role", testCreateStatement)
+            if err != nil {
+                t.Fatal(err)
+            }
+            names = append(names, username)
+        }
+        return names
+    }
+    tests := []struct {
+        name   string
+        config map[string]interface{}
+        // reserve returns the reserved_usernames entry for the first name.
+        reserve func(username string) string
+        wantErr string
+    }{
+        {name: "same case", reserve: func(username string) string { return username }},
+        {name: "other case", reserve: strings.ToLower},
+        {name: "padded", reserve: func(username string) string { return " " + username + " " }},
+        // Checked after username_case is applied.
+        {name: "after casing", config: map[string]interface{}{"username_case": usernameCaseLower}, reserve: strings.ToUpper},
+        {name: "empty entry", reserve: func(string) string { return " " }, wantErr: "invalid reserved_usernames: names must not be empty"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            names := generated(t, tt.config)
+            config := map[string]interface{}{"reserved_usernames": []interface{}{"root", tt.reserve(names[0])}}
+            for k, v := range tt.config {
+                config[k] = v
+            }
+            backend := newFakeBackend(t)
+            if len(tt.wantErr) > 0 {
+                err := initError(t, backend.URL, config)
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("Initialize error = %v, want %q", err, tt.wantErr)
+                }
+                return
+            }
+            db := newTestDB(t, backend.URL, config, WithRandomSource(rand.New(rand.NewSource(1))))
+            username, err := newUser(db, "role", testCreateStatement)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if username != names[1] {
+                t.Fatalf("created %q, want the regenerated %q rather than the reserved %q", username, names[1], names[0])
+            }
+            if n := len(backend.received(actionAddUser)); n != 1 {
+                t.Fatalf("AddUser sent %d times, want 1", n)
+            }
+        })
+    }
+}
+
+func TestExplicitUsername(t *testing.T) {
+    tests := []struct {
+        name      string
+        config    map[string]interface{}
+        statement string
+        want      string
+        wantErr   string
+    }{
+        {name: "created", statement: `{"cid":"c1","dbname":"d1","explicit_username":"legacy_app"}`, want: "LEGACY_APP_r"},
+        {name: "read-write suffix", statement: `{"cid":"c1","dbname":"d1","priv":1,"explicit_username":"legacy_app"}`, want: "LEGACY_APP_rw"},
+        {
+            name:      "not allowed",
+            config:    map[string]interface{}{"allow_explicit_username": false},
+            statement: `{"cid":"c1","dbname":"d1","explicit_username":"legacy_app"}`,
+            wantErr:   "create_statement contains explicit_username, which requires allow_explicit_username",
+        },
+        {name: "empty", statement: `{"cid":"c1","dbname":"d1","explicit_username":""}`, wantErr: "invalid explicit_username: must be a non-empty string"},
+        {name: "not a string", statement: `{"cid":"c1","dbname":"d1","explicit_username":7}`, wantErr: "invalid explicit_username: must be a non-empty string"},
+        {name: "invalid characters", statement: `{"cid":"c1","dbname":"d1","explicit_username":"legacy-app"}`, wantErr: `invalid explicit_username "legacy-app"`},
+        {
+            name:      "too long with its suffix",
+            statement: `{"cid":"c1","dbname":"d1","explicit_username":"` + strings.Repeat("a", maxUsernameLength-1) + `"}`,
+            wantErr:   fmt.Sprintf("with its suffix it must be at most %d letters", maxUsernameLength),
+        },
+        {
+            name:      "regex mismatch",
+            config:    map[string]interface{}{"username_regex": "^V_"},
+            statement: `{"cid":"c1","dbname":"d1","explicit_username":"legacy_app"}`,
+            wantErr:   `"LEGACY_APP_r" does not match username_regex "^V_"`,
+        },
+        {
+            name:      "reserved",
+            config:    map[string]interface{}{"reserved_usernames": []interface{}{"root_r"}},
+            statement: `{"cid":"c1","dbname":"d1","explicit_username":"root"}`,
+            wantErr:   `invalid explicit_username "root": "ROOT_r" is reserved`,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            backend := newFakeBackend(t)
+            config := map[string]interface{}{"allow_explicit_username": true}
+            for k, v := range tt.config {
+                config[k] = v
+            }
+            db := newTestDB(t, backend.URL, config)
+            username, err := newUser(db, "role", tt.statement)
+            if len(tt.wantErr) > 0 {
+                if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+                    t.Fatalf("NewUser error = %v, want %q", err, tt.wantErr)
+                }
+                if n := len(backend.received(actionAddUser)); n != 0 {
+                    t.Fatalf("AddUser sent %d times, want none", n)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            body := backend.received(actionAddUser)[0].Body
+            if username != tt.want || body["username"] != tt.want {
+                t.Fatalf("created %q, sending username %v, want %q", username, body["username"], tt.want)
+            }
+            if _, ok := body[explicitUsernameField]; ok {
+                t.Errorf("AddUser body carries %s: %v", explicitUsernameField, body)
+            }
+        })
+    }
+}